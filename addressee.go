@@ -0,0 +1,66 @@
+package main
+
+import (
+	"log/slog"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// addresseeFolders routes documents into per-person folders by the name of
+// who they are addressed to.
+type addresseeFolders map[string]string
+
+func loadAddresseeFolders(path string) (addresseeFolders, error) {
+	if path == "" {
+		return addresseeFolders{}, nil
+	}
+
+	return loadMapping(path)
+}
+
+// folder returns the folder for the best matching name. Names match when
+// they are similar enough, or when every word of the configured name is in
+// the addressee, so "Jane Doe" matches "Dr. Jane A. Doe".
+func (a addresseeFolders) folder(addressee string, threshold float64) (string, bool) {
+	extracted := normalizeName(addressee)
+	extractedWords := strings.Fields(extracted)
+
+	best, bestScore := "", 0.0
+
+	for name, folder := range a {
+		normalized := normalizeName(name)
+
+		score := similarity(extracted, normalized)
+
+		words := strings.Fields(normalized)
+		if 0 < len(words) && !slices.ContainsFunc(words, func(word string) bool {
+			return !slices.Contains(extractedWords, word)
+		}) {
+			score = 1
+		}
+
+		if score > bestScore {
+			best, bestScore = folder, score
+		}
+	}
+
+	return best, best != "" && threshold <= bestScore
+}
+
+// route prefixes the filename with the addressee's folder, or the default
+// folder when nobody matches.
+func (c *RenameFlags) route(folders addresseeFolders, addressee, filename string) string {
+	folder, ok := folders.folder(addressee, c.MatchThreshold)
+	if !ok {
+		folder = c.AddresseeDefault
+	}
+
+	slog.Info("route", "addressee", addressee, "folder", folder)
+
+	if folder == "" {
+		return filename
+	}
+
+	return filepath.Join(folder, filename)
+}
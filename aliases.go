@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// aliases map extracted values, compared case-insensitively, to the
+// canonical value used in filenames.
+type aliases map[string]string
+
+// loadAliases reads a YAML file of either `alias: canonical` pairs or
+// `canonical: [alias, ...]` lists, which can be mixed.
+func loadAliases(path string) (aliases, error) {
+	if path == "" {
+		return aliases{}, nil
+	}
+
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read aliases: %w", err)
+	}
+
+	var entries map[string]any
+
+	err = yaml.Unmarshal(contents, &entries)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal aliases: %w", err)
+	}
+
+	mapping := aliases{}
+
+	for key, value := range entries {
+		switch value := value.(type) {
+		case string:
+			mapping[normalizeAlias(key)] = value
+		case []any:
+			for _, alias := range value {
+				mapping[normalizeAlias(fmt.Sprint(alias))] = key
+			}
+		default:
+			return nil, fmt.Errorf("alias %q must be a string or a list of strings", key)
+		}
+	}
+
+	return mapping, nil
+}
+
+// canonical returns the canonical value for an alias, or the value itself
+// when it has no alias.
+func (a aliases) canonical(value string) string {
+	if canonical, ok := a[normalizeAlias(value)]; ok {
+		return canonical
+	}
+
+	return value
+}
+
+// rewrite replaces every aliased value in place.
+func (a aliases) rewrite(values map[string]string) {
+	for field, value := range values {
+		values[field] = a.canonical(value)
+	}
+}
+
+func normalizeAlias(value string) string {
+	return strings.ToLower(strings.Join(strings.Fields(value), " "))
+}
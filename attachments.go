@@ -0,0 +1,291 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// pdfAttachment is a file embedded in a PDF, such as the XML of a ZUGFeRD or
+// Factur-X e-invoice.
+type pdfAttachment struct {
+	name     string
+	contents []byte
+}
+
+// pdfObject is an indirect object of a PDF, with its decoded stream if it has
+// one.
+type pdfObject struct {
+	dict   []byte
+	stream []byte
+}
+
+// maxDecodedSize is the most bytes the streams of a PDF are decoded into, so
+// that a small compressed stream that expands to gigabytes cannot exhaust
+// memory. Streams past it are skipped.
+const maxDecodedSize = 64 << 20
+
+var (
+	pdfObjectStart   = regexp.MustCompile(`(\d+)\s+\d+\s+obj\b`)
+	pdfEmbeddedFile  = regexp.MustCompile(`/Type\s*/EmbeddedFile\b`)
+	pdfObjectStream  = regexp.MustCompile(`/Type\s*/ObjStm\b`)
+	pdfFirst         = regexp.MustCompile(`/First\s+(\d+)`)
+	pdfFileSpecRef   = regexp.MustCompile(`/EF\s*<<[^>]*?/(?:UF|F)\s+(\d+)\s+\d+\s+R`)
+	pdfFileSpecName  = regexp.MustCompile(`/(UF|F)\s*\(((?:\\.|[^\\)])*)\)`)
+	pdfFileSpecHex   = regexp.MustCompile(`/(UF|F)\s*<([0-9A-Fa-f\s]*)>`)
+	pdfUnsafeInName  = regexp.MustCompile(`[/\\:\x00]`)
+	pdfStringEscapes = strings.NewReplacer(`\(`, "(", `\)`, ")", `\\`, `\`, `\n`, "\n", `\r`, "\r", `\t`, "\t")
+)
+
+// pdfAttachments returns the files embedded in the PDF. Only the FlateDecode
+// filter is supported, which is what PDF writers use for attachments.
+func pdfAttachments(filename string) ([]pdfAttachment, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read PDF: %w", err)
+	}
+
+	objects := pdfObjects(data)
+
+	// file specifications name the embedded files they reference
+	names := map[string]string{}
+	for _, object := range objects {
+		ref := pdfFileSpecRef.FindSubmatch(object.dict)
+		if ref == nil {
+			continue
+		}
+
+		if name := pdfFileSpecFilename(object.dict); name != "" {
+			names[string(ref[1])] = name
+		}
+	}
+
+	attachments := []pdfAttachment{}
+
+	for _, number := range slices.Sorted(maps.Keys(objects)) {
+		object := objects[number]
+		if !pdfEmbeddedFile.Match(object.dict) || object.stream == nil {
+			continue
+		}
+
+		name := pdfUnsafeInName.ReplaceAllString(names[number], "_")
+		if name == "" || name == "." || name == ".." {
+			name = "attachment-" + number
+			if bytes.HasPrefix(bytes.TrimSpace(object.stream), []byte("<?xml")) {
+				name += ".xml"
+			}
+		}
+
+		attachments = append(attachments, pdfAttachment{name: name, contents: object.stream})
+	}
+
+	return attachments, nil
+}
+
+// pdfObjects finds the indirect objects of a PDF by their number, including
+// those compressed into object streams. Only the streams of embedded files
+// and object streams are decoded, as no other stream is read.
+func pdfObjects(data []byte) map[string]pdfObject {
+	objects := map[string]pdfObject{}
+	remaining := maxDecodedSize
+
+	for _, match := range pdfObjectStart.FindAllSubmatchIndex(data, -1) {
+		number := string(data[match[2]:match[3]])
+		body := data[match[1]:]
+
+		if end := bytes.Index(body, []byte("endobj")); 0 <= end {
+			body = body[:end]
+		}
+
+		object := pdfObject{dict: body}
+
+		if start := bytes.Index(body, []byte("stream")); 0 <= start {
+			object.dict = body[:start]
+
+			if !pdfEmbeddedFile.Match(object.dict) && !pdfObjectStream.Match(object.dict) {
+				objects[number] = object
+				continue
+			}
+
+			stream := body[start+len("stream"):]
+			stream = bytes.TrimPrefix(stream, []byte("\r"))
+			stream = bytes.TrimPrefix(stream, []byte("\n"))
+
+			if end := bytes.LastIndex(stream, []byte("endstream")); 0 <= end {
+				stream = bytes.TrimRight(stream[:end], "\r\n")
+			}
+
+			object.stream = pdfDecode(object.dict, stream, &remaining)
+		}
+
+		objects[number] = object
+
+		if pdfObjectStream.Match(object.dict) && object.stream != nil {
+			for number, compressed := range pdfCompressedObjects(object) {
+				if _, ok := objects[number]; !ok {
+					objects[number] = compressed
+				}
+			}
+		}
+	}
+
+	return objects
+}
+
+// pdfCompressedObjects splits an object stream into its objects, which are
+// never streams themselves.
+func pdfCompressedObjects(stream pdfObject) map[string]pdfObject {
+	objects := map[string]pdfObject{}
+
+	match := pdfFirst.FindSubmatch(stream.dict)
+	if match == nil {
+		return objects
+	}
+
+	first, err := strconv.Atoi(string(match[1]))
+	if err != nil || len(stream.stream) < first {
+		return objects
+	}
+
+	header := strings.Fields(string(stream.stream[:first]))
+	for i := 0; i+1 < len(header); i += 2 {
+		offset, err := strconv.Atoi(header[i+1])
+		if err != nil || len(stream.stream) < first+offset {
+			continue
+		}
+
+		end := len(stream.stream)
+		if i+3 < len(header) {
+			next, err := strconv.Atoi(header[i+3])
+			if err == nil && first+next <= end && offset <= next {
+				end = first + next
+			}
+		}
+
+		objects[header[i]] = pdfObject{dict: stream.stream[first+offset : end]}
+	}
+
+	return objects
+}
+
+// pdfDecode returns the decoded stream, or nil when its filter is not
+// supported or it decodes to more than the remaining bytes, which it takes
+// from.
+func pdfDecode(dict, stream []byte, remaining *int) []byte {
+	if !bytes.Contains(dict, []byte("/Filter")) {
+		return stream
+	}
+
+	if !bytes.Contains(dict, []byte("/FlateDecode")) {
+		return nil
+	}
+
+	reader, err := zlib.NewReader(bytes.NewReader(stream))
+	if err != nil {
+		return nil
+	}
+	defer reader.Close()
+
+	// streams with a missing end of data are still mostly readable
+	decoded, _ := io.ReadAll(io.LimitReader(reader, int64(*remaining)+1))
+	if *remaining < len(decoded) {
+		return nil
+	}
+
+	*remaining -= len(decoded)
+
+	return decoded
+}
+
+// pdfFileSpecFilename returns the name of a file specification, preferring
+// the Unicode /UF over /F.
+func pdfFileSpecFilename(dict []byte) string {
+	names := map[string]string{}
+
+	for _, match := range pdfFileSpecName.FindAllSubmatch(dict, -1) {
+		names[string(match[1])] = pdfText([]byte(pdfStringEscapes.Replace(string(match[2]))))
+	}
+
+	for _, match := range pdfFileSpecHex.FindAllSubmatch(dict, -1) {
+		hex := strings.Join(strings.Fields(string(match[2])), "")
+
+		decoded := []byte{}
+		for i := 0; i+1 < len(hex); i += 2 {
+			value, err := strconv.ParseUint(hex[i:i+2], 16, 8)
+			if err != nil {
+				break
+			}
+
+			decoded = append(decoded, byte(value))
+		}
+
+		names[string(match[1])] = pdfText(decoded)
+	}
+
+	if name := names["UF"]; name != "" {
+		return filepath.Base(name)
+	}
+
+	if name := names["F"]; name != "" {
+		return filepath.Base(name)
+	}
+
+	return ""
+}
+
+// pdfText decodes a PDF text string, which is UTF-16 with a byte order mark
+// or otherwise PDFDocEncoding, close enough to Latin-1 for filenames.
+func pdfText(text []byte) string {
+	if bytes.HasPrefix(text, []byte{0xfe, 0xff}) {
+		units := []uint16{}
+		for i := 2; i+1 < len(text); i += 2 {
+			units = append(units, uint16(text[i])<<8|uint16(text[i+1]))
+		}
+
+		return string(utf16.Decode(units))
+	}
+
+	runes := make([]rune, len(text))
+	for i, b := range text {
+		runes[i] = rune(b)
+	}
+
+	return string(runes)
+}
+
+// writeAttachments writes the files embedded in the PDF next to the renamed
+// document, prefixed with its name, and returns their filenames.
+func writeAttachments(filename string) ([]string, error) {
+	attachments, err := pdfAttachments(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	stem := strings.TrimSuffix(filename, filepath.Ext(filename))
+	written := []string{}
+
+	for _, attachment := range attachments {
+		name := stem + "." + attachment.name
+
+		err := writeFile(name, 0o644, true, func(file io.Writer) error {
+			_, err := file.Write(attachment.contents)
+			return err
+		})
+		if err != nil {
+			return written, fmt.Errorf("failed to write attachment: %w", err)
+		}
+
+		written = append(written, name)
+	}
+
+	return written, nil
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// awsCredentials are read from the standard environment variables, or from
+// the container credentials endpoint on ECS and EKS. Temporary credentials
+// have an expiration, after which they are loaded again.
+type awsCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	Token           string
+	Expiration      time.Time
+}
+
+// awsRefreshBefore is how long before they expire credentials are loaded
+// again, so that a request signed with them does not expire in flight.
+const awsRefreshBefore = 5 * time.Minute
+
+func loadAWSCredentials(ctx context.Context) (awsCredentials, error) {
+	credentials := awsCredentials{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		Token:           os.Getenv("AWS_SESSION_TOKEN"),
+	}
+
+	if credentials.AccessKeyID != "" && credentials.SecretAccessKey != "" {
+		return credentials, nil
+	}
+
+	endpoint := os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI")
+	if relative := os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"); relative != "" {
+		endpoint = "http://169.254.170.2" + relative
+	}
+
+	if endpoint == "" {
+		return credentials, errors.New("no AWS credentials, set AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return credentials, fmt.Errorf("failed to create credentials request: %w", err)
+	}
+
+	if token := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN"); token != "" {
+		request.Header.Set("Authorization", token)
+	}
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return credentials, fmt.Errorf("failed to fetch container credentials: %w", err)
+	}
+	defer response.Body.Close()
+
+	err = json.NewDecoder(response.Body).Decode(&credentials)
+	if err != nil {
+		return credentials, fmt.Errorf("failed to decode container credentials: %w", err)
+	}
+
+	return credentials, nil
+}
+
+// awsClient sends requests signed with AWS Signature Version 4.
+type awsClient struct {
+	region string
+	client *http.Client
+	now    func() time.Time
+
+	mu          sync.Mutex
+	credentials awsCredentials
+}
+
+func newAWSClient(ctx context.Context, region string) (*awsClient, error) {
+	if region == "" {
+		region = os.Getenv("AWS_REGION")
+	}
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if region == "" {
+		return nil, errors.New("no AWS region, set --region or AWS_REGION")
+	}
+
+	credentials, err := loadAWSCredentials(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &awsClient{
+		region:      region,
+		credentials: credentials,
+		client:      &http.Client{Timeout: 5 * time.Minute},
+		now:         time.Now,
+	}, nil
+}
+
+// do signs and sends the request, returning an error for non-2xx responses.
+// Credentials about to expire are loaded again before signing, and a request
+// rejected for expired credentials is signed again with new ones, as
+// long-running commands such as sqs outlive temporary credentials.
+func (a *awsClient) do(request *http.Request, service string, payload []byte) (*http.Response, error) {
+	credentials, err := a.current(request.Context(), false)
+	if err != nil {
+		return nil, err
+	}
+
+	for attempt := 0; ; attempt++ {
+		a.sign(request, service, payload, credentials)
+
+		if payload != nil {
+			request.Body = io.NopCloser(bytes.NewReader(payload))
+			request.ContentLength = int64(len(payload))
+		}
+
+		response, err := a.client.Do(request)
+		if err != nil {
+			return nil, err
+		}
+
+		if 200 <= response.StatusCode && response.StatusCode <= 299 {
+			return response, nil
+		}
+
+		body, _ := io.ReadAll(io.LimitReader(response.Body, 4096))
+		_ = response.Body.Close()
+
+		if attempt == 0 && expiredToken(body) {
+			slog.Warn("aws.credentials.expired", "service", service)
+
+			credentials, err = a.current(request.Context(), true)
+			if err != nil {
+				return nil, err
+			}
+
+			continue
+		}
+
+		return nil, awsStatusError{
+			method: request.Method,
+			url:    request.URL.Redacted(),
+			status: response.Status,
+			code:   response.StatusCode,
+			body:   strings.TrimSpace(string(body)),
+		}
+	}
+}
+
+// awsStatusError is a non-2xx response, with its status code for telling
+// apart a missing object.
+type awsStatusError struct {
+	method, url, status string
+	code                int
+	body                string
+}
+
+func (e awsStatusError) Error() string {
+	return fmt.Sprintf("%s %s: %s: %s", e.method, e.url, e.status, e.body)
+}
+
+// current returns the credentials to sign with, loading them again when they
+// are about to expire, or when forced to after they were rejected.
+func (a *awsClient) current(ctx context.Context, force bool) (awsCredentials, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	expiring := !a.credentials.Expiration.IsZero() && a.now().Add(awsRefreshBefore).After(a.credentials.Expiration)
+	if !force && !expiring {
+		return a.credentials, nil
+	}
+
+	credentials, err := loadAWSCredentials(ctx)
+	if err != nil {
+		return a.credentials, fmt.Errorf("failed to refresh AWS credentials: %w", err)
+	}
+
+	slog.Info("aws.credentials.refresh", "expiration", credentials.Expiration)
+	a.credentials = credentials
+
+	return credentials, nil
+}
+
+// expiredToken reports whether an error response is for expired credentials,
+// which services report with one of these codes or messages.
+func expiredToken(body []byte) bool {
+	return bytes.Contains(body, []byte("ExpiredToken")) ||
+		bytes.Contains(body, []byte("RequestExpired")) ||
+		bytes.Contains(body, []byte("The security token included in the request is expired"))
+}
+
+func (a *awsClient) sign(request *http.Request, service string, payload []byte, credentials awsCredentials) {
+	now := a.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	payloadHash := sha256Hex(payload)
+
+	request.Header.Set("X-Amz-Date", amzDate)
+	request.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	if credentials.Token != "" {
+		request.Header.Set("X-Amz-Security-Token", credentials.Token)
+	} else {
+		request.Header.Del("X-Amz-Security-Token")
+	}
+
+	headers := map[string]string{"host": request.URL.Host}
+	for name, values := range request.Header {
+		name = strings.ToLower(name)
+		if name == "content-type" || strings.HasPrefix(name, "x-amz-") {
+			headers[name] = strings.Join(strings.Fields(strings.Join(values, ",")), " ")
+		}
+	}
+
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	canonicalHeaders := &strings.Builder{}
+	for _, name := range names {
+		fmt.Fprintf(canonicalHeaders, "%s:%s\n", name, headers[name])
+	}
+
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		request.Method,
+		canonicalURI(request.URL, service),
+		canonicalQuery(request.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := strings.Join([]string{date, a.region, service, "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := []byte("AWS4" + credentials.SecretAccessKey)
+	for _, part := range []string{date, a.region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	request.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		credentials.AccessKeyID, scope, signedHeaders, signature,
+	))
+}
+
+// canonicalURI encodes the path once for S3 and twice for other services,
+// as Signature Version 4 requires.
+func canonicalURI(u *url.URL, service string) string {
+	path := u.EscapedPath()
+	if path == "" {
+		return "/"
+	}
+
+	if service == "s3" {
+		return path
+	}
+
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = awsEscape(segment)
+	}
+
+	return strings.Join(segments, "/")
+}
+
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	pairs := []string{}
+	for _, key := range keys {
+		values := slices.Clone(query[key])
+		slices.Sort(values)
+
+		for _, value := range values {
+			pairs = append(pairs, awsEscape(key)+"="+awsEscape(value))
+		}
+	}
+
+	return strings.Join(pairs, "&")
+}
+
+// awsEscape percent-encodes everything except unreserved characters.
+func awsEscape(value string) string {
+	escaped := &strings.Builder{}
+
+	for _, b := range []byte(value) {
+		if 'A' <= b && b <= 'Z' || 'a' <= b && b <= 'z' || '0' <= b && b <= '9' ||
+			b == '-' || b == '_' || b == '.' || b == '~' {
+			escaped.WriteByte(b)
+		} else {
+			fmt.Fprintf(escaped, "%%%02X", b)
+		}
+	}
+
+	return escaped.String()
+}
+
+// awsEscapePath escapes each segment of an object key, keeping slashes.
+func awsEscapePath(key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = awsEscape(segment)
+	}
+
+	return strings.Join(segments, "/")
+}
+
+func sha256Hex(payload []byte) string {
+	hash := sha256.Sum256(payload)
+
+	return hex.EncodeToString(hash[:])
+}
+
+func hmacSHA256(key []byte, value string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(value))
+
+	return mac.Sum(nil)
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// The kinds of failures reported at the end of a batch.
+const (
+	failureProvider   = "provider"
+	failureTemplate   = "template"
+	failureFilesystem = "filesystem"
+	failureLocked     = "locked"
+	failureReview     = "review"
+	failureOther      = "other"
+)
+
+// templateError is an error in parsing, rendering, or validating the filename
+// format.
+type templateError struct {
+	error
+}
+
+func (e templateError) Unwrap() error {
+	return e.error
+}
+
+// providerError is an error in reaching the provider, from its HTTP client,
+// as opposed to the network errors of storage or webhooks.
+type providerError struct {
+	error
+}
+
+func (e providerError) Unwrap() error {
+	return e.error
+}
+
+// renamedError is an error after the document was moved to its new name, such
+// as in writing its sidecars, so there is nothing left to quarantine.
+type renamedError struct {
+	error
+}
+
+func (e renamedError) Unwrap() error {
+	return e.error
+}
+
+// failureKind categorizes an error for the summary of a batch.
+func failureKind(err error) string {
+	var (
+		templateErr templateError
+		reviewErr   reviewable
+		apiErr      *openai.APIError
+		requestErr  *openai.RequestError
+		providerErr providerError
+		pathErr     *fs.PathError
+		linkErr     *os.LinkError
+	)
+
+	switch {
+	case errors.As(err, &templateErr):
+		return failureTemplate
+	case errors.Is(err, errLocked):
+		return failureLocked
+	case errors.As(err, &reviewErr):
+		return failureReview
+	case errors.As(err, &apiErr), errors.As(err, &requestErr), errors.As(err, &providerErr):
+		return failureProvider
+	case errors.As(err, &pathErr), errors.As(err, &linkErr):
+		return failureFilesystem
+	}
+
+	return failureOther
+}
+
+// batch collects the results of renaming several documents, so that one
+// failure does not stop the rest.
+type batch struct {
+	total    int
+	failures []batchFailure
+}
+
+type batchFailure struct {
+	name string
+	kind string
+	err  error
+}
+
+func (b *batch) add(name string, err error) {
+	b.total++
+
+	if err == nil {
+		return
+	}
+
+	failure := batchFailure{name: name, kind: failureKind(err), err: err}
+	b.failures = append(b.failures, failure)
+	run.failed(name, err)
+
+	slog.Error("batch.failure", "name", name, "kind", failure.kind, "error", err)
+}
+
+// summarize writes the number of renamed documents, the failures by kind, and
+// each failure.
+func (b *batch) summarize(w io.Writer) {
+	printer.Fprintf(w, "renamed %d of %d documents", b.total-len(b.failures), b.total)
+	fmt.Fprintln(w)
+
+	if len(b.failures) == 0 {
+		return
+	}
+
+	counts := map[string]int{}
+	for _, failure := range b.failures {
+		counts[failure.kind]++
+	}
+
+	kinds := []string{}
+	for _, kind := range slices.Sorted(maps.Keys(counts)) {
+		kinds = append(kinds, fmt.Sprintf("%d %s", counts[kind], printer.Sprintf(kind)))
+	}
+
+	printer.Fprintf(w, "failed: %s", strings.Join(kinds, ", "))
+	fmt.Fprintln(w)
+
+	for _, failure := range b.failures {
+		fmt.Fprintf(w, "  %s: %s: %s\n", failure.name, printer.Sprintf(failure.kind), errorText(failure.err))
+	}
+}
+
+// err summarizes the failures, with the exit code of their kind when they
+// all failed the same way, or for partial failures when some documents were
+// renamed.
+func (b *batch) err() error {
+	if b.total == 0 {
+		return errNothingToDo
+	}
+
+	if len(b.failures) == 0 {
+		return nil
+	}
+
+	err := errors.New(printer.Sprintf("%d of %d documents failed", len(b.failures), b.total))
+
+	if len(b.failures) < b.total {
+		return exitError{err, exitPartial}
+	}
+
+	code := exitCode(b.failures[0].err)
+	for _, failure := range b.failures[1:] {
+		if exitCode(failure.err) != code {
+			return exitError{err, exitFailure}
+		}
+	}
+
+	return exitError{err, code}
+}
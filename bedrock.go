@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// bedrockTransport answers the OpenAI client's chat completion requests with
+// AWS Bedrock's Converse API, signed with the environment's AWS credentials,
+// so Claude and Nova models run without an OpenAI compatible endpoint.
+type bedrockTransport struct {
+	region       string
+	endpoint     string
+	cacheControl bool
+
+	once   sync.Once
+	aws    *awsClient
+	awsErr error
+}
+
+type converseRequest struct {
+	System          []converseBlock          `json:"system,omitempty"`
+	Messages        []converseMessage        `json:"messages"`
+	InferenceConfig *converseInferenceConfig `json:"inferenceConfig,omitempty"`
+}
+
+type converseMessage struct {
+	Role    string          `json:"role"`
+	Content []converseBlock `json:"content"`
+}
+
+type converseBlock struct {
+	Text       string              `json:"text,omitempty"`
+	Image      *converseImage      `json:"image,omitempty"`
+	CachePoint *converseCachePoint `json:"cachePoint,omitempty"`
+}
+
+type converseImage struct {
+	Format string `json:"format"`
+	Source struct {
+		Bytes string `json:"bytes"`
+	} `json:"source"`
+}
+
+type converseCachePoint struct {
+	Type string `json:"type"`
+}
+
+type converseInferenceConfig struct {
+	MaxTokens   int     `json:"maxTokens,omitempty"`
+	Temperature float32 `json:"temperature,omitempty"`
+}
+
+type converseResponse struct {
+	Output struct {
+		Message converseMessage `json:"message"`
+	} `json:"output"`
+	StopReason string `json:"stopReason"`
+	Usage      struct {
+		InputTokens          int `json:"inputTokens"`
+		OutputTokens         int `json:"outputTokens"`
+		TotalTokens          int `json:"totalTokens"`
+		CacheReadInputTokens int `json:"cacheReadInputTokens"`
+	} `json:"usage"`
+}
+
+func (t *bedrockTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	if !strings.HasSuffix(request.URL.Path, "/chat/completions") {
+		return nil, fmt.Errorf("failed to send %s to Bedrock: only chat completions are supported", request.URL.Path)
+	}
+
+	t.once.Do(func() {
+		t.aws, t.awsErr = newAWSClient(context.WithoutCancel(request.Context()), t.region)
+	})
+	if t.awsErr != nil {
+		return nil, t.awsErr
+	}
+
+	body, err := io.ReadAll(request.Body)
+	_ = request.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read request: %w", err)
+	}
+
+	var completion openai.ChatCompletionRequest
+
+	err = json.Unmarshal(body, &completion)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal request: %w", err)
+	}
+
+	if completion.Stream {
+		return nil, errors.New("failed to send request to Bedrock: streaming is not supported")
+	}
+
+	converse, err := t.converseRequest(completion)
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := json.Marshal(converse)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal Converse request: %w", err)
+	}
+
+	endpoint := &url.URL{Scheme: "https", Host: fmt.Sprintf("bedrock-runtime.%s.amazonaws.com", t.aws.region)}
+	if t.endpoint != "" {
+		endpoint, err = url.Parse(t.endpoint)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse Bedrock endpoint: %w", err)
+		}
+	}
+
+	endpoint = endpoint.JoinPath("model", completion.Model, "converse")
+
+	converseHTTPRequest, err := http.NewRequestWithContext(request.Context(), http.MethodPost, endpoint.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Converse request: %w", err)
+	}
+	converseHTTPRequest.Header.Set("Content-Type", "application/json")
+
+	response, err := t.aws.do(converseHTTPRequest, "bedrock", payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to converse with Bedrock: %w", err)
+	}
+	defer response.Body.Close()
+
+	var output converseResponse
+
+	err = json.NewDecoder(response.Body).Decode(&output)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode Converse response: %w", err)
+	}
+
+	content := &strings.Builder{}
+	for _, block := range output.Output.Message.Content {
+		content.WriteString(block.Text)
+	}
+
+	text := content.String()
+	if completion.ResponseFormat != nil && completion.ResponseFormat.Type == openai.ChatCompletionResponseFormatTypeJSONObject {
+		text = jsonObject(text)
+	}
+
+	finishReason := openai.FinishReasonStop
+	if output.StopReason == "max_tokens" {
+		finishReason = openai.FinishReasonLength
+	}
+
+	payload, err = json.Marshal(openai.ChatCompletionResponse{
+		Object: "chat.completion",
+		Model:  completion.Model,
+		Choices: []openai.ChatCompletionChoice{{
+			Message: openai.ChatCompletionMessage{
+				Role:    openai.ChatMessageRoleAssistant,
+				Content: text,
+			},
+			FinishReason: finishReason,
+		}},
+		Usage: openai.Usage{
+			PromptTokens:     output.Usage.InputTokens,
+			CompletionTokens: output.Usage.OutputTokens,
+			TotalTokens:      output.Usage.TotalTokens,
+			PromptTokensDetails: &openai.PromptTokensDetails{
+				CachedTokens: output.Usage.CacheReadInputTokens,
+			},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal chat completion: %w", err)
+	}
+
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {"application/json"}},
+		Body:          io.NopCloser(bytes.NewReader(payload)),
+		ContentLength: int64(len(payload)),
+		Request:       request,
+	}, nil
+}
+
+// converseRequest translates the chat completion to a Converse request. The
+// system messages become system prompts, with a cache point after the first
+// with --cache-control, and data URLs become images.
+func (t *bedrockTransport) converseRequest(completion openai.ChatCompletionRequest) (converseRequest, error) {
+	converse := converseRequest{}
+
+	for _, message := range completion.Messages {
+		if message.Role == openai.ChatMessageRoleSystem {
+			converse.System = append(converse.System, converseBlock{Text: message.Content})
+
+			if t.cacheControl && len(converse.System) == 1 {
+				converse.System = append(converse.System, converseBlock{CachePoint: &converseCachePoint{Type: "default"}})
+			}
+
+			continue
+		}
+
+		blocks := []converseBlock{}
+		if message.Content != "" {
+			blocks = append(blocks, converseBlock{Text: message.Content})
+		}
+
+		for _, part := range message.MultiContent {
+			if part.ImageURL == nil {
+				blocks = append(blocks, converseBlock{Text: part.Text})
+				continue
+			}
+
+			mediaType, encoded, ok := strings.Cut(strings.TrimPrefix(part.ImageURL.URL, "data:"), ";base64,")
+			if !ok {
+				return converse, errors.New("failed to send image to Bedrock: it is not a data URL")
+			}
+
+			image := &converseImage{Format: strings.TrimPrefix(mediaType, "image/")}
+			image.Source.Bytes = encoded
+
+			blocks = append(blocks, converseBlock{Image: image})
+		}
+
+		converse.Messages = append(converse.Messages, converseMessage{Role: message.Role, Content: blocks})
+	}
+
+	if 0 < completion.MaxTokens || completion.Temperature != 0 {
+		converse.InferenceConfig = &converseInferenceConfig{
+			MaxTokens:   completion.MaxTokens,
+			Temperature: completion.Temperature,
+		}
+	}
+
+	return converse, nil
+}
+
+// jsonObject cuts the JSON object out of a reply, as the Converse API has no
+// JSON mode and models may wrap the object in a code fence.
+func jsonObject(text string) string {
+	start, end := strings.Index(text, "{"), strings.LastIndex(text, "}")
+	if start < 0 || end < start {
+		return text
+	}
+
+	return text[start : end+1]
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+type BenchCmd struct {
+	Models    []string          `help:"image models to benchmark" required:""`
+	Filenames []string          `arg:"" help:"sample PDFs to convert with each model" type:"existingfile"`
+	Price     map[string]string `help:"price per million prompt and completion tokens of a model, e.g. gpt-4o=2.50/10.00"`
+
+	RenameFlags `embed:""`
+}
+
+// Run converts the sample documents to markdown with each model and prints
+// the latency, tokens, and cost per page. Nothing is cached or renamed.
+func (c *BenchCmd) Run() error {
+	prices, err := parsePrices(c.Price)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	client := c.client()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "model\tdocuments\tpages\tfailed\tseconds/page\ttokens/page\tcost/page")
+
+	for _, model := range c.Models {
+		flags := c.RenameFlags
+		flags.ImageModel = model
+
+		usage := documentUsage{}
+		failed := 0
+
+		var duration time.Duration
+
+		for _, filename := range c.Filenames {
+			start := time.Now()
+
+			_, err := flags.markdown(withUsage(ctx, usage), client, filename)
+			duration += time.Since(start)
+
+			if err != nil {
+				failed++
+				fmt.Fprintf(os.Stderr, "%s: %s: %v\n", model, filename, err)
+			}
+		}
+
+		// each request converts a page
+		tokens := usage[model]
+		pages := max(tokens.Requests, 1)
+
+		cost := "unknown"
+		if price, ok := priceOf(prices, model); ok {
+			cost = fmt.Sprintf("$%.5f", price.cost(tokens)/float64(pages))
+		}
+
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%.2f\t%d\t%s\n",
+			model,
+			len(c.Filenames),
+			tokens.Requests,
+			failed,
+			duration.Seconds()/float64(pages),
+			(tokens.Prompt+tokens.Completion)/pages,
+			cost,
+		)
+	}
+
+	return w.Flush()
+}
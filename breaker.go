@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// maxCooldown caps the exponential cool-down of the circuit breaker.
+const maxCooldown = 10 * time.Minute
+
+// providerBreaker is shared by every worker, so that an outage pauses all of
+// them.
+var providerBreaker = &circuitBreaker{}
+
+// circuitBreaker pauses requests to the provider after consecutive failures,
+// doubling the cool-down each time a request after it fails again.
+type circuitBreaker struct {
+	mu       sync.Mutex
+	failures int
+	trips    int
+	until    time.Time
+}
+
+// wait blocks while the breaker is open.
+func (b *circuitBreaker) wait(ctx context.Context) error {
+	b.mu.Lock()
+	delay := time.Until(b.until)
+	b.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(delay):
+		return nil
+	}
+}
+
+// result records the outcome of a request, opening the breaker once the
+// threshold of consecutive provider failures is reached. A threshold of zero
+// never opens it.
+func (b *circuitBreaker) result(err error, threshold int, cooldown time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err == nil {
+		if 0 < b.trips {
+			slog.Info("breaker.close", "trips", b.trips)
+		}
+
+		b.failures, b.trips = 0, 0
+		return
+	}
+
+	if threshold <= 0 || failureKind(err) != failureProvider {
+		return
+	}
+
+	b.failures++
+	if b.failures < threshold {
+		return
+	}
+
+	delay := min(cooldown<<b.trips, maxCooldown)
+	b.trips++
+	b.until = time.Now().Add(delay)
+	// the request after the cool-down decides whether to open it again
+	b.failures = threshold - 1
+
+	slog.Warn("breaker.open", "failures", threshold, "trips", b.trips, "cooldown", delay, "error", err)
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// cachedMarkdown converts the PDF to markdown, reusing the markdown of an
+// earlier conversion of the same document with the same image model and page
+// range when a cache directory is set.
+func (c *RenameFlags) cachedMarkdown(ctx context.Context, client *openai.Client, source string) (string, error) {
+	if c.CacheDir == "" {
+		return c.markdown(ctx, client, source)
+	}
+
+	key, err := c.cacheKey(source)
+	if err != nil {
+		return "", err
+	}
+
+	filename := filepath.Join(c.CacheDir, key+".md")
+
+	contents, err := os.ReadFile(filename)
+	if err == nil {
+		slog.Info("cache.hit", "source", source, "filename", filename)
+		return string(contents), nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("failed to read cached markdown: %w", err)
+	}
+
+	markdown, err := c.markdown(ctx, client, source)
+	if err != nil {
+		return "", err
+	}
+
+	err = os.MkdirAll(c.CacheDir, 0o700)
+	if err != nil {
+		return "", fmt.Errorf("failed to create cache directory: %w", err)
+	}
+
+	// written under a temporary name, so a concurrent run never reads a
+	// partial file
+	err = writeFile(filename, 0o600, false, func(file io.Writer) error {
+		_, err := io.WriteString(file, markdown)
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to cache markdown: %w", err)
+	}
+
+	return markdown, nil
+}
+
+// cacheKey hashes the document's contents with the options that change its
+// markdown.
+func (c *RenameFlags) cacheKey(source string) (string, error) {
+	file, err := os.Open(source)
+	if err != nil {
+		return "", fmt.Errorf("failed to open PDF: %w", err)
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+
+	_, err = io.Copy(hash, file)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash PDF: %w", err)
+	}
+
+	fmt.Fprintf(hash, "\x00%s\x00%s", c.ImageModel, c.PageRange)
+
+	// earlier keys stay the same without language hints
+	if 0 < len(c.OCRLanguages) {
+		fmt.Fprintf(hash, "\x00%s", strings.Join(c.OCRLanguages, ","))
+	}
+
+	// earlier keys stay the same with the default cap
+	if c.MaxPages != 100 {
+		fmt.Fprintf(hash, "\x00%d", c.MaxPages)
+	}
+
+	if c.Hybrid {
+		fmt.Fprint(hash, "\x00hybrid")
+	}
+
+	if c.NoVision {
+		fmt.Fprint(hash, "\x00no-vision")
+	}
+
+	// pages matching --skip-page are left out of the markdown
+	for _, pattern := range c.SkipPage {
+		fmt.Fprintf(hash, "\x00skip=%s", pattern.String())
+	}
+
+	// escalated pages are converted again by another model
+	if c.EscalateModel != "" {
+		fmt.Fprintf(hash, "\x00escalate=%s,%d", c.EscalateModel, c.EscalateBelow)
+	}
+
+	if !c.PageRegion.whole() {
+		fmt.Fprintf(hash, "\x00region=%s", c.PageRegion.name)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// cachedAnalysis analyzes the document, reusing the analysis of an earlier
+// dry run with the same options when a cache directory is set, so the names
+// it proposed are applied without querying the provider again.
+func (c *RenameFlags) cachedAnalysis(ctx context.Context, source string) (*analysis, error) {
+	if c.CacheDir == "" {
+		return c.analyze(ctx, source)
+	}
+
+	key, err := c.analysisKey(source)
+	if err != nil {
+		return nil, err
+	}
+
+	filename := filepath.Join(c.CacheDir, key+".json")
+
+	if !c.DryRun {
+		contents, err := os.ReadFile(filename)
+		if err == nil {
+			cached := &analysis{}
+
+			err = json.Unmarshal(contents, cached)
+			if err != nil {
+				return nil, fmt.Errorf("failed to unmarshal cached analysis: %w", err)
+			}
+
+			cached.template, err = c.parseTemplate()
+			if err != nil {
+				return nil, templateError{err}
+			}
+
+			slog.Info("cache.analysis", "source", source, "filename", filename)
+
+			return cached, nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("failed to read cached analysis: %w", err)
+		}
+	}
+
+	analyzed, err := c.analyze(ctx, source)
+	if err != nil || !c.DryRun {
+		return analyzed, err
+	}
+
+	contents, err := json.Marshal(analyzed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal analysis: %w", err)
+	}
+
+	err = os.MkdirAll(c.CacheDir, 0o700)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+
+	err = writeFile(filename, 0o600, false, func(file io.Writer) error {
+		_, err := file.Write(contents)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to cache analysis: %w", err)
+	}
+
+	return analyzed, nil
+}
+
+// analysisKey hashes the document's contents with every option, apart from
+// --dry-run, so an analysis is only reused by the same command.
+func (c *RenameFlags) analysisKey(source string) (string, error) {
+	key, err := c.cacheKey(source)
+	if err != nil {
+		return "", err
+	}
+
+	flags := *c
+	flags.DryRun = false
+
+	options, err := json.Marshal(flags)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal options: %w", err)
+	}
+
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s\x00%s\x00%s", key, options, c.originalName)
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
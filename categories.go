@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// classify replaces the extracted category with the matching one of
+// --categories, so free-text categories do not drift. A category that matches
+// none is an error, rather than filing the document into a new folder.
+func (c *RenameFlags) classify(values map[string]string) error {
+	if len(c.Categories) == 0 {
+		return nil
+	}
+
+	extracted := strings.TrimSpace(values["Category"])
+
+	best, bestScore := "", 0.0
+	for _, category := range c.Categories {
+		score := similarity(normalizeName(extracted), normalizeName(category))
+		if score > bestScore {
+			best, bestScore = category, score
+		}
+	}
+
+	if best == "" || bestScore < c.MatchThreshold {
+		return fmt.Errorf("category %q is not one of %s", extracted, strings.Join(c.Categories, ", "))
+	}
+
+	if best != extracted {
+		slog.Info("classify", "extracted", extracted, "category", best)
+	}
+
+	values["Category"] = best
+
+	return nil
+}
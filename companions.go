@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// companions returns the files next to the document that share its base
+// name, such as scan001.xml and scan001.jpg from a scanner for scan001.pdf.
+// Other PDFs, such as scan001.1.pdf, are documents of their own, and the files
+// named after the whole document, such as its scan001.pdf.lock marker or
+// scan001.pdf.error.json record, belong to pdfrenamer.
+func companions(source string) ([]string, error) {
+	dir := filepath.Dir(source)
+	base := filepath.Base(source)
+	stem := strings.TrimSuffix(base, filepath.Ext(base))
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list companion files: %w", err)
+	}
+
+	found := []string{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if name == base || entry.IsDir() || !strings.HasPrefix(name, stem+".") {
+			continue
+		}
+
+		if strings.EqualFold(filepath.Ext(name), ".pdf") || strings.HasPrefix(name, base+".") {
+			continue
+		}
+
+		found = append(found, filepath.Join(dir, name))
+	}
+
+	return found, nil
+}
+
+// moveCompanions renames the companion files of a document after it, keeping
+// what follows the shared base name, and returns their new filenames.
+func (c *RenameFlags) moveCompanions(source, filename string, companions []string) ([]string, error) {
+	oldStem := strings.TrimSuffix(filepath.Base(source), filepath.Ext(source))
+	newStem := strings.TrimSuffix(filename, filepath.Ext(filename))
+
+	moved := []string{}
+
+	for _, companion := range companions {
+		renamed := newStem + strings.TrimPrefix(filepath.Base(companion), oldStem)
+
+		err := c.move(companion, renamed)
+		if err != nil {
+			return moved, fmt.Errorf("failed to rename companion file: %w", err)
+		}
+
+		slog.Info("companion", "source", companion, "filename", renamed)
+
+		moved = append(moved, renamed)
+	}
+
+	return moved, nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+type CompareCmd struct {
+	Models   []string `help:"models to compare, each used for both the image and text requests" required:""`
+	Filename string   `arg:"" help:"PDF to extract with each model" type:"existingfile"`
+
+	RenameFlags `embed:""`
+}
+
+type comparison struct {
+	model    string
+	name     string
+	values   map[string]string
+	tokens   int
+	duration time.Duration
+	err      error
+}
+
+// Run extracts the document with each model and prints the proposed names and
+// fields side by side, marking the rows where the models disagree. Nothing is
+// renamed.
+func (c *CompareCmd) Run() error {
+	ctx := context.Background()
+	results := []comparison{}
+
+	for _, model := range c.Models {
+		results = append(results, c.compare(ctx, model))
+	}
+
+	fields := map[string]struct{}{}
+	for _, result := range results {
+		for field := range result.values {
+			fields[field] = struct{}{}
+		}
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+
+	row := func(label string, value func(comparison) string) {
+		values := []string{}
+		for _, result := range results {
+			values = append(values, value(result))
+		}
+
+		marker := " "
+		if slices.ContainsFunc(values, func(v string) bool { return v != values[0] }) {
+			marker = "*"
+		}
+
+		fmt.Fprintf(w, "%s %s\t%s\n", marker, label, strings.Join(values, "\t"))
+	}
+
+	fmt.Fprintf(w, "  \t%s\n", strings.Join(c.Models, "\t"))
+
+	row("name", func(result comparison) string {
+		if result.err != nil {
+			return "error: " + result.err.Error()
+		}
+
+		return result.name
+	})
+
+	for _, field := range slices.Sorted(maps.Keys(fields)) {
+		row(field, func(result comparison) string { return result.values[field] })
+	}
+
+	row("tokens", func(result comparison) string { return fmt.Sprint(result.tokens) })
+
+	// durations always differ, so they are not marked
+	durations := []string{}
+	for _, result := range results {
+		durations = append(durations, result.duration.Round(time.Millisecond).String())
+	}
+
+	fmt.Fprintf(w, "  duration\t%s\n", strings.Join(durations, "\t"))
+
+	return w.Flush()
+}
+
+func (c *CompareCmd) compare(ctx context.Context, model string) comparison {
+	flags := c.RenameFlags
+	flags.ImageModel = model
+	flags.TextModel = model
+
+	usage := documentUsage{}
+	result := comparison{model: model}
+	start := time.Now()
+
+	analysis, err := flags.analyze(withUsage(ctx, usage), c.Filename)
+	result.duration = time.Since(start)
+
+	for _, tokens := range usage {
+		result.tokens += tokens.Prompt + tokens.Completion
+	}
+
+	if err != nil {
+		result.err = err
+		return result
+	}
+
+	result.values = analysis.Values
+
+	result.err = analysis.template.clean(analysis.Values)
+	if result.err != nil {
+		return result
+	}
+
+	result.name, result.err = analysis.template.render(analysis.Values)
+
+	return result
+}
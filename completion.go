@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// complete sends a chat completion request for a stage of the pipeline.
+func (c *RenameFlags) complete(ctx context.Context, client *openai.Client, stage string, request openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	response := openai.ChatCompletionResponse{}
+
+	err := c.callProvider(ctx, stage, request.Model, func(ctx context.Context, _ *span) (openai.Usage, error) {
+		var err error
+
+		response, err = client.CreateChatCompletion(ctx, request)
+		if err == nil && len(response.Choices) == 0 {
+			err = errors.New("provider returned no choices")
+		}
+		if err == nil && response.Usage.TotalTokens == 0 && 0 < c.TokensPerMinute {
+			missingUsage.Do(func() {
+				slog.Warn("provider.usage.missing", "model", request.Model)
+			})
+		}
+
+		return response.Usage, err
+	})
+
+	return response, err
+}
+
+// callProvider makes a request to the provider for a stage of the pipeline,
+// within the rate limits and once the provider is not failing, recording its
+// latency and token usage. Every request to the provider, whichever API it
+// uses, goes through it.
+func (c *RenameFlags) callProvider(ctx context.Context, stage, model string, call func(context.Context, *span) (openai.Usage, error)) error {
+	ctx, span := startSpan(ctx, "completion", "stage", stage, "model", model)
+
+	err := providerBreaker.wait(ctx)
+	if err != nil {
+		span.finish(err)
+		return fmt.Errorf("failed to wait for provider: %w", err)
+	}
+
+	err = providerLimiter.wait(ctx, c.RequestsPerMinute, c.TokensPerMinute)
+	if err != nil {
+		span.finish(err)
+		return fmt.Errorf("failed to wait for rate limit: %w", err)
+	}
+
+	start := time.Now()
+
+	usage, err := call(ctx, span)
+
+	providerLimiter.use(usage.TotalTokens)
+	providerBreaker.result(err, c.BreakerThreshold, c.BreakerCooldown)
+	metrics.completion(stage, model, time.Since(start), usage, err)
+	addUsage(ctx, model, usage.PromptTokens, usage.CompletionTokens)
+	span.set("prompt_tokens", usage.PromptTokens, "completion_tokens", usage.CompletionTokens, "cached_tokens", cachedTokens(usage))
+	span.finish(err)
+
+	return err
+}
+
+// missingUsage warns once of a provider that reports no token usage, which
+// --tpm then cannot count.
+var missingUsage sync.Once
+
+// cachedTokens is the number of prompt tokens the provider read from its
+// prompt cache, which are billed at a discount.
+func cachedTokens(usage openai.Usage) int {
+	if usage.PromptTokensDetails == nil {
+		return 0
+	}
+
+	return usage.PromptTokensDetails.CachedTokens
+}
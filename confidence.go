@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// confidenceField is the field the text model reports its confidence in, for
+// --auto-threshold.
+const confidenceField = "Confidence"
+
+// reviewable is an error for a document that is left for review instead of
+// renamed, such as one below --auto-threshold.
+type reviewable interface {
+	error
+	// proposed returns the rename that was proposed for the document.
+	proposed() (filename string, values map[string]string)
+}
+
+// lowConfidenceError is returned for a document whose values the text model
+// is not confident enough in to rename it automatically. It holds the rename
+// that was proposed, for reviewing it.
+type lowConfidenceError struct {
+	confidence, threshold float64
+
+	filename string
+	values   map[string]string
+}
+
+func (e lowConfidenceError) Error() string {
+	return fmt.Sprintf("confidence %.2f is below --auto-threshold %.2f, leaving %q for review", e.confidence, e.threshold, e.filename)
+}
+
+func (e lowConfidenceError) proposed() (string, map[string]string) {
+	return e.filename, e.values
+}
+
+// confidence parses the confidence reported with the values, from 0 to 1. A
+// missing or unreadable confidence is 0, so the document is reviewed.
+func confidence(values map[string]string) float64 {
+	value := strings.TrimSpace(values[confidenceField])
+	percent := strings.HasSuffix(value, "%")
+
+	confidence, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(value, "%")), 64)
+	if err != nil {
+		return 0
+	}
+
+	if percent || 1 < confidence {
+		confidence /= 100
+	}
+
+	return min(max(confidence, 0), 1)
+}
+
+// checkConfidence returns a lowConfidenceError for a planned rename below
+// --auto-threshold.
+func (c *RenameFlags) checkConfidence(plan *plannedRename) error {
+	if c.AutoThreshold <= 0 {
+		return nil
+	}
+
+	confidence := confidence(plan.Values)
+	if c.AutoThreshold <= confidence {
+		return nil
+	}
+
+	return lowConfidenceError{
+		confidence: confidence,
+		threshold:  c.AutoThreshold,
+		filename:   plan.Filename,
+		values:     plan.Values,
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// correction is a name the user changed before a document was renamed, kept
+// as an example for later extractions.
+type correction struct {
+	Time      time.Time         `json:"time"`
+	Source    string            `json:"source"`
+	Proposed  string            `json:"proposed"`
+	Corrected string            `json:"corrected"`
+	Values    map[string]string `json:"values,omitempty"`
+}
+
+func (c *RenameFlags) correctionsPath() (string, error) {
+	if c.CorrectionsFile != "" {
+		return c.CorrectionsFile, nil
+	}
+
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find config directory: %w", err)
+	}
+
+	return filepath.Join(dir, "pdfrenamer", "corrections.jsonl"), nil
+}
+
+// correctionsMu serializes appends of corrections.
+var correctionsMu sync.Mutex
+
+// recordCorrection appends the change the user made to the proposed name of
+// the planned document. Names are kept relative to their common directory, so
+// the examples show the format rather than where the documents are.
+func (c *RenameFlags) recordCorrection(plan *plannedRename) error {
+	path, err := c.correctionsPath()
+	if err != nil {
+		return err
+	}
+
+	proposed, corrected := plan.Proposed, plan.Filename
+	if filepath.Dir(proposed) == filepath.Dir(corrected) {
+		proposed, corrected = filepath.Base(proposed), filepath.Base(corrected)
+	}
+
+	payload, err := json.Marshal(correction{
+		Time:      time.Now(),
+		Source:    filepath.Base(plan.Source),
+		Proposed:  proposed,
+		Corrected: corrected,
+		Values:    plan.Values,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal correction: %w", err)
+	}
+
+	correctionsMu.Lock()
+	defer correctionsMu.Unlock()
+
+	err = os.MkdirAll(filepath.Dir(path), 0o755)
+	if err != nil {
+		return fmt.Errorf("failed to create corrections directory: %w", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open corrections: %w", err)
+	}
+	defer file.Close()
+
+	_, err = file.Write(append(payload, '\n'))
+	if err != nil {
+		return fmt.Errorf("failed to write corrections: %w", err)
+	}
+
+	return file.Sync()
+}
+
+// recentCorrections returns the last corrections, up to the limit.
+func recentCorrections(path string, limit int) ([]correction, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open corrections: %w", err)
+	}
+	defer file.Close()
+
+	corrections := []correction{}
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1024*1024)
+
+	for scanner.Scan() {
+		var entry correction
+
+		// a damaged line only loses that example
+		if json.Unmarshal(scanner.Bytes(), &entry) != nil {
+			continue
+		}
+
+		corrections = append(corrections, entry)
+		if limit < len(corrections) {
+			corrections = corrections[1:]
+		}
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read corrections: %w", err)
+	}
+
+	return corrections, nil
+}
+
+// correctionsPrompt lists the recent corrections as examples of the names the
+// user wants. Corrections that cannot be read are logged and left out, as the
+// extraction works without them.
+func (c *RenameFlags) correctionsPrompt() string {
+	if c.Corrections <= 0 {
+		return ""
+	}
+
+	path, err := c.correctionsPath()
+	if err != nil {
+		slog.Warn("corrections.load", "error", err)
+		return ""
+	}
+
+	corrections, err := recentCorrections(path, c.Corrections)
+	if err != nil {
+		slog.Warn("corrections.load", "path", path, "error", err)
+		return ""
+	}
+
+	if len(corrections) == 0 {
+		return ""
+	}
+
+	prompt := &strings.Builder{}
+	prompt.WriteString("The user corrected the names proposed for earlier documents, as proposed -> corrected. Extract values that follow the conventions these show, such as how names are spelled or abbreviated:\n")
+
+	for _, correction := range corrections {
+		fmt.Fprintf(prompt, "   - '%s' -> '%s'\n", correction.Proposed, correction.Corrected)
+	}
+
+	return prompt.String()
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+)
+
+// notifySystemd sends a state, such as "READY=1", to systemd when it started
+// the process as a Type=notify service, and does nothing otherwise.
+func notifySystemd(state string) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		slog.Warn("systemd.notify", "state", state, "error", err)
+		return
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte(state))
+	if err != nil {
+		slog.Warn("systemd.notify", "state", state, "error", err)
+	}
+}
+
+// writePidFile writes the ID of the process to the file, returning a function
+// that removes it again.
+func writePidFile(filename string) (func(), error) {
+	err := writeFile(filename, 0o644, false, func(w io.Writer) error {
+		_, err := io.WriteString(w, strconv.Itoa(os.Getpid())+"\n")
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to write PID file: %w", err)
+	}
+
+	return func() { _ = os.Remove(filename) }, nil
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// dateLayouts are the formats an extracted date is tried against, in order,
+// after the numeric layouts of the date order.
+var dateLayouts = []string{
+	"2006-01-02",
+	"2006/01/02",
+	"2006.01.02",
+	"20060102",
+	"02.01.2006",
+	"2.1.2006",
+	"January 2, 2006",
+	"Jan 2, 2006",
+	"2 January 2006",
+	"2 Jan 2006",
+	"January 2006",
+	"Jan 2006",
+	"2006-01",
+	time.RFC3339,
+}
+
+// numericDateLayouts are the layouts of dates such as 03/04/2024, which are
+// the 4th of March in the US and the 3rd of April in most of Europe.
+var numericDateLayouts = map[string][]string{
+	"mdy": {"01/02/2006", "1/2/2006", "01-02-2006", "1-2-2006"},
+	"dmy": {"02/01/2006", "2/1/2006", "02-01-2006", "2-1-2006"},
+}
+
+// dateParser parses the dates extracted from documents, reading numeric
+// dates in its order of day and month, in its time zone.
+type dateParser struct {
+	layouts  []string
+	location *time.Location
+}
+
+// dates returns the date parser for --date-order and --time-zone.
+func (f *TemplateFlags) dates() (*dateParser, error) {
+	numeric, ok := numericDateLayouts[f.DateOrder]
+	if !ok {
+		return nil, fmt.Errorf("date order must be mdy or dmy, got %q", f.DateOrder)
+	}
+
+	location := time.Local
+	if f.TimeZone != "" {
+		var err error
+
+		location, err = time.LoadLocation(f.TimeZone)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load time zone: %w", err)
+		}
+	}
+
+	return &dateParser{
+		layouts:  append(slices.Clone(numeric), dateLayouts...),
+		location: location,
+	}, nil
+}
+
+// parse parses a date extracted from a document. Dates with a time zone of
+// their own, such as RFC 3339 timestamps, are converted to the parser's.
+func (p *dateParser) parse(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+
+	for _, layout := range p.layouts {
+		date, err := time.ParseInLocation(layout, value, p.location)
+		if err == nil {
+			return date.In(p.location), nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("unrecognized date %q", value)
+}
+
+// dateFuncs are template functions that file documents by the parts of an
+// extracted date, with fiscal years starting in fiscalStart (1 to 12).
+func dateFuncs(dates *dateParser, fiscalStart int) map[string]any {
+	return map[string]any{
+		"yearOf": func(value string) (string, error) {
+			date, err := dates.parse(value)
+			if err != nil {
+				return "", err
+			}
+
+			return date.Format("2006"), nil
+		},
+		"monthOf": func(value string) (string, error) {
+			date, err := dates.parse(value)
+			if err != nil {
+				return "", err
+			}
+
+			return date.Format("01"), nil
+		},
+		"quarterOf": func(value string) (string, error) {
+			date, err := dates.parse(value)
+			if err != nil {
+				return "", err
+			}
+
+			return fmt.Sprintf("Q%d", (int(date.Month())+2)/3), nil
+		},
+		// a fiscal year is named after the calendar year it ends in
+		"fiscalYearOf": func(value string) (string, error) {
+			date, err := dates.parse(value)
+			if err != nil {
+				return "", err
+			}
+
+			year := date.Year()
+			if fiscalStart > 1 && int(date.Month()) >= fiscalStart {
+				year++
+			}
+
+			return fmt.Sprintf("%d", year), nil
+		},
+		// a period covering several months, such as a quarterly statement, is
+		// rendered as its first and last month, 2024-01..2024-03
+		"period": func(start, end string) (string, error) {
+			startDate, err := dates.parse(start)
+			if err != nil {
+				return "", err
+			}
+
+			endDate, err := dates.parse(end)
+			if err != nil {
+				return "", err
+			}
+
+			if endDate.Before(startDate) {
+				startDate, endDate = endDate, startDate
+			}
+
+			if startDate.Format("2006-01") == endDate.Format("2006-01") {
+				return startDate.Format("2006-01"), nil
+			}
+
+			return startDate.Format("2006-01") + ".." + endDate.Format("2006-01"), nil
+		},
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"math/bits"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gen2brain/go-fitz"
+)
+
+const (
+	// hashDPI renders pages for hashing them, which needs little detail.
+	hashDPI = 24
+	// duplicateDistance is the most bits of 256 two pages' hashes can differ
+	// by to be the same sheet, such as when a scanner feeds it twice.
+	duplicateDistance = 6
+
+	// compareDPI renders pages whose hashes match for comparing them pixel
+	// by pixel, in enough detail to tell apart the text of pages with the
+	// same layout, such as two invoices from one vendor.
+	compareDPI = 72
+	// pixelTolerance is how much the gray of a pixel, from 0 to 255, may
+	// differ between two pages for it to be the same, allowing for noise.
+	pixelTolerance = 48
+	// differentPixels is the most pixels per 10,000 that may differ between
+	// two pages for them to be the same.
+	differentPixels = 10
+)
+
+// pageHash is a difference hash of a page: whether each cell of a 17x16 grid
+// of its grayscale is brighter than the next cell in its row. Scans of the
+// same sheet hash alike despite noise and slight shifts.
+type pageHash [4]uint64
+
+func hashPage(doc *fitz.Document, n int) (pageHash, error) {
+	var hash pageHash
+
+	image, err := doc.ImageDPI(n, hashDPI)
+	if err != nil {
+		return hash, fmt.Errorf("failed to convert page #%d to image: %w", n, err)
+	}
+
+	const width, height = 17, 16
+
+	bounds := image.Bounds()
+	if bounds.Dx() < width || bounds.Dy() < height {
+		return hash, fmt.Errorf("page #%d is too small to compare", n)
+	}
+
+	// the average gray of each cell of the grid
+	grid := [height][width]uint64{}
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		row := (y - bounds.Min.Y) * height / bounds.Dy()
+
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			column := (x - bounds.Min.X) * width / bounds.Dx()
+
+			pixel := image.Pix[image.PixOffset(x, y):]
+			grid[row][column] += 299*uint64(pixel[0]) + 587*uint64(pixel[1]) + 114*uint64(pixel[2])
+		}
+	}
+
+	bit := 0
+	for row := range height {
+		for column := range width - 1 {
+			if grid[row][column] < grid[row][column+1] {
+				hash[bit/64] |= 1 << (bit % 64)
+			}
+
+			bit++
+		}
+	}
+
+	return hash, nil
+}
+
+// samePixels compares two pages pixel by pixel, confirming that pages with
+// the same hash are the same sheet rather than pages that only share a
+// layout.
+func samePixels(doc *fitz.Document, a, b int) (bool, error) {
+	first, err := doc.ImageDPI(a, compareDPI)
+	if err != nil {
+		return false, fmt.Errorf("failed to convert page #%d to image: %w", a, err)
+	}
+
+	second, err := doc.ImageDPI(b, compareDPI)
+	if err != nil {
+		return false, fmt.Errorf("failed to convert page #%d to image: %w", b, err)
+	}
+
+	bounds := first.Bounds()
+	if bounds.Size() != second.Bounds().Size() {
+		return false, nil
+	}
+
+	gray := func(pixel []uint8) int {
+		return (299*int(pixel[0]) + 587*int(pixel[1]) + 114*int(pixel[2])) / 1000
+	}
+
+	offset := second.Bounds().Min.Sub(bounds.Min)
+	different := 0
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			difference := gray(first.Pix[first.PixOffset(x, y):]) - gray(second.Pix[second.PixOffset(x+offset.X, y+offset.Y):])
+			if pixelTolerance < max(difference, -difference) {
+				different++
+			}
+		}
+	}
+
+	return different*10_000 <= bounds.Dx()*bounds.Dy()*differentPixels, nil
+}
+
+func (h pageHash) distance(other pageHash) int {
+	distance := 0
+	for i := range h {
+		distance += bits.OnesCount64(h[i] ^ other[i])
+	}
+
+	return distance
+}
+
+// duplicatePages tracks the previous page of a document, to find the pages
+// that repeat it.
+type duplicatePages struct {
+	previous *pageHash
+	page     int
+}
+
+// duplicate reports whether the page is the same as the page before it:
+// their hashes are alike, and their pixels are too. A page that cannot be
+// hashed or compared is never a duplicate.
+func (d *duplicatePages) duplicate(doc *fitz.Document, n int) bool {
+	hash, err := hashPage(doc, n)
+	if err != nil {
+		slog.Warn("pdf.hash", "page", n, "error", err)
+		d.previous = nil
+
+		return false
+	}
+
+	previous, page := d.previous, d.page
+	d.previous, d.page = &hash, n
+
+	if previous == nil || duplicateDistance < hash.distance(*previous) {
+		return false
+	}
+
+	same, err := samePixels(doc, page, n)
+	if err != nil {
+		slog.Warn("pdf.compare", "page", n, "error", err)
+		return false
+	}
+
+	return same
+}
+
+// dedupePages rewrites the PDF without the pages that repeat the page before
+// them, with qpdf, since fitz cannot write PDFs. It returns the numbers of the
+// pages removed, counting from 1.
+func dedupePages(filename string) ([]int, error) {
+	path, err := exec.LookPath("qpdf")
+	if err != nil {
+		return nil, fmt.Errorf("failed to find qpdf to remove duplicate pages: %w", err)
+	}
+
+	doc, err := openPDF(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open PDF: %w", err)
+	}
+
+	pages := doc.NumPage()
+	duplicates := &duplicatePages{}
+	keep, removed := []string{}, []int{}
+
+	for n := range pages {
+		if duplicates.duplicate(doc, n) {
+			removed = append(removed, n+1)
+			continue
+		}
+
+		keep = append(keep, strconv.Itoa(n+1))
+	}
+
+	_ = doc.Close()
+
+	if len(removed) == 0 {
+		return nil, nil
+	}
+
+	info, err := os.Stat(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat PDF: %w", err)
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(filename), ".dedupe-*.pdf")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create deduplicated PDF: %w", err)
+	}
+	_ = temp.Close()
+	defer func() { _ = os.Remove(temp.Name()) }()
+
+	stderr := &bytes.Buffer{}
+
+	cmd := exec.Command(path, "--warning-exit-0", filename, "--pages", ".", strings.Join(keep, ","), "--", temp.Name())
+	cmd.Stderr = stderr
+
+	err = cmd.Run()
+	if err != nil {
+		return nil, fmt.Errorf("failed to remove duplicate pages: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	err = syncFile(temp.Name(), info.Mode().Perm())
+	if err != nil {
+		return nil, fmt.Errorf("failed to write deduplicated PDF: %w", err)
+	}
+
+	err = os.Rename(temp.Name(), filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write deduplicated PDF: %w", err)
+	}
+
+	syncDir(filepath.Dir(filename))
+
+	return removed, nil
+}
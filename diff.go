@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+)
+
+// proposedRename is a rename printed at the end of a dry run.
+type proposedRename struct {
+	source, filename string
+}
+
+// printDiff writes the renames proposed by a dry run, as an aligned table of
+// the old and new names, or as a shell script of mv commands.
+func (c *RenameCmd) printDiff(w io.Writer) error {
+	if c.DiffFormat == "rename-script" {
+		return renameScript(w, c.proposed)
+	}
+
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "OLD\t\tNEW")
+
+	for _, proposed := range c.proposed {
+		source, filename := displayPath(proposed.source), displayPath(proposed.filename)
+		if isRemote(proposed.source) {
+			source = redactURI(proposed.source)
+		}
+
+		if filepath.Clean(source) == filepath.Clean(filename) {
+			filename = "(unchanged)"
+		}
+
+		fmt.Fprintf(table, "%s\t→\t%s\n", source, filename)
+	}
+
+	return table.Flush()
+}
+
+// renameScript writes a POSIX shell script that renames the documents, without
+// overwriting existing files. Remote documents are left as comments, as they
+// cannot be moved with mv.
+func renameScript(w io.Writer, renames []proposedRename) error {
+	script := &strings.Builder{}
+	script.WriteString("#!/bin/sh\nset -eu\n\n")
+
+	for _, proposed := range renames {
+		if isRemote(proposed.source) || isRemote(proposed.filename) {
+			fmt.Fprintf(script, "# %s -> %s\n", redactURI(proposed.source), redactURI(proposed.filename))
+			continue
+		}
+
+		if filepath.Clean(proposed.source) == filepath.Clean(proposed.filename) {
+			continue
+		}
+
+		if dir := filepath.Dir(proposed.filename); dir != filepath.Dir(proposed.source) {
+			fmt.Fprintf(script, "mkdir -p -- %s\n", shellQuote(dir))
+		}
+
+		fmt.Fprintf(script, "mv -n -- %s %s\n", shellQuote(proposed.source), shellQuote(proposed.filename))
+	}
+
+	_, err := io.WriteString(w, script.String())
+
+	return err
+}
+
+// shellQuote quotes a value for a POSIX shell, in single quotes.
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// The fields of the date a document was issued and the date it was scanned,
+// which are extracted apart as the text model often takes a scanner's or a
+// receipt's stamp for the document's date.
+const (
+	docDateField  = "DocDate"
+	scanDateField = "ScanDate"
+)
+
+// usesDocDates reports whether the format references the document or scan
+// date, which are then extracted together.
+func (c *RenameFlags) usesDocDates() bool {
+	return strings.Contains(c.format(), "."+docDateField) || strings.Contains(c.format(), "."+scanDateField)
+}
+
+// checkDocDates keeps the document date only when it is plausible. A
+// document is issued before it is scanned, so dates in the wrong order are
+// swapped, and a document date on the day of the scan, or today, that is
+// not written in the document is dropped to be asked for again. The scan
+// date defaults to the file's modification date.
+func (c *RenameFlags) checkDocDates(markdown string, info documentInfo, values map[string]string) error {
+	if !c.usesDocDates() {
+		return nil
+	}
+
+	dates, err := c.dates()
+	if err != nil {
+		return err
+	}
+
+	if strings.TrimSpace(values[scanDateField]) == "" {
+		slog.Info("dates.scan", "value", info.ScanDate)
+		values[scanDateField] = info.ScanDate
+	}
+
+	docDate, err := dates.parse(values[docDateField])
+	if err != nil {
+		return nil
+	}
+
+	scanDate, err := dates.parse(values[scanDateField])
+	if err != nil {
+		return nil
+	}
+
+	if scanDate.Before(docDate) {
+		slog.Warn("dates.swap", "values", docDates(values))
+		values[docDateField], values[scanDateField] = values[scanDateField], values[docDateField]
+
+		return nil
+	}
+
+	today := time.Now().In(dates.location).Format("2006-01-02")
+	day := docDate.Format("2006-01-02")
+
+	if (day == scanDate.Format("2006-01-02") || day == info.ScanDate || day == today) && !groundedDate(groundText(markdown), docDate) {
+		slog.Warn("dates.implausible", "values", docDates(values))
+		delete(values, docDateField)
+	}
+
+	return nil
+}
+
+// fallbackDocDate files a document whose date could not be found under its
+// scan date, rather than failing it.
+func (c *RenameFlags) fallbackDocDate(values map[string]string) {
+	if !c.usesDocDates() || strings.TrimSpace(values[docDateField]) != "" {
+		return
+	}
+
+	slog.Warn("dates.fallback", "value", values[scanDateField])
+	values[docDateField] = values[scanDateField]
+}
+
+// docDates returns the document and scan dates of the values, for logging
+// them where they are redacted along with the other values.
+func docDates(values map[string]string) map[string]string {
+	return map[string]string{
+		docDateField:  values[docDateField],
+		scanDateField: values[scanDateField],
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/xml"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// crossIndustryInvoice is the UN/CEFACT XML of ZUGFeRD 2 and Factur-X
+// e-invoices. Elements are matched by their local names.
+type crossIndustryInvoice struct {
+	XMLName   xml.Name `xml:"CrossIndustryInvoice"`
+	ID        string   `xml:"ExchangedDocument>ID"`
+	IssueDate string   `xml:"ExchangedDocument>IssueDateTime>DateTimeString"`
+	Seller    string   `xml:"SupplyChainTradeTransaction>ApplicableHeaderTradeAgreement>SellerTradeParty>Name"`
+	Buyer     string   `xml:"SupplyChainTradeTransaction>ApplicableHeaderTradeAgreement>BuyerTradeParty>Name"`
+	Currency  string   `xml:"SupplyChainTradeTransaction>ApplicableHeaderTradeSettlement>InvoiceCurrencyCode"`
+	Total     string   `xml:"SupplyChainTradeTransaction>ApplicableHeaderTradeSettlement>SpecifiedTradeSettlementHeaderMonetarySummation>GrandTotalAmount"`
+}
+
+// ublInvoice is the OASIS UBL XML of XRechnung e-invoices.
+type ublInvoice struct {
+	XMLName           xml.Name `xml:"Invoice"`
+	ID                string   `xml:"ID"`
+	IssueDate         string   `xml:"IssueDate"`
+	SellerName        string   `xml:"AccountingSupplierParty>Party>PartyName>Name"`
+	SellerLegalName   string   `xml:"AccountingSupplierParty>Party>PartyLegalEntity>RegistrationName"`
+	BuyerName         string   `xml:"AccountingCustomerParty>Party>PartyName>Name"`
+	BuyerLegalName    string   `xml:"AccountingCustomerParty>Party>PartyLegalEntity>RegistrationName"`
+	Currency          string   `xml:"DocumentCurrencyCode"`
+	Total             string   `xml:"LegalMonetaryTotal>PayableAmount"`
+	TaxInclusiveTotal string   `xml:"LegalMonetaryTotal>TaxInclusiveAmount"`
+}
+
+// eInvoiceValues returns the values of the e-invoice embedded in the PDF, if
+// it has one, as the fields InvoiceNumber, Date, Vendor, Buyer, Addressee,
+// Total, Currency, and Category.
+func eInvoiceValues(filename string) (map[string]string, bool) {
+	attachments, err := pdfAttachments(filename)
+	if err != nil {
+		slog.Warn("einvoice.attachments", "filename", filename, "error", err)
+		return nil, false
+	}
+
+	for _, attachment := range attachments {
+		contents := bytes.TrimSpace(attachment.contents)
+		if !bytes.HasPrefix(contents, []byte("<")) {
+			continue
+		}
+
+		if values, ok := parseEInvoice(contents); ok {
+			slog.Info("einvoice", "filename", filename, "attachment", attachment.name)
+			return values, true
+		}
+	}
+
+	return nil, false
+}
+
+func parseEInvoice(contents []byte) (map[string]string, bool) {
+	var (
+		id, date, seller, buyer, currency, total string
+		dateLayout                               string
+	)
+
+	var cii crossIndustryInvoice
+	var ubl ublInvoice
+
+	switch {
+	case xml.Unmarshal(contents, &cii) == nil:
+		id, date, seller, buyer, currency, total = cii.ID, cii.IssueDate, cii.Seller, cii.Buyer, cii.Currency, cii.Total
+		// the date format 102 of UN/CEFACT
+		dateLayout = "20060102"
+	case xml.Unmarshal(contents, &ubl) == nil:
+		id, date, currency = ubl.ID, ubl.IssueDate, ubl.Currency
+		seller = cmp.Or(ubl.SellerLegalName, ubl.SellerName)
+		buyer = cmp.Or(ubl.BuyerLegalName, ubl.BuyerName)
+		total = cmp.Or(ubl.Total, ubl.TaxInclusiveTotal)
+		dateLayout = "2006-01-02"
+	default:
+		return nil, false
+	}
+
+	if id == "" && seller == "" && total == "" {
+		return nil, false
+	}
+
+	values := map[string]string{}
+
+	add := func(field, value string) {
+		if value = strings.TrimSpace(value); value != "" {
+			values[field] = value
+		}
+	}
+
+	add("InvoiceNumber", id)
+	add("Vendor", seller)
+	add("Buyer", buyer)
+	add("Addressee", buyer)
+	add("Total", total)
+	add("Currency", currency)
+	add("Category", "invoice")
+
+	if parsed, err := time.Parse(dateLayout, strings.TrimSpace(date)); err == nil {
+		values["Date"] = parsed.Format("2006-01-02")
+	}
+
+	return values, true
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"strings"
+)
+
+// refusals are how image models begin when they decline to transcribe a page,
+// such as one they take for an identity document.
+var refusals = []string{
+	"i'm sorry",
+	"i am sorry",
+	"i can't",
+	"i cannot",
+	"i'm unable",
+	"i am unable",
+}
+
+// escalates reports whether a page's markdown from the image model is too
+// poor to keep, so the page is converted again with --escalate-model: it has
+// fewer than --escalate-below letters and digits, or the model refused.
+func (c *RenameFlags) escalates(markdown string) bool {
+	if c.EscalateModel == "" || c.EscalateModel == c.ImageModel {
+		return false
+	}
+
+	if countText(markdown) < c.EscalateBelow {
+		return true
+	}
+
+	start := strings.ToLower(strings.TrimSpace(markdown))
+	start = strings.ReplaceAll(start, "’", "'")
+
+	for _, refusal := range refusals {
+		if strings.HasPrefix(start, refusal) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v3"
+)
+
+type EvalCmd struct {
+	Dir      string `arg:"" help:"directory of sample PDFs" type:"existingdir"`
+	Manifest string `help:"YAML manifest of the expected name and fields of each PDF (defaults to expected.yaml in the directory)" type:"path"`
+
+	RenameFlags `embed:""`
+}
+
+// expectation is the expected result for a PDF in the manifest, for example:
+//
+//	invoice.pdf:
+//	  name: Acme Invoice 2024-01-31.pdf
+//	  fields:
+//	    Vendor: Acme
+type expectation struct {
+	Name   string            `yaml:"name"`
+	Fields map[string]string `yaml:"fields"`
+}
+
+// Run renders a name for each PDF in the manifest, without renaming it, and
+// reports how many names and fields match what was expected. It fails when
+// any name differs, so that prompt and format changes can be regression
+// tested.
+func (c *EvalCmd) Run() error {
+	manifest := c.Manifest
+	if manifest == "" {
+		manifest = filepath.Join(c.Dir, "expected.yaml")
+	}
+
+	contents, err := os.ReadFile(manifest)
+	if err != nil {
+		return fmt.Errorf("failed to read manifest: %w", err)
+	}
+
+	expected := map[string]expectation{}
+
+	err = yaml.Unmarshal(contents, &expected)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal manifest: %w", err)
+	}
+
+	if len(expected) == 0 {
+		return fmt.Errorf("no documents in manifest %q: %w", manifest, errNothingToDo)
+	}
+
+	ctx := context.Background()
+
+	names := 0
+	fields := map[string][2]int{}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+
+	for _, document := range slices.Sorted(maps.Keys(expected)) {
+		expectation := expected[document]
+
+		name, values, err := c.evaluate(ctx, filepath.Join(c.Dir, document))
+		if err != nil {
+			fmt.Fprintf(w, "FAIL\t%s\terror: %v\n", document, err)
+		}
+
+		if err == nil && name == expectation.Name {
+			names++
+		} else if err == nil {
+			fmt.Fprintf(w, "FAIL\t%s\tname %q, expected %q\n", document, name, expectation.Name)
+		}
+
+		for _, field := range slices.Sorted(maps.Keys(expectation.Fields)) {
+			matched := fields[field][0]
+			if values[field] == expectation.Fields[field] {
+				matched++
+			} else if err == nil {
+				fmt.Fprintf(w, "FAIL\t%s\t%s %q, expected %q\n", document, field, values[field], expectation.Fields[field])
+			}
+
+			fields[field] = [2]int{matched, fields[field][1] + 1}
+		}
+	}
+
+	fmt.Fprintf(w, "\nnames\t%d/%d\t%.0f%%\n", names, len(expected), 100*float64(names)/float64(len(expected)))
+	for _, field := range slices.Sorted(maps.Keys(fields)) {
+		matched, total := fields[field][0], fields[field][1]
+		fmt.Fprintf(w, "%s\t%d/%d\t%.0f%%\n", field, matched, total, 100*float64(matched)/float64(total))
+	}
+
+	err = w.Flush()
+	if err != nil {
+		return err
+	}
+
+	if names < len(expected) {
+		return fmt.Errorf("%d of %d names differ from the manifest", len(expected)-names, len(expected))
+	}
+
+	return nil
+}
+
+// evaluate renders the name and extracts the values of a document, as a dry
+// run would.
+func (c *EvalCmd) evaluate(ctx context.Context, filename string) (string, map[string]string, error) {
+	analysis, err := c.analyze(ctx, filename)
+	if err != nil {
+		return "", nil, err
+	}
+
+	err = analysis.template.clean(analysis.Values)
+	if err != nil {
+		return "", analysis.Values, templateError{err}
+	}
+
+	name, err := analysis.template.render(analysis.Values)
+	if err != nil {
+		return "", analysis.Values, templateError{err}
+	}
+
+	return name, analysis.Values, nil
+}
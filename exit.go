@@ -0,0 +1,53 @@
+package main
+
+import "errors"
+
+// Exit codes, so that wrapper scripts and service managers can react to the
+// kind of failure.
+const (
+	exitFailure     = 1
+	exitNothingToDo = 3
+	exitPartial     = 4
+	exitProvider    = 5
+	exitTemplate    = 6
+	exitFilesystem  = 7
+)
+
+// errNothingToDo is returned when there were no documents to rename.
+var errNothingToDo = errors.New("nothing to do")
+
+// exitError is an error with a specific exit code.
+type exitError struct {
+	error
+	code int
+}
+
+func (e exitError) Unwrap() error {
+	return e.error
+}
+
+// exitCode returns the exit code for the error returned by a command.
+func exitCode(err error) int {
+	var exitErr exitError
+	if errors.As(err, &exitErr) {
+		return exitErr.code
+	}
+
+	if errors.Is(err, errNothingToDo) {
+		return exitNothingToDo
+	}
+
+	switch failureKind(err) {
+	case failureProvider:
+		return exitProvider
+	case failureTemplate:
+		return exitTemplate
+	case failureFilesystem:
+		return exitFilesystem
+	case failureLocked:
+		// another instance is renaming the document
+		return exitNothingToDo
+	}
+
+	return exitFailure
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"text/template"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// extract asks the text model for the values of the fields in the filename
+// format, with the rendered additional prompt.
+func (c *RenameFlags) extract(ctx context.Context, client *openai.Client, info documentInfo, prompt, markdown string) (map[string]string, error) {
+	// for all markdown use OpenAI text model to extract
+	response, err := c.complete(
+		ctx,
+		client,
+		"extract",
+		openai.ChatCompletionRequest{
+			Model: c.TextModel,
+			Messages: []openai.ChatCompletionMessage{
+				{
+					Role:    "system",
+					Content: c.extractPrompt(),
+				},
+				{
+					Role:    "system",
+					Content: documentPrompt(prompt, c.originalNamePrompt(info), languagePrompt(info.Language)),
+				},
+				{
+					Role:    "user",
+					Content: markdown,
+				},
+			},
+			ResponseFormat: &openai.ChatCompletionResponseFormat{
+				Type: openai.ChatCompletionResponseFormatTypeJSONObject,
+			},
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract information from markdown: %w", err)
+	}
+
+	payload := response.Choices[0].Message.Content
+	slog.Info("extracted", "payload", payload)
+
+	var values map[string]string
+	err = json.Unmarshal([]byte(payload), &values)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal JSON payload: %w", err)
+	}
+
+	if values == nil {
+		values = map[string]string{}
+	}
+
+	return values, nil
+}
+
+// extractPrompt is the system prompt of the text model for the run. What
+// differs between documents is given in documentPrompt after it, so this
+// prompt is the same for every document and cached by the provider.
+func (c *RenameFlags) extractPrompt() string {
+	return fmt.Sprintf(`
+You are provided with a markdown document, and your task is to extract specific information to generate a JSON object. The extracted information will be used to construct a filename using a Go 'text/template' format. Follow these instructions precisely:
+1. **Understand the provided context:**
+	- The filename format is: '%s'.
+	- The context of the document, such as the user's guidance for extraction, is given in the next message.
+2. Extract the required fields from the markdown document:
+   - Each field corresponds to a key in the filename template (e.g., '{{.Title}}').
+   - Ensure that the extracted fields strictly match the case of the keys in the template.
+3. Output the extracted data as a valid JSON object:
+   - Use string key-value pairs only.
+   - For example, if the format is '{{.Title | snakecase}}', output should be: '{"Title": "My Title"}'.
+4. Do not include any extraneous explanation, commentary, or additional data outside the JSON object.
+5. Handle potential variations in the markdown document:
+   - If a field is missing or ambiguous, make a **best effort** to infer it based on the surrounding context.
+   - If inference is not possible, exclude the field from the output.
+6. Validate the JSON structure before returning it:
+   - Ensure the output is properly formatted and parsable.
+%s%s
+`, c.format(), c.additionalFieldsPrompt(), c.correctionsPrompt())
+}
+
+// documentPrompt is the context of the document being extracted.
+func documentPrompt(prompt, originalName, language string) string {
+	return fmt.Sprintf(`The context of the document:
+	- The user has requested specific guidance for extraction: '%s'.%s%s
+`, prompt, originalName, language)
+}
+
+// additionalField is a field extracted for pdfrenamer's own use, even when
+// the filename format does not reference it.
+type additionalField struct {
+	Name        string
+	Description string
+}
+
+// additionalFields returns the fields the enabled options depend on.
+func (c *RenameFlags) additionalFields() []additionalField {
+	fields := []additionalField{}
+
+	if c.Addressees != "" {
+		fields = append(fields, additionalField{
+			Name:        "Addressee",
+			Description: "the full name of the person the document is addressed to",
+		})
+	}
+
+	// a statement's period is extracted as a pair, for the period function
+	if strings.Contains(c.format(), ".PeriodStart") || strings.Contains(c.format(), ".PeriodEnd") {
+		fields = append(fields,
+			additionalField{
+				Name:        "PeriodStart",
+				Description: "the first day of the period the document covers, such as a statement or billing period, as YYYY-MM-DD",
+			},
+			additionalField{
+				Name:        "PeriodEnd",
+				Description: "the last day of that period, as YYYY-MM-DD",
+			},
+		)
+	}
+
+	if c.usesDocDates() {
+		fields = append(fields,
+			additionalField{
+				Name:        docDateField,
+				Description: "the date the document was issued, such as the date of an invoice or letter, as YYYY-MM-DD, not the date it was printed, received, or scanned",
+			},
+			additionalField{
+				Name:        scanDateField,
+				Description: "the date of a scanner, fax, or receipt stamp visible on the document, as YYYY-MM-DD, if there is one",
+			},
+		)
+	}
+
+	if 0 < len(c.Categories) {
+		fields = append(fields, additionalField{
+			Name:        "Category",
+			Description: "the kind of document, exactly one of " + strings.Join(c.Categories, ", "),
+		})
+	}
+
+	if 0 < c.AutoThreshold {
+		fields = append(fields, additionalField{
+			Name:        confidenceField,
+			Description: "how confident you are, from 0 to 1, that every other value was read from the document rather than guessed",
+		})
+	}
+
+	return fields
+}
+
+func (c *RenameFlags) additionalFieldsPrompt() string {
+	fields := c.additionalFields()
+	if len(fields) == 0 {
+		return ""
+	}
+
+	prompt := &strings.Builder{}
+	prompt.WriteString("7. Also extract these fields, whether or not the filename format uses them:\n")
+
+	for _, field := range fields {
+		fmt.Fprintf(prompt, "   - '%s': %s.\n", field.Name, field.Description)
+	}
+
+	return prompt.String()
+}
+
+// clarify makes a follow-up request for only the fields that the initial
+// extraction left out, along with the values that were already found.
+func (c *RenameFlags) clarify(ctx context.Context, client *openai.Client, info documentInfo, prompt, markdown string, values map[string]string, missing []string) (map[string]string, error) {
+	found, err := json.Marshal(values)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal extracted values: %w", err)
+	}
+
+	response, err := c.complete(
+		ctx,
+		client,
+		"clarify",
+		openai.ChatCompletionRequest{
+			Model: c.TextModel,
+			Messages: []openai.ChatCompletionMessage{
+				{
+					Role: "system",
+					Content: fmt.Sprintf(`
+You previously extracted information from a markdown document to construct a filename, but some fields are missing. Follow these instructions precisely:
+1. **Understand the provided context:**
+	- The user has requested specific guidance for extraction: '%s'.
+	- The filename format is: '%s'.
+	- The fields already extracted are: '%s'.%s%s
+2. Find values for only these missing fields: '%s'.
+   - Search the whole document, including headers, footers, and tables.
+   - If a value is not stated directly, make a **best effort** to infer it from the surrounding context.
+3. Output the extracted data as a valid JSON object:
+   - Use string key-value pairs only, with keys matching the case of the missing fields.
+   - If inference is not possible, exclude the field from the output.
+4. Do not include any extraneous explanation, commentary, or additional data outside the JSON object.
+					`, prompt, c.format(), found, c.originalNamePrompt(info), languagePrompt(info.Language), strings.Join(missing, ", ")),
+				},
+				{
+					Role:    "user",
+					Content: markdown,
+				},
+			},
+			ResponseFormat: &openai.ChatCompletionResponseFormat{
+				Type: openai.ChatCompletionResponseFormatTypeJSONObject,
+			},
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to clarify missing fields from markdown: %w", err)
+	}
+
+	payload := response.Choices[0].Message.Content
+	slog.Info("clarified", "payload", payload)
+
+	var clarified map[string]string
+	err = json.Unmarshal([]byte(payload), &clarified)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal JSON payload: %w", err)
+	}
+
+	return clarified, nil
+}
+
+// missingFields returns the fields referenced by the template that have no
+// extracted value.
+func missingFields(tmpl *template.Template, values map[string]string) []string {
+	missing := []string{}
+
+	for _, field := range templateFields(tmpl) {
+		if strings.TrimSpace(values[field]) == "" {
+			missing = append(missing, field)
+		}
+	}
+
+	return missing
+}
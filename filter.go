@@ -0,0 +1,291 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/kong"
+)
+
+type FilterFlags struct {
+	Include       []namePattern `help:"only rename documents matching one of these globs, or regular expressions prefixed with re:, e.g. 'scan*.pdf' or 're:^\\d{8}'"`
+	Exclude       []namePattern `help:"skip documents matching one of these globs, or regular expressions prefixed with re:, e.g. '~*' or 're:(?i)draft'"`
+	MinSize       byteSize      `help:"skip documents smaller than this, e.g. 10KB"`
+	MaxSize       byteSize      `help:"skip documents larger than this, such as scanned books, e.g. 50MB"`
+	ModifiedSince modifiedTime  `help:"skip documents last modified before this date, time, or duration ago, e.g. 2024-01-31 or 720h"`
+
+	Order string `help:"order to rename documents in: as given, by name, newest first by mtime, smallest first by size, or random to sample a large run" enum:"given,name,mtime,size,random" default:"given"`
+}
+
+// namePattern matches the names of documents. A glob without a slash matches
+// the base name, and one with a slash the whole path. A regular expression
+// matches anywhere in the whole path.
+type namePattern struct {
+	glob string
+	re   *regexp.Regexp
+}
+
+func (p *namePattern) Decode(ctx *kong.DecodeContext) error {
+	var value string
+
+	err := ctx.Scan.PopValueInto("pattern", &value)
+	if err != nil {
+		return err
+	}
+
+	if expression, ok := strings.CutPrefix(value, "re:"); ok {
+		p.re, err = regexp.Compile(expression)
+		if err != nil {
+			return fmt.Errorf("failed to parse regular expression: %w", err)
+		}
+
+		return nil
+	}
+
+	_, err = path.Match(value, "")
+	if err != nil {
+		return fmt.Errorf("failed to parse glob %q: %w", value, err)
+	}
+
+	p.glob = value
+
+	return nil
+}
+
+func (p namePattern) MarshalText() ([]byte, error) {
+	if p.re != nil {
+		return []byte("re:" + p.re.String()), nil
+	}
+
+	return []byte(p.glob), nil
+}
+
+func (p namePattern) matches(name string) bool {
+	name = filepath.ToSlash(name)
+
+	if p.re != nil {
+		return p.re.MatchString(name)
+	}
+
+	if !strings.Contains(p.glob, "/") {
+		name = path.Base(name)
+	}
+
+	matched, _ := path.Match(p.glob, name)
+
+	return matched
+}
+
+// byteSize is a size in bytes, given with an optional unit such as KB or MiB.
+type byteSize int64
+
+var byteUnits = map[string]int64{
+	"":    1,
+	"B":   1,
+	"K":   1 << 10,
+	"KB":  1000,
+	"KIB": 1 << 10,
+	"M":   1 << 20,
+	"MB":  1000 * 1000,
+	"MIB": 1 << 20,
+	"G":   1 << 30,
+	"GB":  1000 * 1000 * 1000,
+	"GIB": 1 << 30,
+}
+
+func (s *byteSize) Decode(ctx *kong.DecodeContext) error {
+	var value string
+
+	err := ctx.Scan.PopValueInto("size", &value)
+	if err != nil {
+		return err
+	}
+
+	value = strings.TrimSpace(value)
+	end := strings.IndexFunc(value, func(r rune) bool { return (r < '0' || '9' < r) && r != '.' })
+	if end < 0 {
+		end = len(value)
+	}
+
+	size, err := strconv.ParseFloat(value[:end], 64)
+	unit, ok := byteUnits[strings.ToUpper(strings.TrimSpace(value[end:]))]
+
+	if err != nil || !ok {
+		return fmt.Errorf("expected a size such as 512KB or 50MB, not %q", value)
+	}
+
+	*s = byteSize(size * float64(unit))
+
+	return nil
+}
+
+// modifiedTime is a time given as a date, an RFC 3339 time, or a duration
+// before now.
+type modifiedTime struct {
+	time.Time
+}
+
+func (t *modifiedTime) Decode(ctx *kong.DecodeContext) error {
+	var value string
+
+	err := ctx.Scan.PopValueInto("time", &value)
+	if err != nil {
+		return err
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err == nil {
+		t.Time = time.Now().Add(-duration)
+		return nil
+	}
+
+	for _, layout := range []string{time.RFC3339, time.DateTime, time.DateOnly} {
+		parsed, err := time.ParseInLocation(layout, value, time.Local)
+		if err == nil {
+			t.Time = parsed
+			return nil
+		}
+	}
+
+	return fmt.Errorf("expected a date such as 2024-01-31, a time, or a duration such as 720h, not %q", value)
+}
+
+// skip returns why the document is filtered out, or an empty string when it
+// is not. Only the name of a remote document is filtered, as its size and
+// modification time are not known without fetching it. A local document that
+// cannot be read is not skipped, so renaming it reports the error.
+func (f *FilterFlags) skip(name string, info os.FileInfo) string {
+	for _, pattern := range f.Exclude {
+		if pattern.matches(name) {
+			return "excluded"
+		}
+	}
+
+	if len(f.Include) > 0 {
+		included := false
+
+		for _, pattern := range f.Include {
+			if pattern.matches(name) {
+				included = true
+				break
+			}
+		}
+
+		if !included {
+			return "not included"
+		}
+	}
+
+	if f.MinSize == 0 && f.MaxSize == 0 && f.ModifiedSince.IsZero() || isRemote(name) {
+		return ""
+	}
+
+	if info == nil {
+		var err error
+
+		info, err = os.Stat(name)
+		if err != nil || info.IsDir() {
+			return ""
+		}
+	}
+
+	switch {
+	case f.MinSize != 0 && info.Size() < int64(f.MinSize):
+		return "smaller than --min-size"
+	case f.MaxSize != 0 && int64(f.MaxSize) < info.Size():
+		return "larger than --max-size"
+	case !f.ModifiedSince.IsZero() && info.ModTime().Before(f.ModifiedSince.Time):
+		return "modified before --modified-since"
+	}
+
+	return ""
+}
+
+// filter returns the names of the documents that are not filtered out,
+// logging those that are.
+func (f *FilterFlags) filter(names []string) []string {
+	filtered := []string{}
+
+	for _, name := range names {
+		reason := f.skip(name, nil)
+		if reason != "" {
+			slog.Info("filter.skip", "name", name, "reason", reason)
+			continue
+		}
+
+		filtered = append(filtered, name)
+	}
+
+	return filtered
+}
+
+// order sorts the names of the documents by --order. Remote documents, and
+// local ones that cannot be read, have no size or modification time and sort
+// last.
+func (f *FilterFlags) order(names []string) {
+	type document struct {
+		name  string
+		info  os.FileInfo
+		local bool
+	}
+
+	switch f.Order {
+	case "name":
+		slices.SortStableFunc(names, func(a, b string) int {
+			return cmp.Compare(filepath.Base(a), filepath.Base(b))
+		})
+
+		return
+	case "random":
+		rand.Shuffle(len(names), func(i, j int) {
+			names[i], names[j] = names[j], names[i]
+		})
+
+		return
+	case "mtime", "size":
+	default:
+		return
+	}
+
+	documents := make([]document, len(names))
+
+	for i, name := range names {
+		documents[i].name = name
+
+		if !isRemote(name) {
+			info, err := os.Stat(name)
+			documents[i].info, documents[i].local = info, err == nil
+		}
+	}
+
+	slices.SortStableFunc(documents, func(a, b document) int {
+		switch {
+		case a.local != b.local:
+			if a.local {
+				return -1
+			}
+
+			return 1
+		case !a.local:
+			return 0
+		case f.Order == "mtime":
+			return b.info.ModTime().Compare(a.info.ModTime())
+		}
+
+		return cmp.Compare(a.info.Size(), b.info.Size())
+	})
+
+	for i, document := range documents {
+		names[i] = document.name
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/language"
+)
+
+// canonicalCorpSuffixes is the spelling normalizeCorpSuffix uses for each
+// legal suffix, keyed by the suffix lowercased and without dots.
+var canonicalCorpSuffixes = map[string]string{
+	"ag":           "AG",
+	"bv":           "BV",
+	"co":           "Co",
+	"company":      "Co",
+	"corp":         "Corp",
+	"corporation":  "Corp",
+	"gmbh":         "GmbH",
+	"inc":          "Inc",
+	"incorporated": "Inc",
+	"kg":           "KG",
+	"limited":      "Ltd",
+	"llc":          "LLC",
+	"llp":          "LLP",
+	"lp":           "LP",
+	"ltd":          "Ltd",
+	"nv":           "NV",
+	"plc":          "PLC",
+	"pty":          "Pty",
+	"sa":           "SA",
+	"sarl":         "SARL",
+}
+
+// splitCorpSuffix separates a company name from its trailing legal suffixes,
+// e.g. "Acme, Inc." is split into "Acme" and ["inc"].
+func splitCorpSuffix(name string) (string, []string) {
+	words := strings.Fields(name)
+	suffixes := []string{}
+
+	for 1 < len(words) {
+		last := words[len(words)-1]
+		key := strings.ToLower(strings.ReplaceAll(strings.Trim(last, ",.()"), ".", ""))
+
+		if key == "&" || key == "" {
+			words = words[:len(words)-1]
+			continue
+		}
+
+		if _, ok := canonicalCorpSuffixes[key]; !ok {
+			break
+		}
+
+		suffixes = append([]string{key}, suffixes...)
+		words = words[:len(words)-1]
+	}
+
+	return strings.TrimRight(strings.Join(words, " "), ",&- "), suffixes
+}
+
+// stripCorpSuffix removes legal suffixes such as Inc., LLC, or GmbH.
+func stripCorpSuffix(name string) string {
+	stripped, _ := splitCorpSuffix(name)
+
+	return stripped
+}
+
+// normalizeCorpSuffix rewrites legal suffixes to a consistent spelling, so
+// "Acme Incorporated" and "Acme, Inc." both become "Acme Inc".
+func normalizeCorpSuffix(name string) string {
+	stripped, suffixes := splitCorpSuffix(name)
+
+	words := []string{stripped}
+	for _, suffix := range suffixes {
+		words = append(words, canonicalCorpSuffixes[suffix])
+	}
+
+	return strings.Join(slices.Compact(words), " ")
+}
+
+// localeTitle title cases a value using the casing rules of a language,
+// e.g. `{{.Vendor | localeTitle "nl"}}`.
+func localeTitle(locale, value string) (string, error) {
+	tag, err := language.Parse(locale)
+	if err != nil {
+		return "", fmt.Errorf("unknown locale %q: %w", locale, err)
+	}
+
+	return cases.Title(tag).String(value), nil
+}
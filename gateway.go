@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// openRouterHeaders attribute requests to pdfrenamer on OpenRouter, which
+// lists apps by them. --header overrides them.
+var openRouterHeaders = map[string]string{
+	"HTTP-Referer": "https://github.com/jtarchie/pdfrenamer",
+	"X-Title":      "pdfrenamer",
+}
+
+// gatewayTransport adds what gateways such as OpenRouter and LiteLLM take
+// beyond the OpenAI API: extra headers, and the providers each model is
+// routed to.
+type gatewayTransport struct {
+	base      http.RoundTripper
+	headers   map[string]string
+	providers map[string][]string
+}
+
+func (t *gatewayTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	request = request.Clone(request.Context())
+
+	for name, value := range t.headers {
+		request.Header.Set(name, value)
+	}
+
+	if len(t.providers) == 0 || request.Body == nil || !strings.HasPrefix(request.Header.Get("Content-Type"), "application/json") {
+		return t.base.RoundTrip(request)
+	}
+
+	body, err := io.ReadAll(request.Body)
+	_ = request.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read request: %w", err)
+	}
+
+	routed, err := t.route(body)
+	if err != nil {
+		// a request without a model is sent as it is
+		routed = body
+	}
+
+	request.Body = io.NopCloser(bytes.NewReader(routed))
+	request.ContentLength = int64(len(routed))
+
+	return t.base.RoundTrip(request)
+}
+
+// route adds OpenRouter's provider preferences for the request's model.
+func (t *gatewayTransport) route(body []byte) ([]byte, error) {
+	var request map[string]json.RawMessage
+
+	err := json.Unmarshal(body, &request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal request: %w", err)
+	}
+
+	var model string
+
+	err = json.Unmarshal(request["model"], &model)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal model: %w", err)
+	}
+
+	providers, ok := t.providers[model]
+	if !ok {
+		return body, nil
+	}
+
+	request["provider"], err = json.Marshal(map[string]any{"order": providers})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal provider preferences: %w", err)
+	}
+
+	return json.Marshal(request)
+}
+
+// httpClient is the client of every request to the provider, with the
+// transports that --bedrock, --cache-control, --header, and --provider need.
+func (c *RenameFlags) httpClient() *http.Client {
+	var transport http.RoundTripper = &quirksTransport{base: http.DefaultTransport}
+
+	if c.Bedrock {
+		// the Converse API has its own cache points and headers
+		return &http.Client{Transport: providerTransport{&bedrockTransport{region: c.BedrockRegion, endpoint: c.Endpoint, cacheControl: c.CacheControl}}}
+	}
+
+	if c.CacheControl {
+		transport = &cacheControlTransport{base: transport}
+	}
+
+	headers := map[string]string{}
+	if endpoint, err := url.Parse(c.Endpoint); err == nil && strings.HasSuffix(endpoint.Hostname(), "openrouter.ai") {
+		maps.Copy(headers, openRouterHeaders)
+	}
+
+	maps.Copy(headers, c.Header)
+
+	providers := map[string][]string{}
+	for model, order := range c.Provider {
+		for _, provider := range strings.Split(order, ",") {
+			if provider = strings.TrimSpace(provider); provider != "" {
+				providers[model] = append(providers[model], provider)
+			}
+		}
+	}
+
+	if 0 < len(headers) || 0 < len(providers) {
+		transport = &gatewayTransport{base: transport, headers: headers, providers: providers}
+	}
+
+	return &http.Client{Transport: providerTransport{transport}}
+}
+
+// providerTransport marks the errors of requests to the provider, so they are
+// told apart from the network errors of storage and webhooks.
+type providerTransport struct {
+	base http.RoundTripper
+}
+
+func (t providerTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	response, err := t.base.RoundTrip(request)
+	if err != nil {
+		return nil, providerError{err}
+	}
+
+	return response, nil
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2/google"
+)
+
+// gcsBucket is a minimal Google Cloud Storage client, using the JSON API,
+// for the objects pdfrenamer reads and renames.
+type gcsBucket struct {
+	client   *http.Client
+	name     string
+	endpoint string
+}
+
+// newGCSBucket authenticates with application-default credentials, or not at
+// all when STORAGE_EMULATOR_HOST points at an emulator.
+func newGCSBucket(ctx context.Context, name string) (*gcsBucket, error) {
+	if host := os.Getenv("STORAGE_EMULATOR_HOST"); host != "" {
+		if !strings.Contains(host, "://") {
+			host = "http://" + host
+		}
+
+		return &gcsBucket{
+			client:   &http.Client{Timeout: 5 * time.Minute},
+			name:     name,
+			endpoint: strings.TrimSuffix(host, "/"),
+		}, nil
+	}
+
+	client, err := google.DefaultClient(ctx, "https://www.googleapis.com/auth/devstorage.read_write")
+	if err != nil {
+		return nil, fmt.Errorf("failed to load Google application-default credentials: %w", err)
+	}
+
+	client.Timeout = 5 * time.Minute
+
+	return &gcsBucket{
+		client:   client,
+		name:     name,
+		endpoint: "https://storage.googleapis.com",
+	}, nil
+}
+
+func (b *gcsBucket) url(key string) string {
+	return b.endpoint + "/storage/v1/b/" + url.PathEscape(b.name) + "/o/" + url.PathEscape(key)
+}
+
+// do sends the request, returning an error for non-2xx responses.
+func (b *gcsBucket) do(ctx context.Context, method, url string, body io.Reader, contentType string) (*http.Response, error) {
+	request, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCS request: %w", err)
+	}
+
+	if contentType != "" {
+		request.Header.Set("Content-Type", contentType)
+	}
+
+	response, err := b.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode < 200 || 299 < response.StatusCode {
+		defer response.Body.Close()
+
+		message, _ := io.ReadAll(io.LimitReader(response.Body, 4096))
+
+		return nil, fmt.Errorf("%s %s: %s: %s", method, request.URL.Redacted(), response.Status, strings.TrimSpace(string(message)))
+	}
+
+	return response, nil
+}
+
+func (b *gcsBucket) get(ctx context.Context, key string, w io.Writer) error {
+	response, err := b.do(ctx, http.MethodGet, b.url(key)+"?alt=media", nil, "")
+	if err != nil {
+		return fmt.Errorf("failed to get gs://%s/%s: %w", b.name, key, err)
+	}
+	defer response.Body.Close()
+
+	_, err = io.Copy(w, response.Body)
+	if err != nil {
+		return fmt.Errorf("failed to download gs://%s/%s: %w", b.name, key, err)
+	}
+
+	return nil
+}
+
+// put uploads the object, marked as renamed, unless it already exists.
+func (b *gcsBucket) put(ctx context.Context, key string, r io.Reader) error {
+	metadata, err := json.Marshal(gcsObject(key))
+	if err != nil {
+		return fmt.Errorf("failed to marshal object metadata: %w", err)
+	}
+
+	// a multipart upload sets the metadata along with the content
+	body := &bytes.Buffer{}
+	parts := multipart.NewWriter(body)
+
+	part, err := parts.CreatePart(textproto.MIMEHeader{"Content-Type": {"application/json; charset=UTF-8"}})
+	if err != nil {
+		return fmt.Errorf("failed to create upload: %w", err)
+	}
+
+	_, err = part.Write(metadata)
+	if err != nil {
+		return fmt.Errorf("failed to create upload: %w", err)
+	}
+
+	part, err = parts.CreatePart(textproto.MIMEHeader{"Content-Type": {"application/pdf"}})
+	if err != nil {
+		return fmt.Errorf("failed to create upload: %w", err)
+	}
+
+	_, err = io.Copy(part, r)
+	if err != nil {
+		return fmt.Errorf("failed to read upload: %w", err)
+	}
+
+	err = parts.Close()
+	if err != nil {
+		return fmt.Errorf("failed to create upload: %w", err)
+	}
+
+	endpoint := b.endpoint + "/upload/storage/v1/b/" + url.PathEscape(b.name) + "/o?uploadType=multipart&ifGenerationMatch=0"
+
+	response, err := b.do(ctx, http.MethodPost, endpoint, body, "multipart/related; boundary="+parts.Boundary())
+	if err != nil {
+		return fmt.Errorf("failed to put gs://%s/%s: %w", b.name, key, err)
+	}
+
+	return response.Body.Close()
+}
+
+func (b *gcsBucket) delete(ctx context.Context, key string) error {
+	response, err := b.do(ctx, http.MethodDelete, b.url(key), nil, "")
+	if err != nil {
+		return fmt.Errorf("failed to delete gs://%s/%s: %w", b.name, key, err)
+	}
+
+	return response.Body.Close()
+}
+
+// move rewrites the object to its new key, marked as renamed, and then
+// deletes the original. An existing object at the new key is not
+// overwritten. Large objects take several rewrite calls.
+func (b *gcsBucket) move(ctx context.Context, from, to string) error {
+	metadata, err := json.Marshal(gcsObject(to))
+	if err != nil {
+		return fmt.Errorf("failed to marshal object metadata: %w", err)
+	}
+
+	endpoint := b.url(from) + "/rewriteTo/b/" + url.PathEscape(b.name) + "/o/" + url.PathEscape(to) + "?ifGenerationMatch=0"
+	token := ""
+
+	for {
+		rewrite := endpoint
+		if token != "" {
+			rewrite += "&rewriteToken=" + url.QueryEscape(token)
+		}
+
+		response, err := b.do(ctx, http.MethodPost, rewrite, bytes.NewReader(metadata), "application/json")
+		if err != nil {
+			return fmt.Errorf("failed to copy gs://%s/%s: %w", b.name, from, err)
+		}
+
+		var status struct {
+			Done         bool   `json:"done"`
+			RewriteToken string `json:"rewriteToken"`
+		}
+
+		err = json.NewDecoder(response.Body).Decode(&status)
+		_ = response.Body.Close()
+		if err != nil {
+			return fmt.Errorf("failed to decode rewrite of gs://%s/%s: %w", b.name, from, err)
+		}
+
+		if status.Done {
+			break
+		}
+
+		token = status.RewriteToken
+	}
+
+	return b.delete(ctx, from)
+}
+
+// gcsObject is the metadata for an object written by pdfrenamer.
+func gcsObject(key string) map[string]any {
+	return map[string]any{
+		"name":        key,
+		"contentType": "application/pdf",
+		"metadata": map[string]string{
+			"pdfrenamer": "renamed",
+		},
+	}
+}
+
+// close does nothing, as requests do not hold a connection.
+func (b *gcsBucket) close() error {
+	return nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// gitRename moves src with `git mv` when it is tracked by a git repository,
+// so the rename is staged. It reports false, without error, when the file is
+// not tracked and should be renamed normally.
+func gitRename(src, dst string) (bool, error) {
+	dir := filepath.Dir(src)
+
+	_, err := git(dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return false, nil
+	}
+
+	_, err = git(dir, "ls-files", "--error-unmatch", "--", filepath.Base(src))
+	if err != nil {
+		return false, nil
+	}
+
+	absoluteDst, err := filepath.Abs(dst)
+	if err != nil {
+		return false, fmt.Errorf("failed to resolve destination: %w", err)
+	}
+
+	slog.Info("rename.git", "src", src, "dst", dst)
+
+	_, err = git(dir, "mv", "--", filepath.Base(src), absoluteDst)
+	if err != nil {
+		return false, fmt.Errorf("failed to git mv: %w", err)
+	}
+
+	return true, nil
+}
+
+func git(dir string, args ...string) (string, error) {
+	stderr := &bytes.Buffer{}
+
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	cmd.Stderr = stderr
+
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return strings.TrimSpace(string(output)), nil
+}
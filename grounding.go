@@ -0,0 +1,219 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// groundDateLayouts are the ways a date is looked for in a document, as the
+// text model normalizes the dates it extracts.
+var groundDateLayouts = []string{
+	"2006-01-02",
+	"20060102",
+	"02.01.2006",
+	"2.1.2006",
+	"02.01.06",
+	"01/02/2006",
+	"1/2/2006",
+	"01/02/06",
+	"02/01/2006",
+	"2/1/2006",
+	"02/01/06",
+	"01-02-2006",
+	"02-01-2006",
+	"January 2, 2006",
+	"Jan 2, 2006",
+	"2 January 2006",
+	"2 Jan 2006",
+}
+
+// groundMonthLayouts are the ways a date on the first of a month is looked
+// for, as it may be a month such as a statement period.
+var groundMonthLayouts = []string{
+	"January 2006",
+	"Jan 2006",
+	"01/2006",
+	"01.2006",
+	"2006-01",
+}
+
+// monthNames are the names of the months in the languages of the messages,
+// for dates written out in them, such as "3. März 2024".
+var monthNames = map[string][]string{
+	"de": {"Januar", "Februar", "März", "April", "Mai", "Juni", "Juli", "August", "September", "Oktober", "November", "Dezember"},
+	"fr": {"janvier", "février", "mars", "avril", "mai", "juin", "juillet", "août", "septembre", "octobre", "novembre", "décembre"},
+}
+
+// amountPattern matches the numbers in a document, with thousands separators
+// of any locale.
+var amountPattern = regexp.MustCompile(`\d{1,3}(?:[.,'’  ]\d{3})+(?:[.,]\d+)?|\d+(?:[.,]\d+)?`)
+
+// ungroundedError is returned for a document with values that do not appear
+// in its text, which the text model may have made up. It holds the rename
+// that was proposed, for reviewing it.
+type ungroundedError struct {
+	fields []string
+
+	filename string
+	values   map[string]string
+}
+
+func (e ungroundedError) Error() string {
+	return fmt.Sprintf("%s not found in the document, leaving %q for review", strings.Join(e.fields, ", "), e.filename)
+}
+
+func (e ungroundedError) proposed() (string, map[string]string) {
+	return e.filename, e.values
+}
+
+// ground returns the fields of --ground-fields whose values do not appear in
+// the markdown.
+func (c *RenameFlags) ground(markdown string, values map[string]string) ([]string, error) {
+	if len(c.GroundFields) == 0 || markdown == "" {
+		return nil, nil
+	}
+
+	dates, err := c.dates()
+	if err != nil {
+		return nil, err
+	}
+
+	ungrounded := []string{}
+
+	for _, field := range c.GroundFields {
+		value := strings.TrimSpace(values[field])
+		if value == "" || grounded(markdown, value, dates) {
+			continue
+		}
+
+		slog.Warn("ground.missing", "field", field, "value", value)
+		ungrounded = append(ungrounded, field)
+	}
+
+	return ungrounded, nil
+}
+
+// checkGrounding fails, or leaves for review, a planned rename with values
+// that do not appear in the document, as --ungrounded says.
+func (c *RenameFlags) checkGrounding(plan *plannedRename) error {
+	if len(plan.ungrounded) == 0 {
+		return nil
+	}
+
+	switch c.Ungrounded {
+	case "review":
+		return ungroundedError{
+			fields:   plan.ungrounded,
+			filename: plan.Filename,
+			values:   plan.Values,
+		}
+	case "reject":
+		return fmt.Errorf("%s not found in the document", strings.Join(plan.ungrounded, ", "))
+	}
+
+	return nil
+}
+
+// grounded reports whether a value appears in the markdown: as its words,
+// ignoring case, punctuation, and small recognition errors, or as the same
+// date or amount written in any format.
+func grounded(markdown, value string, dates *dateParser) bool {
+	text := groundText(markdown)
+
+	if strings.Contains(" "+text+" ", " "+groundText(value)+" ") {
+		return true
+	}
+
+	// identifiers such as IBANs are printed in groups but often extracted
+	// without them
+	if strings.ContainsFunc(value, unicode.IsDigit) &&
+		strings.Contains(strings.ReplaceAll(text, " ", ""), strings.ReplaceAll(groundText(value), " ", "")) {
+		return true
+	}
+
+	// the digits of dates and amounts are too common to be matched as words
+	if date, err := dates.parse(value); err == nil {
+		return groundedDate(text, date)
+	}
+
+	if amount, err := parseAmount(value); err == nil && !strings.ContainsFunc(strings.TrimFunc(value, unicode.IsLetter), unicode.IsLetter) {
+		for _, number := range amountPattern.FindAllString(markdown, -1) {
+			found, err := parseAmount(number)
+			if err == nil && math.Abs(math.Abs(amount)-found) < 0.005 {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	return groundedWords(text, groundText(value))
+}
+
+// groundedDate reports whether the date is written in the text in any of
+// the common layouts.
+func groundedDate(text string, date time.Time) bool {
+	layouts := groundDateLayouts
+	if date.Day() == 1 {
+		layouts = append(layouts[:len(layouts):len(layouts)], groundMonthLayouts...)
+	}
+
+	written := []string{}
+	for _, layout := range layouts {
+		written = append(written, date.Format(layout))
+	}
+
+	for _, names := range monthNames {
+		month := names[date.Month()-1]
+		written = append(written,
+			fmt.Sprintf("%d. %s %d", date.Day(), month, date.Year()),
+			fmt.Sprintf("%d %s %d", date.Day(), month, date.Year()),
+		)
+	}
+
+	for _, date := range written {
+		if strings.Contains(" "+text+" ", " "+groundText(date)+" ") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// groundedWords reports whether most words of the value are in the text,
+// allowing for misrecognized letters and abbreviations such as "Corp" for
+// "Corporation".
+func groundedWords(text, value string) bool {
+	words := strings.Fields(value)
+	if len(words) == 0 {
+		return true
+	}
+
+	documentWords := strings.Fields(text)
+	found := 0
+
+	for _, word := range words {
+		for _, documentWord := range documentWords {
+			abbreviated := 3 <= len(word) && strings.HasPrefix(documentWord, word)
+			if word == documentWord || abbreviated || (4 < len(word) && 0.8 <= similarity(word, documentWord)) {
+				found++
+				break
+			}
+		}
+	}
+
+	return len(words) < 2*found
+}
+
+// groundText lowercases text and replaces its punctuation with single
+// spaces, for comparing values to the document.
+func groundText(value string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(value), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	}), " ")
+}
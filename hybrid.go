@@ -0,0 +1,49 @@
+package main
+
+import (
+	"log/slog"
+	"strings"
+	"unicode"
+
+	"github.com/gen2brain/go-fitz"
+)
+
+const (
+	// hybridDPI renders the image sent with a page's text layer, which is
+	// only needed for its layout and what the text lacks.
+	hybridDPI = 72
+	// minTextLayer is the number of letters and digits a page's text layer
+	// needs to be used, so a scan with a few stray OCR characters is still
+	// read from its image.
+	minTextLayer = 50
+)
+
+const promptTextLayer = "When the page's embedded text layer is given with its image, take the text from it exactly, and use the image for its layout, tables, and anything the text layer lacks, such as stamps, signatures, handwriting, and figures.\n"
+
+// pageText returns the text layer of the page, or an empty string when it
+// has too little text to use.
+func pageText(doc *fitz.Document, n int) string {
+	text, err := doc.Text(n)
+	if err != nil {
+		slog.Warn("pdf.text", "page", n, "error", err)
+		return ""
+	}
+
+	if countText(text) < minTextLayer {
+		return ""
+	}
+
+	return strings.TrimSpace(text)
+}
+
+// countText counts the letters and digits of the text.
+func countText(text string) int {
+	count := 0
+	for _, r := range text {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			count++
+		}
+	}
+
+	return count
+}
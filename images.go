@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image/jpeg"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gen2brain/go-fitz"
+)
+
+// pageDPI renders pages for reading them from their images alone.
+const pageDPI = 300
+
+// pageImageDir is the directory in --image-dir the pages of the document are
+// spilled to, named after its contents so a retry finds them again.
+func (c *RenameFlags) pageImageDir(source string) (string, error) {
+	file, err := os.Open(source)
+	if err != nil {
+		return "", fmt.Errorf("failed to open PDF: %w", err)
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+
+	_, err = io.Copy(hash, file)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash PDF: %w", err)
+	}
+
+	dir := filepath.Join(c.ImageDir, hex.EncodeToString(hash.Sum(nil)))
+
+	err = os.MkdirAll(dir, 0o700)
+	if err != nil {
+		return "", fmt.Errorf("failed to create image directory: %w", err)
+	}
+
+	return dir, nil
+}
+
+// pageImage renders the region of the page as a JPEG data URL at the DPI. With an image
+// directory, the JPEG is written there instead of to the buffer, and one
+// written by an earlier attempt at the document is used without rendering the
+// page again.
+func pageImage(ctx context.Context, doc *fitz.Document, n int, dpi float64, region pageRegion, dir string, buffer *bytes.Buffer) (string, error) {
+	if dir == "" {
+		buffer.Reset()
+
+		err := renderPage(ctx, doc, n, dpi, region, buffer)
+		if err != nil {
+			return "", err
+		}
+
+		return dataURL("image/jpeg", buffer), nil
+	}
+
+	name := fmt.Sprintf("page-%d", n)
+	if dpi != pageDPI {
+		name += fmt.Sprintf("-%gdpi", dpi)
+	}
+	if !region.whole() {
+		name += "-" + region.name
+	}
+
+	filename := filepath.Join(dir, name+".jpg")
+
+	file, err := os.Open(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		err = renderPageFile(ctx, doc, n, dpi, region, filename)
+		if err != nil {
+			return "", err
+		}
+
+		file, err = os.Open(filename)
+	} else if err == nil {
+		slog.Info("pdf.image.reuse", "page", n, "filename", filename)
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("failed to open image #%d: %w", n, err)
+	}
+	defer file.Close()
+
+	return dataURL("image/jpeg", file), nil
+}
+
+func renderPage(ctx context.Context, doc *fitz.Document, n int, dpi float64, region pageRegion, writer io.Writer) error {
+	_, render := startSpan(ctx, "render", "page", n)
+
+	image, err := doc.ImageDPI(n, dpi)
+	if err != nil {
+		render.finish(err)
+		return fmt.Errorf("failed to convert page #%d to image: %w", n, err)
+	}
+
+	slog.Info("pdf.image", "page", n)
+
+	err = jpeg.Encode(writer, region.crop(image), &jpeg.Options{Quality: 100})
+	render.finish(err)
+	if err != nil {
+		return fmt.Errorf("failed to encode image #%d: %w", n, err)
+	}
+
+	return nil
+}
+
+// renderPageFile renders the page into the file under a temporary name, so
+// an interrupted render is never reused.
+func renderPageFile(ctx context.Context, doc *fitz.Document, n int, dpi float64, region pageRegion, filename string) error {
+	var renderErr error
+
+	err := writeFile(filename, 0o600, false, func(file io.Writer) error {
+		renderErr = renderPage(ctx, doc, n, dpi, region, file)
+		return renderErr
+	})
+	if renderErr != nil {
+		return renderErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write image #%d: %w", n, err)
+	}
+
+	return nil
+}
+
+// dataURL encodes the contents as a base64 data URL, sized up front so it
+// takes a single allocation when the length is known.
+func dataURL(mediaType string, contents io.Reader) string {
+	prefix := "data:" + mediaType + ";base64,"
+
+	url := &strings.Builder{}
+
+	switch contents := contents.(type) {
+	case *bytes.Buffer:
+		url.Grow(len(prefix) + base64.StdEncoding.EncodedLen(contents.Len()))
+	case *os.File:
+		if info, err := contents.Stat(); err == nil {
+			url.Grow(len(prefix) + base64.StdEncoding.EncodedLen(int(info.Size())))
+		}
+	}
+
+	url.WriteString(prefix)
+
+	encoder := base64.NewEncoder(base64.StdEncoding, url)
+	_, _ = io.Copy(encoder, contents)
+	_ = encoder.Close()
+
+	return url.String()
+}
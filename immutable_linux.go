@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+const immutableSupported = true
+
+// fsImmutableFlag is FS_IMMUTABLE_FL of linux/fs.h.
+const fsImmutableFlag = 0x10
+
+// setImmutable sets the immutable attribute of the file, as `chattr +i`
+// does, so it cannot be changed, renamed, or deleted until the attribute is
+// cleared.
+func setImmutable(filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	flags, err := unix.IoctlGetUint32(int(file.Fd()), unix.FS_IOC_GETFLAGS)
+	if err != nil {
+		return fmt.Errorf("failed to get file attributes: %w", err)
+	}
+
+	err = unix.IoctlSetPointerInt(int(file.Fd()), unix.FS_IOC_SETFLAGS, int(flags|fsImmutableFlag))
+	if err != nil {
+		return fmt.Errorf("failed to set immutable attribute: %w", err)
+	}
+
+	return nil
+}
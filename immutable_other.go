@@ -0,0 +1,11 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+const immutableSupported = false
+
+func setImmutable(string) error {
+	return errors.New("the immutable attribute is only supported on Linux")
+}
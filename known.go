@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// knownValues are field values seen in past runs, keyed by field name.
+type knownValues map[string][]string
+
+func defaultKnownValuesPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find config directory: %w", err)
+	}
+
+	return filepath.Join(dir, "pdfrenamer", "known.json"), nil
+}
+
+func (c *RenameFlags) loadKnownValues() (knownValues, string, error) {
+	if len(c.MatchFields) == 0 {
+		return knownValues{}, "", nil
+	}
+
+	path := c.KnownFile
+	if path == "" {
+		var err error
+
+		path, err = defaultKnownValuesPath()
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	known, err := loadKnownValues(path)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return known, path, nil
+}
+
+func loadKnownValues(path string) (knownValues, error) {
+	contents, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return knownValues{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read known values: %w", err)
+	}
+
+	known := knownValues{}
+
+	err = json.Unmarshal(contents, &known)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal known values: %w", err)
+	}
+
+	return known, nil
+}
+
+func (k knownValues) save(path string) error {
+	err := os.MkdirAll(filepath.Dir(path), 0o755)
+	if err != nil {
+		return fmt.Errorf("failed to create known values directory: %w", err)
+	}
+
+	contents, err := json.MarshalIndent(k, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal known values: %w", err)
+	}
+
+	err = writeFile(path, 0o644, false, func(file io.Writer) error {
+		_, err := file.Write(contents)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write known values: %w", err)
+	}
+
+	return nil
+}
+
+// match returns the most similar known value for the field, if any is at
+// least as similar as the threshold (0 to 1).
+func (k knownValues) match(field, value string, threshold float64) (string, bool) {
+	normalized := normalizeName(value)
+	best, bestScore := "", 0.0
+
+	for _, known := range k[field] {
+		score := similarity(normalized, normalizeName(known))
+		if score > bestScore {
+			best, bestScore = known, score
+		}
+	}
+
+	return best, best != "" && threshold <= bestScore
+}
+
+func (k knownValues) add(field, value string) {
+	if strings.TrimSpace(value) == "" || slices.Contains(k[field], value) {
+		return
+	}
+
+	k[field] = append(k[field], value)
+}
+
+// normalizeName lowercases a name and drops punctuation and legal suffixes.
+func normalizeName(name string) string {
+	words := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+
+	kept := words[:0]
+	for _, word := range words {
+		if _, ok := canonicalCorpSuffixes[word]; !ok {
+			kept = append(kept, word)
+		}
+	}
+
+	return strings.Join(kept, " ")
+}
+
+// similarity is the Levenshtein distance scaled to 1 for identical strings
+// and 0 for entirely different ones.
+func similarity(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+
+	longest := max(len(ra), len(rb))
+	if longest == 0 {
+		return 1
+	}
+
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+
+		previous, current = current, previous
+	}
+
+	return 1 - float64(previous[len(rb)])/float64(longest)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/language"
+	"golang.org/x/text/language/display"
+)
+
+// languageStopwords are common words of each language, for detecting the
+// language of a document without another request to the provider.
+var languageStopwords = map[string][]string{
+	"de": {"der", "die", "das", "und", "ist", "nicht", "mit", "sie", "ein", "eine", "für", "von", "zu", "den", "auf", "ihr", "wir", "bitte"},
+	"en": {"the", "and", "of", "to", "is", "for", "you", "your", "with", "this", "that", "on", "are", "please"},
+	"es": {"el", "los", "las", "y", "que", "es", "por", "para", "una", "con", "del", "su", "usted"},
+	"fr": {"le", "les", "et", "des", "est", "pour", "une", "du", "vous", "que", "dans", "sur", "par", "avec"},
+	"it": {"il", "lo", "gli", "di", "che", "per", "una", "con", "sono", "non", "della", "si"},
+	"nl": {"het", "een", "en", "van", "dat", "voor", "met", "op", "niet", "uw", "zijn", "wij"},
+}
+
+// languageHints are added to the prompts for documents in each language.
+var languageHints = map[string]string{
+	"de": "The document is in German. Keep umlauts and ß exactly, and read dates such as '31.01.2024' or '31. Januar 2024' day first.",
+	"en": "The document is in English.",
+	"es": "The document is in Spanish. Keep accents and ñ exactly, and read dates such as '31/01/2024' or '31 de enero de 2024' day first.",
+	"fr": "The document is in French. Keep accents exactly, and read dates such as '31/01/2024' or '31 janvier 2024' day first.",
+	"it": "The document is in Italian. Keep accents exactly, and read dates such as '31/01/2024' or '31 gennaio 2024' day first.",
+	"nl": "The document is in Dutch. Keep accents exactly, and read dates such as '31-01-2024' or '31 januari 2024' day first.",
+}
+
+// detectLanguage returns the ISO 639-1 code of the language with the most
+// common words in the text, or an empty string when there are too few to
+// tell.
+func detectLanguage(text string) string {
+	counts := map[string]int{}
+
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+
+	for _, word := range words {
+		for code, stopwords := range languageStopwords {
+			for _, stopword := range stopwords {
+				if word == stopword {
+					counts[code]++
+				}
+			}
+		}
+	}
+
+	best, bestCount := "", 2
+	for code, count := range counts {
+		if count > bestCount || (count == bestCount && best != "" && code < best) {
+			best, bestCount = code, count
+		}
+	}
+
+	return best
+}
+
+// languagePrompt is the hint about the document's language given to the
+// prompts, if it is known.
+func languagePrompt(code string) string {
+	hint, ok := languageHints[code]
+	if !ok {
+		return ""
+	}
+
+	return "\n\t- " + hint
+}
+
+// ocrLanguagesPrompt is the hint about the languages of --ocr-languages given
+// to the image model, so that it recognizes their diacritics.
+func (c *RenameFlags) ocrLanguagesPrompt() string {
+	if len(c.OCRLanguages) == 0 {
+		return ""
+	}
+
+	names := []string{}
+	for _, code := range c.OCRLanguages {
+		tag, err := language.Parse(strings.TrimSpace(code))
+		if err != nil {
+			names = append(names, code)
+			continue
+		}
+
+		names = append(names, display.English.Languages().Name(tag))
+	}
+
+	return "The text may be in " + strings.Join(names, ", ") + ". Transcribe its letters and diacritics exactly, such as ä, é, ß, or ç.\n"
+}
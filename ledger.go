@@ -0,0 +1,310 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ledgerEntry is a line of the ledger, recording a renamed document.
+type ledgerEntry struct {
+	Run      string                  `json:"run,omitempty"`
+	Time     time.Time               `json:"time"`
+	Source   string                  `json:"source"`
+	Filename string                  `json:"filename"`
+	Pages    int                     `json:"pages"`
+	Values   map[string]string       `json:"values"`
+	Usage    map[string]ledgerTokens `json:"usage"`
+}
+
+// ledgerTokens are the requests made to and tokens used with a model.
+type ledgerTokens struct {
+	Requests   int `json:"requests"`
+	Prompt     int `json:"prompt"`
+	Completion int `json:"completion"`
+}
+
+// documentUsage collects the tokens used for a document, by model, from the
+// completions made with its context.
+type documentUsage map[string]ledgerTokens
+
+type usageKey struct{}
+
+func withUsage(ctx context.Context, usage documentUsage) context.Context {
+	return context.WithValue(ctx, usageKey{}, usage)
+}
+
+func addUsage(ctx context.Context, model string, prompt, completion int) {
+	usage, ok := ctx.Value(usageKey{}).(documentUsage)
+	if !ok {
+		return
+	}
+
+	tokens := usage[model]
+	tokens.Requests++
+	tokens.Prompt += prompt
+	tokens.Completion += completion
+	usage[model] = tokens
+}
+
+func defaultLedgerPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find config directory: %w", err)
+	}
+
+	return filepath.Join(dir, "pdfrenamer", "ledger.jsonl"), nil
+}
+
+func (c *RenameFlags) ledgerPath() (string, error) {
+	if c.Ledger != "" {
+		return c.Ledger, nil
+	}
+
+	return defaultLedgerPath()
+}
+
+// ledgerMu serializes appends from the server's workers.
+var ledgerMu sync.Mutex
+
+// record appends the renamed document to the ledger.
+func (c *RenameFlags) record(entry ledgerEntry) error {
+	path, err := c.ledgerPath()
+	if err != nil {
+		return err
+	}
+
+	entry.Pages, err = pageCount(entry.Filename)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range []*string{&entry.Source, &entry.Filename} {
+		*name = c.location(*name)
+		if isRemote(*name) {
+			continue
+		}
+
+		*name, err = filepath.Abs(*name)
+		if err != nil {
+			return fmt.Errorf("failed to find absolute path: %w", err)
+		}
+	}
+
+	payload, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal ledger entry: %w", err)
+	}
+
+	ledgerMu.Lock()
+	defer ledgerMu.Unlock()
+
+	err = os.MkdirAll(filepath.Dir(path), 0o755)
+	if err != nil {
+		return fmt.Errorf("failed to create ledger directory: %w", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open ledger: %w", err)
+	}
+	defer file.Close()
+
+	_, err = file.Write(append(payload, '\n'))
+	if err != nil {
+		return fmt.Errorf("failed to write ledger: %w", err)
+	}
+
+	err = file.Sync()
+	if err != nil {
+		return fmt.Errorf("failed to sync ledger: %w", err)
+	}
+
+	return nil
+}
+
+func loadLedger(path string) ([]ledgerEntry, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open ledger: %w", err)
+	}
+	defer file.Close()
+
+	entries := []ledgerEntry{}
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1024*1024)
+
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var entry ledgerEntry
+
+		err := json.Unmarshal(scanner.Bytes(), &entry)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal ledger line %d: %w", line, err)
+		}
+
+		entries = append(entries, entry)
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ledger: %w", err)
+	}
+
+	return entries, nil
+}
+
+// ledgerIndices are the documents nextIndex numbered in this process, by the
+// ledger and the values they were counted by, in the order they were
+// numbered. Documents of this run are counted here rather than in the ledger,
+// so that documents renamed together, in a dry run or a plan, or by the
+// server's workers, are not given the same index before they are recorded.
+// The index of a document that is not renamed is given back, and taken by the
+// next document numbered.
+var ledgerIndices = struct {
+	sync.Mutex
+	documents map[string][]*documentIndices
+}{documents: map[string][]*documentIndices{}}
+
+// documentIndices are the indices nextIndex gave a document, by the fields it
+// was counted by. A document is numbered once, with the values it is first
+// rendered with, so rendering it again, such as with the values shortened to
+// fit the maximum length, keeps its index.
+type documentIndices struct {
+	ledger  string
+	entries []ledgerEntry
+	loaded  bool
+
+	indices map[string]int
+	groups  []string
+}
+
+func newDocumentIndices(ledger string) *documentIndices {
+	return &documentIndices{ledger: ledger, indices: map[string]int{}}
+}
+
+// next is the nextIndex template function, which numbers a document after
+// those in the ledger with the same values of the named fields, such as
+// `{{nextIndex . "Vendor" | printf "%03d"}}` for the eighth invoice of a
+// vendor rendering 008. The ledger is read once, when the function is first
+// used.
+func (d *documentIndices) next(values map[string]string, fields ...string) (int, error) {
+	if len(fields) == 0 {
+		return 0, errors.New("nextIndex needs at least one field to count documents by")
+	}
+
+	key := strings.Join(fields, "\x00")
+	if index, ok := d.indices[key]; ok {
+		return index, nil
+	}
+
+	if !d.loaded {
+		var err error
+
+		if d.ledger == "" {
+			d.ledger, err = defaultLedgerPath()
+			if err != nil {
+				return 0, err
+			}
+		}
+
+		d.entries, err = loadLedger(d.ledger)
+		if err != nil {
+			return 0, err
+		}
+
+		d.loaded = true
+	}
+
+	count := 0
+
+	for _, entry := range d.entries {
+		if entry.Run != run.ID && hasValues(sanitizeValues(entry.Values), values, fields) {
+			count++
+		}
+	}
+
+	group := d.ledger
+	for _, field := range fields {
+		group += "\x00" + field + "=" + strings.ToLower(strings.TrimSpace(values[field]))
+	}
+
+	ledgerIndices.Lock()
+	defer ledgerIndices.Unlock()
+
+	numbered := ledgerIndices.documents[group]
+
+	// an index given back is taken again
+	i := slices.Index(numbered, nil)
+	if i < 0 {
+		i = len(numbered)
+		numbered = append(numbered, nil)
+	}
+
+	numbered[i] = d
+	ledgerIndices.documents[group] = numbered
+
+	d.groups = append(d.groups, group)
+	d.indices[key] = count + i + 1
+
+	return d.indices[key], nil
+}
+
+// release gives back the indices of a document that was not renamed.
+func (d *documentIndices) release() {
+	if d == nil {
+		return
+	}
+
+	ledgerIndices.Lock()
+	defer ledgerIndices.Unlock()
+
+	for _, group := range d.groups {
+		numbered := ledgerIndices.documents[group]
+
+		i := slices.Index(numbered, d)
+		if 0 <= i {
+			numbered[i] = nil
+		}
+	}
+
+	d.groups = nil
+	clear(d.indices)
+}
+
+// hasValues reports whether the extracted values have the same values for
+// each of the fields, ignoring case and surrounding space.
+func hasValues(extracted, values map[string]string, fields []string) bool {
+	for _, field := range fields {
+		if !strings.EqualFold(strings.TrimSpace(extracted[field]), strings.TrimSpace(values[field])) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func pageCount(filename string) (int, error) {
+	doc, err := openPDF(filename)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open PDF: %w", err)
+	}
+	defer doc.Close()
+
+	return doc.NumPage(), nil
+}
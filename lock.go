@@ -0,0 +1,7 @@
+package main
+
+import "errors"
+
+// errLocked is returned when another pdfrenamer instance is already
+// processing the same document.
+var errLocked = errors.New("file is already being processed by another instance")
@@ -0,0 +1,33 @@
+//go:build !unix
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// lockFile creates a marker file next to the document, as advisory locks are
+// not available on this platform. A stale marker left by a crashed instance
+// has to be removed by hand.
+func lockFile(filename string) (func() error, error) {
+	marker := filename + ".lock"
+
+	file, err := os.OpenFile(marker, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return nil, errLocked
+		}
+
+		return nil, fmt.Errorf("failed to create lock file: %w", err)
+	}
+
+	_, _ = file.WriteString(strconv.Itoa(os.Getpid()))
+	_ = file.Close()
+
+	return func() error {
+		return os.Remove(marker)
+	}, nil
+}
@@ -0,0 +1,46 @@
+//go:build unix
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// lockFile takes an exclusive advisory lock on the document itself. The lock
+// follows the inode, so it is still held after the file has been renamed and
+// a second instance that raced us will fail to find the original path.
+func lockFile(filename string) (func() error, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file for locking: %w", err)
+	}
+
+	err = syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err != nil {
+		_ = file.Close()
+
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, errLocked
+		}
+
+		return nil, fmt.Errorf("failed to lock file: %w", err)
+	}
+
+	// another instance may have renamed the file between our open and lock
+	locked, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("failed to stat locked file: %w", err)
+	}
+
+	current, err := os.Stat(filename)
+	if err != nil || !os.SameFile(locked, current) {
+		_ = file.Close()
+		return nil, errLocked
+	}
+
+	return file.Close, nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// lookupTables are named key to value maps, loaded from user files, that
+// formats can query with `{{lookup "name" .Field}}`.
+type lookupTables map[string]map[string]string
+
+func loadLookupTables(paths map[string]string) (lookupTables, error) {
+	tables := lookupTables{}
+
+	for name, path := range paths {
+		table, err := loadMapping(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load lookup table %q: %w", name, err)
+		}
+
+		tables[name] = table
+	}
+
+	return tables, nil
+}
+
+// loadMapping reads a two column CSV file or a YAML map, normalizing keys
+// so that lookups ignore case and extra whitespace.
+func loadMapping(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open mapping: %w", err)
+	}
+	defer file.Close()
+
+	entries := map[string]string{}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		reader := csv.NewReader(file)
+		reader.FieldsPerRecord = 2
+		reader.TrimLeadingSpace = true
+
+		records, err := reader.ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CSV mapping: %w", err)
+		}
+
+		for _, record := range records {
+			entries[record[0]] = record[1]
+		}
+	default:
+		err = yaml.NewDecoder(file).Decode(&entries)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read YAML mapping: %w", err)
+		}
+	}
+
+	mapping := make(map[string]string, len(entries))
+	for key, value := range entries {
+		mapping[normalizeAlias(key)] = value
+	}
+
+	return mapping, nil
+}
+
+// lookup returns the value for key in the named table, or an empty string
+// when the key is not present so formats can fall back with `default`.
+func (l lookupTables) lookup(name, key string) (string, error) {
+	table, ok := l[name]
+	if !ok {
+		return "", fmt.Errorf("unknown lookup table %q", name)
+	}
+
+	return table[normalizeAlias(key)], nil
+}
@@ -1,234 +1,866 @@
 package main
 
 import (
-	"bytes"
 	"context"
-	"encoding/base64"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"image/jpeg"
 	"log/slog"
+	"maps"
 	"os"
-	"strconv"
+	"path/filepath"
 	"strings"
-	"text/template"
+	"time"
 
-	"github.com/Masterminds/sprig/v3"
 	"github.com/alecthomas/kong"
-	"github.com/gen2brain/go-fitz"
 	"github.com/sashabaranov/go-openai"
 )
 
 type CLI struct {
-	Filename  string `arg:"" type:"existingfile" help:"PDF file to rename"`
-	PageRange string `help:"range of pages to analyze from PDF" default:"1"`
+	Rename   RenameCmd   `cmd:"" default:"withargs" help:"rename a PDF file using information extracted from it"`
+	Template TemplateCmd `cmd:"" help:"inspect filename templates"`
+	Serve    ServeCmd    `cmd:"" help:"accept documents over HTTP and rename them in the background"`
+	Remote   RemoteCmd   `cmd:"" help:"rename a PDF file using a pdfrenamer server"`
+	Retry    RetryCmd    `cmd:"" help:"rename the documents in the quarantine directory again"`
+	SQS      SQSCmd      `cmd:"" name:"sqs" help:"rename PDFs uploaded to S3, from ObjectCreated notifications on an SQS queue"`
+	Stats    StatsCmd    `cmd:"" help:"summarize the ledger of renamed documents"`
+	Compare  CompareCmd  `cmd:"" help:"compare the names and fields extracted from a PDF by several models"`
+	Bench    BenchCmd    `cmd:"" help:"measure the latency, tokens, and cost per page of image models"`
+	Eval     EvalCmd     `cmd:"" help:"check the names and fields extracted from sample PDFs against a manifest"`
+	Plan     PlanCmd     `cmd:"" help:"print the new names of PDFs as a JSON plan, without renaming them"`
+	Apply    ApplyCmd    `cmd:"" help:"rename PDFs to the names in a plan"`
+	Scan     ScanCmd     `cmd:"" help:"scan paper with a network scanner and rename the scans"`
+	Watch    WatchCmd    `cmd:"" help:"rename the PDFs that appear in an inbox directory into an outbox"`
+	Undo     UndoCmd     `cmd:"" help:"move the documents renamed in a run back to their original names"`
+
+	RedactLogs bool `help:"keep the markdown and extracted values of documents out of the logs, logging a hash and length of them instead"`
+
+	RegisterShellExtension   registerShellExtensionFlag   `help:"add \"Rename with AI\" to the Windows Explorer context menu of PDFs, renaming with the other flags given"`
+	UnregisterShellExtension unregisterShellExtensionFlag `help:"remove \"Rename with AI\" from the Windows Explorer context menu"`
+}
+
+type RenameCmd struct {
+	Filenames []string `arg:"" help:"PDF files to rename, ZIP files of PDFs, or s3://, gs://, webdav(s)://, sftp://, or smb:// URIs of PDFs"`
+
+	Review bool `help:"open the proposed renames of the documents in $EDITOR, and rename those left in it"`
+	JSON   bool `name:"json" help:"print a line of JSON with the result of each document instead of text, for Shortcuts and Finder Quick Actions"`
+
+	SplitReceipts bool `help:"rename each receipt on a scanned page of several, such as from a flatbed scanner, as a document of its own"`
+
+	DiffFormat string `help:"how a dry run of several documents prints the renames: an aligned table of old and new names, or a shell script of mv commands" enum:"table,rename-script" default:"table"`
+
+	RenameFlags  `embed:""`
+	ZipFlags     `embed:""`
+	StorageFlags `embed:""`
+	ShardFlags   `embed:""`
+	FilterFlags  `embed:""`
+
+	// renamed holds the new name of each document, by source, for --json
+	renamed map[string]string
+	// proposed holds the renames of a dry run of several documents, printed
+	// together at the end
+	proposed []proposedRename
+}
+
+// Run renames each document. With several documents, a failure does not stop
+// the rest, and a summary of the failures is printed at the end.
+func (c *RenameCmd) Run() error {
+	ctx := context.Background()
+
+	if c.Shard.count != 0 {
+		c.Filenames = c.Shard.filter(c.Filenames)
+		slog.Info("shard", "index", c.Shard.index, "count", c.Shard.count, "documents", len(c.Filenames))
+
+		if len(c.Filenames) == 0 {
+			return fmt.Errorf("no documents in shard %d/%d: %w", c.Shard.index, c.Shard.count, errNothingToDo)
+		}
+	}
+
+	filtered := c.FilterFlags.filter(c.Filenames)
+	if len(filtered) == 0 {
+		return fmt.Errorf("no documents left after the filters: %w", errNothingToDo)
+	}
+
+	c.order(filtered)
+	c.Filenames = filtered
+
+	if c.JSON {
+		return c.renameJSON(ctx)
+	}
+
+	if c.Review {
+		return c.review(ctx)
+	}
+
+	if len(c.Filenames) == 1 {
+		err := c.renameDocument(ctx, c.Filenames[0])
+		if err != nil {
+			run.failed(c.Filenames[0], err)
+		}
+
+		return err
+	}
+
+	results := &batch{}
+
+	for _, filename := range c.Filenames {
+		results.add(filename, c.renameDocument(ctx, filename))
+	}
+
+	if len(c.proposed) > 0 {
+		err := c.printDiff(os.Stdout)
+		if err != nil {
+			return fmt.Errorf("failed to write renames: %w", err)
+		}
+	}
+
+	results.summarize(os.Stderr)
+
+	return results.err()
+}
+
+func (c *RenameCmd) renameDocument(ctx context.Context, source string) error {
+	if !isRemote(source) {
+		info, err := os.Stat(source)
+		if err != nil {
+			return fmt.Errorf("failed to open document: %w", err)
+		}
+
+		if info.IsDir() {
+			return fmt.Errorf("%q is a directory", source)
+		}
+	}
+
+	if strings.EqualFold(filepath.Ext(source), ".zip") {
+		if c.Destination != "" {
+			return errors.New("ZIP input uses --zip-extract or --zip-output instead of --destination")
+		}
+
+		return c.renameZip(ctx, source)
+	}
+
+	if isRemote(source) || isRemote(c.Destination) {
+		err := c.renameObject(ctx, source)
+		if err != nil && !isRemote(source) {
+			return errors.Join(err, c.quarantine(source, c.Destination, err))
+		}
+
+		return err
+	}
+
+	if c.SplitReceipts {
+		split, err := c.renameReceipts(ctx, source)
+		if split {
+			return err
+		}
+		if err != nil {
+			return errors.Join(err, c.quarantine(source, c.Destination, err))
+		}
+	}
+
+	flags := c.RenameFlags
+	flags.dir = c.Destination
+
+	filename, err := flags.rename(ctx, source)
+	if err != nil {
+		return errors.Join(err, c.quarantine(source, c.Destination, err))
+	}
+
+	c.report(source, filename)
+
+	return nil
+}
+
+// report prints the new name of a document in a dry run, or keeps it to print
+// with the others when there are several documents. With --json, it is kept
+// for the document's result instead.
+func (c *RenameCmd) report(source, filename string) {
+	if c.JSON {
+		c.renamed[source] = filename
+		return
+	}
+
+	if !c.DryRun {
+		return
+	}
+
+	if len(c.Filenames) == 1 {
+		fmt.Println(filename)
+		return
+	}
+
+	c.proposed = append(c.proposed, proposedRename{source: source, filename: filename})
+}
+
+type RenameFlags struct {
+	PageRange string `help:"pages to analyze from the PDF, counting from 1: a page such as 1, pages such as 2-5, pages to the end such as 3-, or all" default:"1"`
+	MaxPages  int    `help:"most pages to convert of a document, so a long scan does not run up the provider's bill (0 for no limit)" default:"100"`
+	MaxChars  int    `help:"most characters of a document's markdown to send to the text model (0 for no limit)" default:"200000"`
 
 	Endpoint string `help:"OpenAI endpoint"`
 	ApiKey   string `help:"OpenAI API key"`
 
+	Bedrock       bool   `help:"send the requests to AWS Bedrock's Converse API, signed with the AWS credentials of the environment, with Bedrock model IDs as the models and --endpoint as a VPC endpoint of Bedrock"`
+	BedrockRegion string `help:"AWS region of Bedrock (defaults to AWS_REGION)"`
+
+	CacheControl bool `help:"mark the system prompts with cache_control, so Claude models cache them as OpenAI does on its own"`
+
+	Header   map[string]string `help:"extra HTTP headers to send to the provider, such as a gateway's metadata, e.g. X-Title=pdfrenamer"`
+	Provider map[string]string `help:"providers a gateway such as OpenRouter routes a model to, in order of preference, e.g. anthropic/claude-sonnet-4=anthropic,amazon-bedrock"`
+
 	ImageModel string `help:"OpenAI image model" default:"gpt-4o-mini" required:""`
 	TextModel  string `help:"OpenAI text model" default:"gpt-4o-mini" required:""`
 
-	Format string `help:"format of the file to rename to" default:"{{.Title}}.pdf"`
-	Prompt string `help:"additional info prompt to use to extract text from PDF" default:""`
+	EscalateModel string `help:"stronger image model to convert a page again with when the image model returns little or no text for it, or refuses, e.g. gpt-4o"`
+	EscalateBelow int    `help:"letters and digits a page's markdown needs to not be escalated to --escalate-model" default:"20"`
+
+	OCRLanguages []string `help:"languages of the documents, as ISO 639-1 codes such as de,fr, to improve recognition of diacritics" name:"ocr-languages"`
+
+	RequestsPerMinute int `help:"maximum requests to the provider per minute, shared by all workers" name:"rpm"`
+	TokensPerMinute   int `help:"maximum tokens used with the provider per minute, shared by all workers" name:"tpm"`
+
+	BreakerThreshold int           `help:"consecutive provider failures that pause all requests, 0 to never pause" default:"5"`
+	BreakerCooldown  time.Duration `help:"first pause after provider failures, doubling while they continue" default:"30s"`
+
+	TemplateFlags `embed:""`
+
+	Prompt string `help:"additional info prompt to use to extract text from PDF, a template with .OriginalName, .SourceFolder, .ScanDate, and .Language" default:""`
+
+	OriginalName bool `help:"include the original filename in the extraction request, as scanners often put the date or a job number in it" default:"true" negatable:""`
+
+	MatchFields    []string `help:"fields to fuzzy match against values from past runs, e.g. Vendor"`
+	MatchThreshold float64  `help:"minimum similarity (0 to 1) to reuse a value from past runs" default:"0.85"`
+	KnownFile      string   `help:"file storing values from past runs (defaults to the user config directory)" type:"path"`
+
+	CorrectionsFile string `help:"file storing the names corrected in --review or a plan, as examples for later extractions (defaults to the user config directory)" type:"path"`
+	Corrections     int    `help:"number of the most recent corrections to show the text model as examples (0 to show none)" default:"5"`
+
+	Addressees       string `help:"CSV or YAML table mapping addressee names to folders to file documents into" type:"existingfile"`
+	AddresseeDefault string `help:"folder for documents whose addressee is not in --addressees"`
+
+	Categories []string `help:"fixed set of categories to classify documents into, as .Category, e.g. invoice,receipt,contract"`
+
+	TranslateFields map[string]string `help:"translate extracted values into a language, e.g. to=en, optionally only some fields with fields=Title,Vendor"`
+
+	TouchDate string `help:"extracted field with the document date to set as the modification time of the renamed file"`
+
+	OwnershipFlags `embed:""`
+
+	Git bool `help:"use git mv when the file is tracked by a git repository"`
+
+	Tables      bool `help:"write the tables in the document, such as statement or invoice lines, as CSV files next to the renamed file"`
+	Attachments bool `help:"write the files embedded in the document, such as e-invoice XML, next to the renamed file"`
+	DedupePages bool `help:"remove the pages that repeat the page before them, such as a sheet the scanner fed twice, from the renamed file (needs qpdf)"`
+	Companions  bool `help:"rename the files sharing the document's base name along with it, such as scan001.xml for scan001.pdf"`
+
+	NoVision bool `help:"convert pages without the image model, from their text layer, or with Tesseract for scans, for providers without a vision model" name:"no-vision"`
+
+	OCR string `help:"how pages are converted to markdown: by the image model (chat), or by Mistral's document OCR endpoint with --image-model mistral-ocr-latest (mistral)" enum:"chat,mistral" default:"chat" name:"ocr"`
+
+	VisionInput string `help:"how pages are sent to the image model: as base64 data URLs (data-url), uploaded to the provider's file API with the Responses API (file), or as the whole PDF uploaded in one request (document)" enum:"data-url,file,document" default:"data-url"`
+
+	Preview  bool          `help:"show the markdown of each page as it arrives, when stderr is a terminal"`
+	SkipPage []pagePattern `help:"regular expressions of pages to leave out of the document, such as terms and conditions, cancelling a page's conversion once its markdown matches"`
+
+	PageRegion pageRegion `help:"part of each page to send to the image model, such as the letterhead for the title and date of a long letter: top-half, top-third, top-quarter, bottom-half, bottom-third, left-half, right-half, or left,top,right,bottom in fractions of the page, e.g. 0,0,1,0.2"`
+
+	Hybrid bool `help:"send pages that have a text layer as their text with a low-detail image, which is cheaper and exact for documents that are not scans"`
+
+	EInvoice bool `help:"use the values of an embedded ZUGFeRD, Factur-X, or XRechnung e-invoice, without the provider when it has every field of the format" name:"e-invoice"`
+
+	Patterns string `help:"YAML file of regular expressions for fields, matched in the markdown to fill what the model left out, replace what it extracted, or check it" type:"existingfile"`
+
+	Clarifications int `help:"number of follow-up requests for fields missing from the extraction" default:"1"`
+
+	GroundFields []string `help:"fields whose values must appear in the document's text, as the same words, date, or amount, e.g. Date,Total,Vendor, as the text model may make them up"`
+	Ungrounded   string   `help:"what to do with a document whose --ground-fields values are not in its text: log a warning (warn), leave it for review like documents below --auto-threshold (review), or fail it (reject)" enum:"warn,review,reject" default:"review"`
+
+	Rules string `help:"YAML file of sanity checks of extracted values, such as the minimum of an amount, how many years back a date may be, or the allowed currencies, leaving documents that fail them for review" type:"existingfile"`
+
+	AutoThreshold float64 `help:"minimum confidence (0 to 1) the text model reports in its values to rename a document automatically, leaving the others in place or moving them to --review-dir"`
+	ReviewDir     string  `help:"directory to move documents below --auto-threshold, with --ground-fields values not in their text, or failing --rules, into, along with a .error.json file with the rename proposed for them" type:"path"`
+
+	QuarantineDir string `help:"directory to move documents that fail to be renamed into, along with a .error.json file describing the failure" type:"path"`
+	CacheDir      string `help:"directory to cache the markdown of documents in, so that retries do not convert them again" type:"path"`
+	ImageDir      string `help:"directory to write rendered page images to instead of keeping them in memory, reusing them when a document is retried" type:"path"`
+
+	Ledger  string `help:"JSON lines file recording each renamed document, for stats (defaults to the user config directory)" type:"path"`
+	RunsDir string `help:"directory to write the manifest of each run into, for retry --run and undo --run (defaults to the user config directory)" type:"path"`
 
 	DryRun bool `help:"do not rename files, just print what would be done"`
+
+	// dir is the directory rendered filenames are relative to, instead of
+	// the working directory.
+	dir string
+	// originalName is the name the document had before it was staged, such
+	// as the name of an upload or a ZIP entry.
+	originalName string
+	// locate returns where a staged file is filed, such as the URI of an
+	// object, for the run manifest and the ledger.
+	locate func(filename string) string
+}
+
+// analysis is what was read from a document and extracted from it.
+type analysis struct {
+	Markdown string            `json:"markdown"`
+	Values   map[string]string `json:"values"`
+	// Ungrounded are the fields of --ground-fields whose values are not in
+	// the markdown.
+	Ungrounded []string `json:"ungrounded,omitempty"`
+	// Violations are how the values break the rules of --rules.
+	Violations []string `json:"violations,omitempty"`
+
+	template *filenameTemplate
 }
 
-func (c *CLI) Run() error {
-	startPage, endPage := 0, 0
-	pageRange := strings.Split(c.PageRange, "-")
-	if len(pageRange) == 1 {
-		startPage = 0
-		endPage = 0
-	} else if len(pageRange) == 2 {
-		startPage, _ = strconv.Atoi(pageRange[0])
-		endPage, _ = strconv.Atoi(pageRange[0])
+func (c *RenameFlags) client() *openai.Client {
+	config := openai.DefaultConfig(c.ApiKey)
+	config.BaseURL = c.Endpoint
+
+	config.HTTPClient = c.httpClient()
+
+	return openai.NewClientWithConfig(config)
+}
+
+// analyze converts the PDF to markdown and extracts the values for the
+// filename format from it, without renaming anything.
+func (c *RenameFlags) analyze(ctx context.Context, source string) (_ *analysis, err error) {
+	ctx, span := startSpan(ctx, "analyze", "source", source)
+	defer func() { span.finish(err) }()
+
+	filenameTemplate, err := c.parseTemplate()
+	if err != nil {
+		return nil, templateError{err}
 	}
 
-	doc, err := fitz.New(c.Filename)
+	info, err := c.documentInfo(source)
 	if err != nil {
-		return fmt.Errorf("failed to open PDF: %w", err)
+		return nil, err
 	}
-	defer doc.Close()
 
-	config := openai.DefaultConfig(c.ApiKey)
-	config.BaseURL = c.Endpoint
-	openAIClient := openai.NewClientWithConfig(config)
+	var invoice map[string]string
+	if c.EInvoice {
+		invoice, _ = eInvoiceValues(source)
+	}
 
-	chunks := []string{}
+	// e-invoices are exact, and free to read
+	if invoice != nil && len(missingFields(filenameTemplate.Template, invoice)) == 0 {
+		slog.Info("einvoice.values", "values", invoice)
 
-	slog.Info("pdf.process", "start", startPage, "end", endPage)
+		err = c.classify(invoice)
+		if err != nil {
+			return nil, err
+		}
 
-	// for each page of the PDF convert to image
-	for n := 0; n < doc.NumPage(); n++ {
-		if n < startPage {
-			slog.Info("pdf.skip", "page", n)
-			continue
+		if 0 < c.AutoThreshold {
+			invoice[confidenceField] = "1"
+		}
+
+		violations, err := c.ruleViolations(invoice)
+		if err != nil {
+			return nil, err
 		}
-		if endPage < n {
-			slog.Info("pdf.end", "page", n)
-			break
-		}
-
-		slog.Info("pdf.open", "page", n)
-
-		image, err := doc.Image(n)
-		if err != nil {
-			return fmt.Errorf("failed to convert page #%d to image: %w", n, err)
-		}
-
-		slog.Info("pdf.image", "page", n)
-
-		file := &bytes.Buffer{}
-
-		err = jpeg.Encode(file, image, &jpeg.Options{Quality: 100})
-		if err != nil {
-			return fmt.Errorf("failed to encode image #%d: %w", n, err)
-		}
-
-		slog.Info("pdf.markdown", "page", n)
-
-		encodedImage := base64.StdEncoding.EncodeToString(file.Bytes())
-
-		const promptPDFtoMarkdown = `
-You are tasked with converting an image of a page from a PDF document into a markdown text representation. Follow these strict guidelines to ensure accuracy and consistency:
-1. Include **all visible content from the page** without omitting or altering any information for privacy or any other reasons. 
-2. **Preserve the original structure** and intent of the document:
-   - Convert headings to appropriate markdown heading levels ('#', '##', etc.), ensuring a blank line before and after each heading.
-   - Keep paragraphs intact, ensuring no line breaks occur within words (e.g., "cor- rect" becomes "correct").
-   - Reformat lists into proper markdown syntax:
-     - Unordered lists: '-' or '*'
-     - Ordered lists: '1.', '2.', etc.
-3. Apply markdown formatting to enhance readability:
-   - Use '*italic*' and '**bold**' where present in the original content.
-   - Convert tables into markdown table format. Retain all rows and columns as they appear.
-4. Identify and **clearly mark headers, footers, and page numbers** as blockquotes ('>') but do not remove them.
-5. Strictly preserve original punctuation and capitalization:
-   - Do not add punctuation or modify the existing punctuation.
-   - Maintain original text flow without introducing unnecessary explanations.
-6. Handle duplicate content carefully:
-   - Remove only **exact or near-exact duplicates** within the page.
-   - Cross-check the context (before and after the main chunk) to avoid accidental removal of meaningful content.
-   - If no duplicates are identified, return the content as is.
-7. Avoid injecting additional content:
-   - Do not add introductory text like "Here is the converted text" or similar phrases.
-   - Ensure the output contains only the content extracted from the image.
-`
-
-		response, err := openAIClient.CreateChatCompletion(
-			context.Background(),
-			openai.ChatCompletionRequest{
-				Model: c.ImageModel,
-				Messages: []openai.ChatCompletionMessage{
-					{
-						Role:    "system",
-						Content: promptPDFtoMarkdown,
-					},
-					{
-						Role: "user",
-						MultiContent: []openai.ChatMessagePart{
-							{
-								Type: "image_url",
-								ImageURL: &openai.ChatMessageImageURL{
-									URL:    "data:image/jpeg;base64," + encodedImage,
-									Detail: openai.ImageURLDetailAuto,
-								},
-							},
-						},
-					},
-				},
-			},
-		)
-		if err != nil {
-			return fmt.Errorf("failed to convert image #%d to markdown: %w", n, err)
-		}
-
-		chunks = append(chunks, response.Choices[0].Message.Content)
-	}
-
-	markdown := strings.Join(chunks, "\n\n")
-	slog.Info("extract", "prompt", c.Prompt, "format", c.Format, "markdown", markdown)
-
-	// for all markdown use OpenAI text model to extract
-	response, err := openAIClient.CreateChatCompletion(
-		context.Background(),
-		openai.ChatCompletionRequest{
-			Model: c.TextModel,
-			Messages: []openai.ChatCompletionMessage{
-				{
-					Role: "system",
-					Content: fmt.Sprintf(`
-You are provided with a markdown document, and your task is to extract specific information to generate a JSON object. The extracted information will be used to construct a filename using a Go 'text/template' format. Follow these instructions precisely:
-1. **Understand the provided context:**
-	- The user has requested specific guidance for extraction: '%s'.   
-	- The filename format is: '%s'.
-2. Extract the required fields from the markdown document:
-   - Each field corresponds to a key in the filename template (e.g., '{{.Title}}').
-   - Ensure that the extracted fields strictly match the case of the keys in the template.
-3. Output the extracted data as a valid JSON object:
-   - Use string key-value pairs only.
-   - For example, if the format is '{{.Title | snakecase}}', output should be: '{"Title": "My Title"}'.
-4. Do not include any extraneous explanation, commentary, or additional data outside the JSON object.
-5. Handle potential variations in the markdown document:
-   - If a field is missing or ambiguous, make a **best effort** to infer it based on the surrounding context.
-   - If inference is not possible, exclude the field from the output.
-6. Validate the JSON structure before returning it:
-   - Ensure the output is properly formatted and parsable.
-					`, c.Prompt, c.Format),
-				},
-				{
-					Role:    "user",
-					Content: markdown,
-				},
-			},
-			ResponseFormat: &openai.ChatCompletionResponseFormat{
-				Type: openai.ChatCompletionResponseFormatTypeJSONObject,
-			},
-		},
-	)
-	if err != nil {
-		return fmt.Errorf("failed to extract information from markdown: %w", err)
-	}
-
-	payload := response.Choices[0].Message.Content
-	slog.Info("extracted", "payload", payload)
-
-	var values map[string]string
-	err = json.Unmarshal([]byte(payload), &values)
-	if err != nil {
-		return fmt.Errorf("failed to unmarshal JSON payload: %w", err)
-	}
-
-	template, err := template.New("filename").Funcs(sprig.FuncMap()).Parse(c.Format)
-	if err != nil {
-		return fmt.Errorf("failed to parse filename format: %w", err)
-	}
-
-	filename := &strings.Builder{}
-	err = template.Execute(filename, values)
-	if err != nil {
-		return fmt.Errorf("failed to execute filename format: %w", err)
+
+		return &analysis{
+			Values:     invoice,
+			Violations: violations,
+			template:   filenameTemplate,
+		}, nil
+	}
+
+	openAIClient := c.client()
+
+	markdownCtx, markdownSpan := startSpan(ctx, "markdown", "source", source)
+	markdown, err := c.cachedMarkdown(markdownCtx, openAIClient, source)
+	markdownSpan.finish(err)
+	if err != nil {
+		return nil, err
+	}
+
+	markdown = c.truncate(source, markdown)
+
+	info.Language = detectLanguage(markdown)
+	slog.Info("language", "language", info.Language)
+
+	prompt, err := c.prompt(info)
+	if err != nil {
+		return nil, templateError{err}
+	}
+
+	slog.Info("extract", "prompt", prompt, "format", c.format(), "markdown", markdown)
+
+	extractCtx, extractSpan := startSpan(ctx, "extract")
+	values, err := c.extract(extractCtx, openAIClient, info, prompt, markdown)
+	extractSpan.finish(err)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.Language != "" {
+		values["Language"] = info.Language
+	}
+
+	maps.Copy(values, invoice)
+
+	// patterns fill fields before the model is asked for them again
+	err = c.applyPatterns(markdown, values)
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.checkDocDates(markdown, info, values)
+	if err != nil {
+		return nil, err
+	}
+
+	template := filenameTemplate.Template
+
+	missing := missingFields(template, values)
+	for attempt := 0; 0 < len(missing) && attempt < c.Clarifications; attempt++ {
+		slog.Info("clarify", "attempt", attempt, "missing", missing)
+
+		clarifyCtx, clarifySpan := startSpan(ctx, "clarify", "attempt", attempt)
+		clarified, err := c.clarify(clarifyCtx, openAIClient, info, prompt, markdown, values, missing)
+		clarifySpan.finish(err)
+		if err != nil {
+			return nil, err
+		}
+
+		maps.Copy(values, clarified)
+		missing = missingFields(template, values)
+	}
+
+	c.fallbackDocDate(values)
+
+	// values are checked before they are translated, as they are written in
+	// the document's language
+	ungrounded, err := c.ground(markdown, values)
+	if err != nil {
+		return nil, err
+	}
+
+	violations, err := c.ruleViolations(values)
+	if err != nil {
+		return nil, err
+	}
+
+	translateCtx, translateSpan := startSpan(ctx, "translate")
+	err = c.translate(translateCtx, openAIClient, info.Language, values)
+	translateSpan.finish(err)
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.classify(values)
+	if err != nil {
+		return nil, err
+	}
+
+	return &analysis{
+		Markdown:   markdown,
+		Values:     values,
+		Ungrounded: ungrounded,
+		Violations: violations,
+		template:   filenameTemplate,
+	}, nil
+}
+
+// rename extracts information from the PDF and renames it, returning the
+// new filename. Nothing is renamed in a dry run.
+func (c *RenameFlags) rename(ctx context.Context, source string) (filename string, err error) {
+	ctx, span := startSpan(ctx, "rename", "source", source, "dry_run", c.DryRun)
+	defer func() {
+		span.set("filename", filename)
+		span.finish(err)
+	}()
+
+	usage := documentUsage{}
+	ctx = withUsage(ctx, usage)
+
+	unlock, err := lockFile(source)
+	if err != nil {
+		return "", fmt.Errorf("failed to acquire lock: %w", err)
+	}
+	defer func() { _ = unlock() }()
+
+	plan, err := c.planRename(ctx, source)
+	if err != nil {
+		return "", err
+	}
+
+	defer func() {
+		if err != nil {
+			plan.indices.release()
+		}
+	}()
+
+	err = c.checkConfidence(plan)
+	if err != nil {
+		return "", err
+	}
+
+	err = c.checkGrounding(plan)
+	if err != nil {
+		return "", err
+	}
+
+	err = c.checkRules(plan)
+	if err != nil {
+		return "", err
 	}
 
 	if c.DryRun {
-		fmt.Println(filename.String())
-	} else {
-		err = os.Rename(c.Filename, filename.String())
+		// reports what the rename would fail on
+		_, _, err = c.prepare(plan.Values)
+		if err != nil {
+			return "", err
+		}
+
+		return plan.Filename, nil
+	}
+
+	plan.Usage = usage
+
+	err = c.applyRename(ctx, plan)
+	if err != nil {
+		return "", err
+	}
+
+	return plan.Filename, nil
+}
+
+// plannedRename is the new name of a document and what it was extracted
+// from, decided before anything is moved.
+type plannedRename struct {
+	Source   string            `json:"source"`
+	SHA256   string            `json:"sha256,omitempty"`
+	Filename string            `json:"filename"`
+	Proposed string            `json:"proposed,omitempty"`
+	Values   map[string]string `json:"values"`
+	Markdown string            `json:"markdown,omitempty"`
+	Usage    documentUsage     `json:"usage,omitempty"`
+
+	// ungrounded are the fields whose values are not in the document, and
+	// violations how they break the rules.
+	ungrounded []string
+	violations []string
+
+	// indices are the indices nextIndex gave the document, given back when
+	// it is not renamed.
+	indices *documentIndices
+}
+
+// planRename extracts the values of the document and renders its new name,
+// without moving anything.
+func (c *RenameFlags) planRename(ctx context.Context, source string) (_ *plannedRename, err error) {
+	analysis, err := c.cachedAnalysis(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+
+	filenameTemplate, values := analysis.template, analysis.Values
+
+	defer func() {
+		if err != nil {
+			filenameTemplate.indices.release()
+		}
+	}()
+
+	known, _, err := c.loadKnownValues()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, field := range c.MatchFields {
+		value, ok := values[field]
+		if !ok {
+			continue
+		}
+
+		if match, ok := known.match(field, value, c.MatchThreshold); ok {
+			slog.Info("match", "field", field, "value", value, "known", match)
+			values[field] = match
+		}
+	}
+
+	err = filenameTemplate.clean(values)
+	if err != nil {
+		return nil, templateError{err}
+	}
+
+	filename, err := filenameTemplate.render(values)
+	if err != nil {
+		return nil, templateError{err}
+	}
+
+	err = validateFilename(filenameTemplate, c.dir, filename)
+	if err != nil {
+		return nil, templateError{fmt.Errorf("failed to validate filename: %w", err)}
+	}
+
+	if c.Addressees != "" {
+		folders, err := loadAddresseeFolders(c.Addressees)
+		if err != nil {
+			return nil, err
+		}
+
+		filename = c.route(folders, values["Addressee"], filename)
+	}
+
+	if !filepath.IsAbs(filename) {
+		filename = filepath.Join(c.dir, filename)
+	}
+
+	return &plannedRename{
+		Source:   source,
+		Filename: filename,
+		Values:   values,
+		Markdown: analysis.Markdown,
+
+		ungrounded: analysis.Ungrounded,
+		violations: analysis.Violations,
+		indices:    filenameTemplate.indices,
+	}, nil
+}
+
+// prepare resolves the options applied to the renamed file, so that they
+// fail before it is moved.
+func (c *RenameFlags) prepare(values map[string]string) (time.Time, ownership, error) {
+	var touchDate time.Time
+	if c.TouchDate != "" {
+		dates, err := c.dates()
+		if err != nil {
+			return touchDate, ownership{}, err
+		}
+
+		touchDate, err = dates.parse(values[c.TouchDate])
+		if err != nil {
+			return touchDate, ownership{}, fmt.Errorf("failed to parse %s: %w", c.TouchDate, err)
+		}
+	}
+
+	resolved, err := c.OwnershipFlags.resolve()
+	if err != nil {
+		return touchDate, ownership{}, err
+	}
+
+	return touchDate, resolved, nil
+}
+
+// applyRename moves the document to its planned name and writes the files
+// that go with it.
+func (c *RenameFlags) applyRename(ctx context.Context, plan *plannedRename) (err error) {
+	source, filename, values := plan.Source, plan.Filename, plan.Values
+
+	touchDate, ownership, err := c.prepare(values)
+	if err != nil {
+		return err
+	}
+
+	known, knownPath, err := c.loadKnownValues()
+	if err != nil {
+		return err
+	}
+
+	for _, field := range c.MatchFields {
+		known.add(field, values[field])
+	}
+
+	// found before the document is moved, which may be next to them
+	var companionFiles []string
+	if c.Companions {
+		companionFiles, err = companions(source)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, move := startSpan(ctx, "move", "filename", filename)
+	err = c.move(source, filename)
+	move.finish(err)
+	if err != nil {
+		return fmt.Errorf("failed to rename file: %w", err)
+	}
+
+	run.renamed(c.location(source), c.location(filename))
+
+	defer func() {
+		if err != nil {
+			err = renamedError{err}
+		}
+	}()
+
+	// the document is already renamed, so duplicate pages that cannot be
+	// removed do not fail it
+	if c.DedupePages {
+		removed, err := dedupePages(filename)
+		if err != nil {
+			slog.Warn("dedupe", "filename", filename, "error", err)
+		} else if 0 < len(removed) {
+			slog.Info("dedupe", "filename", filename, "pages", removed)
+		}
+	}
+
+	if c.TouchDate != "" {
+		err = os.Chtimes(filename, time.Time{}, touchDate)
+		if err != nil {
+			return fmt.Errorf("failed to set modification time: %w", err)
+		}
+	}
+
+	err = ownership.apply(filename)
+	if err != nil {
+		return err
+	}
+
+	sidecars, err := c.moveCompanions(source, filename, companionFiles)
+	if err != nil {
+		return err
+	}
+
+	if c.Tables {
+		tables, err := writeTables(filename, plan.Markdown)
+		if err != nil {
+			return err
+		}
+
+		sidecars = append(sidecars, tables...)
+	}
+
+	if c.Attachments {
+		attachments, err := writeAttachments(filename)
+		if err != nil {
+			return err
+		}
+
+		sidecars = append(sidecars, attachments...)
+	}
+
+	for _, sidecar := range sidecars {
+		err = ownership.apply(sidecar)
 		if err != nil {
-			return fmt.Errorf("failed to rename file: %w", err)
+			return err
 		}
 	}
 
+	if 0 < len(c.MatchFields) {
+		err = known.save(knownPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	// the document is already renamed, so a ledger that cannot be
+	// written does not fail it
+	err = c.record(ledgerEntry{
+		Run:      run.ID,
+		Time:     time.Now(),
+		Source:   source,
+		Filename: filename,
+		Values:   values,
+		Usage:    plan.Usage,
+	})
+	if err != nil {
+		slog.Error("ledger.record", "filename", filename, "error", err)
+	}
+
 	return nil
 }
 
+// location returns where a file is filed, which for a staged document is in
+// remote storage rather than the staging directory.
+func (c *RenameFlags) location(filename string) string {
+	if c.locate == nil {
+		return filename
+	}
+
+	return c.locate(filename)
+}
+
+// checkRemote refuses the flags that only apply to local files, for documents
+// renamed in or filed into remote storage. Their files would be left in the
+// staging directory, rather than filed with the document.
+func (c *RenameFlags) checkRemote() error {
+	flags := []string{}
+
+	for _, flag := range []struct {
+		name string
+		set  bool
+	}{
+		{"--tables", c.Tables},
+		{"--attachments", c.Attachments},
+		{"--companions", c.Companions},
+		{"--git", c.Git},
+		{"--touch-date", c.TouchDate != ""},
+		{"--chmod", c.Chmod != ""},
+		{"--chown", c.Chown != ""},
+		{"--read-only", c.ReadOnly},
+		{"--immutable", c.Immutable},
+	} {
+		if flag.set {
+			flags = append(flags, flag.name)
+		}
+	}
+
+	if 0 < len(flags) {
+		return fmt.Errorf("%s only apply to local files, not remote storage", strings.Join(flags, ", "))
+	}
+
+	return nil
+}
+
+// move renames the file to filename, staging the rename in git if requested.
+func (c *RenameFlags) move(source, filename string) error {
+	err := os.MkdirAll(filepath.Dir(filename), 0o755)
+	if err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	// documents that extract to the same name, such as two in one ZIP, must
+	// not overwrite each other
+	err = refuseOverwrite(source, filename)
+	if err != nil {
+		return err
+	}
+
+	if c.Git {
+		moved, err := gitRename(source, filename)
+		if err != nil || moved {
+			return err
+		}
+	}
+
+	return renameFile(source, filename)
+}
+
 func main() {
-	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+	slog.SetDefault(newLogger(os.Stderr, false))
 
 	cli := &CLI{}
 	ctx := kong.Parse(cli)
+
+	if cli.RedactLogs {
+		slog.SetDefault(newLogger(os.Stderr, true))
+		redactLogs = true
+	}
+
+	// a run that cannot be recorded still renames documents
+	err := run.start(ctx)
+	if err != nil {
+		slog.Error("run.manifest", "error", err)
+	}
+
 	// Call the Run() method of the selected parsed command.
-	err := ctx.Run()
-	ctx.FatalIfErrorf(err)
+	err = ctx.Run()
+
+	// the documents are already renamed, so a manifest that cannot be
+	// written does not fail the run
+	serr := run.save(err)
+	if serr != nil {
+		slog.Error("run.manifest", "error", serr)
+	}
+
+	if err != nil {
+		ctx.Errorf("%s", errorText(err))
+		ctx.Exit(exitCode(err))
+	}
 }
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+	"golang.org/x/text/message/catalog"
+	"gopkg.in/yaml.v3"
+)
+
+// builtinMessages translate the user-facing messages, keyed by the English
+// message. More languages, or changes to these, can be loaded from the YAML
+// file in PDFRENAMER_MESSAGES, in the same shape.
+var builtinMessages = map[string]map[string]string{
+	"de": {
+		"renamed %d of %d documents": "%d von %d Dokumenten umbenannt",
+		"failed: %s":                 "fehlgeschlagen: %s",
+		"%d of %d documents failed":  "%d von %d Dokumenten fehlgeschlagen",
+		failureProvider:              "Anbieter",
+		failureTemplate:              "Vorlage",
+		failureFilesystem:            "Dateisystem",
+		failureLocked:                "gesperrt",
+		failureReview:                "Prüfung",
+		failureOther:                 "andere",
+	},
+	"fr": {
+		"renamed %d of %d documents": "%[1]d documents renommés sur %[2]d",
+		"failed: %s":                 "échecs : %s",
+		"%d of %d documents failed":  "%[1]d documents sur %[2]d en échec",
+		failureProvider:              "fournisseur",
+		failureTemplate:              "modèle",
+		failureFilesystem:            "système de fichiers",
+		failureLocked:                "verrouillé",
+		failureReview:                "à vérifier",
+		failureOther:                 "autre",
+	},
+}
+
+// printer prints user-facing messages in the language of the locale.
+var printer = newPrinter()
+
+func newPrinter() *message.Printer {
+	messages := builtinMessages
+
+	if path := os.Getenv("PDFRENAMER_MESSAGES"); path != "" {
+		loaded, err := loadMessages(path)
+		if err != nil {
+			slog.Error("messages.load", "path", path, "error", err)
+		}
+
+		for code, translations := range loaded {
+			if messages[code] == nil {
+				messages[code] = map[string]string{}
+			}
+
+			for key, translation := range translations {
+				messages[code][key] = translation
+			}
+		}
+	}
+
+	builder := catalog.NewBuilder(catalog.Fallback(language.English))
+	supported := []language.Tag{language.English}
+
+	for code, translations := range messages {
+		tag, err := language.Parse(code)
+		if err != nil {
+			slog.Error("messages.language", "language", code, "error", err)
+			continue
+		}
+
+		for key, translation := range translations {
+			_ = builder.SetString(tag, key, translation)
+		}
+
+		supported = append(supported, tag)
+	}
+
+	_, index, _ := language.NewMatcher(supported).Match(localeTag())
+
+	return message.NewPrinter(supported[index], message.Catalog(builder))
+}
+
+func loadMessages(path string) (map[string]map[string]string, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read messages: %w", err)
+	}
+
+	messages := map[string]map[string]string{}
+
+	err = yaml.Unmarshal(contents, &messages)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal messages: %w", err)
+	}
+
+	return messages, nil
+}
+
+// localeTag is the language of the POSIX locale variables, such as
+// LANG=de_DE.UTF-8.
+func localeTag() language.Tag {
+	for _, name := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		locale := os.Getenv(name)
+		if locale == "" {
+			continue
+		}
+
+		locale, _, _ = strings.Cut(locale, ".")
+		locale, _, _ = strings.Cut(locale, "@")
+
+		tag, err := language.Parse(strings.ReplaceAll(locale, "_", "-"))
+		if err == nil {
+			return tag
+		}
+	}
+
+	return language.English
+}
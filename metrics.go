@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// latencyBuckets are the upper bounds, in seconds, of the API latency
+// histogram. Vision requests for a page commonly take several seconds.
+var latencyBuckets = []float64{0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120}
+
+// metrics are the counters exposed in the Prometheus text format by the
+// server's /metrics endpoint.
+var metrics = &metricsRegistry{
+	documents: map[string]int{},
+	failures:  map[string]int{},
+	tokens:    map[string]int{},
+	requests:  map[string]int{},
+	latency:   map[string]*histogram{},
+}
+
+type metricsRegistry struct {
+	mu sync.Mutex
+
+	// documents by result, and failures by kind
+	documents map[string]int
+	failures  map[string]int
+
+	// keyed by their rendered labels: tokens by model and type (prompt or
+	// completion), requests by stage, model, and result, and latency by
+	// stage and model
+	tokens   map[string]int
+	requests map[string]int
+	latency  map[string]*histogram
+
+	queueDepth func() int
+}
+
+type histogram struct {
+	counts []int
+	count  int
+	sum    float64
+}
+
+// document records the result of renaming a document.
+func (m *metricsRegistry) document(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err == nil {
+		m.documents["renamed"]++
+		return
+	}
+
+	m.documents["failed"]++
+	m.failures[failureKind(err)]++
+}
+
+// completion records a chat completion request for a stage of the pipeline,
+// such as "markdown" or "extract".
+func (m *metricsRegistry) completion(stage, model string, duration time.Duration, usage openai.Usage, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+
+	m.requests[labels("stage", stage, "model", model, "result", result)]++
+	m.tokens[labels("model", model, "type", "prompt")] += usage.PromptTokens
+	m.tokens[labels("model", model, "type", "completion")] += usage.CompletionTokens
+	m.tokens[labels("model", model, "type", "cached")] += cachedTokens(usage)
+
+	key := labels("stage", stage, "model", model)
+
+	latency, ok := m.latency[key]
+	if !ok {
+		latency = &histogram{counts: make([]int, len(latencyBuckets))}
+		m.latency[key] = latency
+	}
+
+	seconds := duration.Seconds()
+	for i, bound := range latencyBuckets {
+		if seconds <= bound {
+			latency.counts[i]++
+		}
+	}
+
+	latency.count++
+	latency.sum += seconds
+}
+
+func (m *metricsRegistry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	m.write(w)
+}
+
+// write writes the metrics in the Prometheus text exposition format.
+func (m *metricsRegistry) write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fmt.Fprintln(w, "# HELP pdfrenamer_documents_total Documents processed, by result.")
+	fmt.Fprintln(w, "# TYPE pdfrenamer_documents_total counter")
+	for _, result := range slices.Sorted(maps.Keys(m.documents)) {
+		fmt.Fprintf(w, "pdfrenamer_documents_total{%s} %d\n", labels("result", result), m.documents[result])
+	}
+
+	fmt.Fprintln(w, "# HELP pdfrenamer_failures_total Documents that failed to be renamed, by kind of failure.")
+	fmt.Fprintln(w, "# TYPE pdfrenamer_failures_total counter")
+	for _, kind := range slices.Sorted(maps.Keys(m.failures)) {
+		fmt.Fprintf(w, "pdfrenamer_failures_total{%s} %d\n", labels("kind", kind), m.failures[kind])
+	}
+
+	fmt.Fprintln(w, "# HELP pdfrenamer_tokens_total Tokens used by the provider, by model and type.")
+	fmt.Fprintln(w, "# TYPE pdfrenamer_tokens_total counter")
+	for _, key := range slices.Sorted(maps.Keys(m.tokens)) {
+		fmt.Fprintf(w, "pdfrenamer_tokens_total{%s} %d\n", key, m.tokens[key])
+	}
+
+	fmt.Fprintln(w, "# HELP pdfrenamer_api_requests_total Requests to the provider, by stage, model, and result.")
+	fmt.Fprintln(w, "# TYPE pdfrenamer_api_requests_total counter")
+	for _, key := range slices.Sorted(maps.Keys(m.requests)) {
+		fmt.Fprintf(w, "pdfrenamer_api_requests_total{%s} %d\n", key, m.requests[key])
+	}
+
+	fmt.Fprintln(w, "# HELP pdfrenamer_api_request_duration_seconds Latency of requests to the provider, by stage and model.")
+	fmt.Fprintln(w, "# TYPE pdfrenamer_api_request_duration_seconds histogram")
+	for _, key := range slices.Sorted(maps.Keys(m.latency)) {
+		latency := m.latency[key]
+
+		for i, bound := range latencyBuckets {
+			fmt.Fprintf(w, "pdfrenamer_api_request_duration_seconds_bucket{%s,le=\"%g\"} %d\n", key, bound, latency.counts[i])
+		}
+
+		fmt.Fprintf(w, "pdfrenamer_api_request_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", key, latency.count)
+		fmt.Fprintf(w, "pdfrenamer_api_request_duration_seconds_sum{%s} %g\n", key, latency.sum)
+		fmt.Fprintf(w, "pdfrenamer_api_request_duration_seconds_count{%s} %d\n", key, latency.count)
+	}
+
+	if m.queueDepth != nil {
+		fmt.Fprintln(w, "# HELP pdfrenamer_queue_depth Documents waiting to be processed.")
+		fmt.Fprintln(w, "# TYPE pdfrenamer_queue_depth gauge")
+		fmt.Fprintf(w, "pdfrenamer_queue_depth %d\n", m.queueDepth())
+	}
+}
+
+var labelReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// labels renders pairs of label names and values, escaping the values.
+func labels(pairs ...string) string {
+	rendered := []string{}
+	for i := 0; i+1 < len(pairs); i += 2 {
+		rendered = append(rendered, fmt.Sprintf("%s=\"%s\"", pairs[i], labelReplacer.Replace(pairs[i+1])))
+	}
+
+	return strings.Join(rendered, ",")
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/gen2brain/go-fitz"
+	"github.com/sashabaranov/go-openai"
+)
+
+// ocrMistral converts documents with Mistral's document OCR endpoint, which
+// is priced per page rather than by tokens.
+const ocrMistral = "mistral"
+
+type mistralOCRRequest struct {
+	Model    string             `json:"model"`
+	Document mistralOCRDocument `json:"document"`
+	Pages    []int              `json:"pages,omitempty"`
+}
+
+type mistralOCRDocument struct {
+	Type        string `json:"type"`
+	DocumentURL string `json:"document_url"`
+}
+
+type mistralOCRResponse struct {
+	Pages []struct {
+		Index    int    `json:"index"`
+		Markdown string `json:"markdown"`
+	} `json:"pages"`
+	UsageInfo struct {
+		PagesProcessed int `json:"pages_processed"`
+	} `json:"usage_info"`
+}
+
+// mistralMarkdown converts the pages of the PDF in the page range to markdown
+// in one request to Mistral's OCR endpoint, with --image-model as the OCR
+// model, such as mistral-ocr-latest.
+func (c *RenameFlags) mistralMarkdown(ctx context.Context, source string, doc *fitz.Document) (string, error) {
+	pages := c.selectedPages(source, doc)
+	if len(pages) == 0 {
+		return "", nil
+	}
+
+	file, err := os.Open(source)
+	if err != nil {
+		return "", fmt.Errorf("failed to open PDF: %w", err)
+	}
+	defer file.Close()
+
+	response := mistralOCRResponse{}
+
+	err = c.callProvider(ctx, "markdown", c.ImageModel, func(ctx context.Context, span *span) (openai.Usage, error) {
+		slog.Info("pdf.markdown", "document", source, "pages", len(pages))
+
+		err := c.postJSON(ctx, "/ocr", mistralOCRRequest{
+			Model: c.ImageModel,
+			Document: mistralOCRDocument{
+				Type:        "document_url",
+				DocumentURL: dataURL("application/pdf", file),
+			},
+			Pages: pages,
+		}, &response)
+
+		// the OCR endpoint reports pages rather than tokens
+		span.set("pages", response.UsageInfo.PagesProcessed)
+
+		return openai.Usage{}, err
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to convert document to markdown: %w", err)
+	}
+
+	markdown := &strings.Builder{}
+
+	for _, page := range response.Pages {
+		if c.irrelevant(page.Markdown) {
+			slog.Info("pdf.irrelevant", "page", page.Index)
+			continue
+		}
+
+		if 0 < markdown.Len() {
+			markdown.WriteString("\n\n")
+		}
+
+		markdown.WriteString(page.Markdown)
+	}
+
+	return markdown.String(), nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// currencySymbols maps the symbols of common currencies to their ISO 4217
+// codes.
+var currencySymbols = map[string]string{
+	"€":   "EUR",
+	"$":   "USD",
+	"US$": "USD",
+	"£":   "GBP",
+	"¥":   "JPY",
+	"₹":   "INR",
+	"CHF": "CHF",
+	"Fr":  "CHF",
+	"zł":  "PLN",
+	"R$":  "BRL",
+	"C$":  "CAD",
+	"A$":  "AUD",
+}
+
+// parseAmount parses an amount as written in a document, whichever
+// separators its locale uses, such as "1.234,56 €", "$1,234.56", "1 234,56",
+// or "(1,234.56)".
+func parseAmount(value string) (float64, error) {
+	negative := strings.Contains(value, "-") || strings.Contains(value, "−") ||
+		(strings.Contains(value, "(") && strings.Contains(value, ")"))
+
+	digits := &strings.Builder{}
+	for _, r := range value {
+		if unicode.IsDigit(r) || r == '.' || r == ',' {
+			digits.WriteRune(r)
+		}
+	}
+
+	number := strings.Trim(digits.String(), ".,")
+	if number == "" {
+		return 0, fmt.Errorf("unrecognized amount %q", value)
+	}
+
+	// the last separator is the decimal one when both are used, or when the
+	// only one is followed by other than three digits
+	decimal := rune(0)
+	dot, comma := strings.LastIndex(number, "."), strings.LastIndex(number, ",")
+
+	switch {
+	case 0 <= dot && 0 <= comma:
+		decimal = '.'
+		if dot < comma {
+			decimal = ','
+		}
+	case 0 <= dot && strings.Count(number, ".") == 1 && len(number)-dot-1 != 3:
+		decimal = '.'
+	case 0 <= comma && strings.Count(number, ",") == 1 && len(number)-comma-1 != 3:
+		decimal = ','
+	}
+
+	normalized := strings.Map(func(r rune) rune {
+		switch {
+		case r == decimal:
+			return '.'
+		case r == '.' || r == ',':
+			return -1
+		}
+
+		return r
+	}, number)
+
+	amount, err := strconv.ParseFloat(normalized, 64)
+	if err != nil {
+		return 0, fmt.Errorf("unrecognized amount %q", value)
+	}
+
+	if negative {
+		amount = -amount
+	}
+
+	return amount, nil
+}
+
+// money renders an extracted amount with the fmt format, such as "%.2f",
+// followed by the currency, so `{{.Total | money "EUR" "%.2f"}}` renders
+// "1.234,56 €" as "1234.56 EUR". An empty currency is left off.
+func money(currency, format, value string) (string, error) {
+	amount, err := parseAmount(value)
+	if err != nil {
+		return "", err
+	}
+
+	formatted := fmt.Sprintf(format, amount)
+	if currency == "" {
+		return formatted, nil
+	}
+
+	return formatted + " " + currency, nil
+}
+
+// currencyOf returns the ISO 4217 code of the currency of an extracted
+// amount, from its code or symbol, or an empty string when it has neither.
+func currencyOf(value string) string {
+	for _, field := range strings.FieldsFunc(value, func(r rune) bool {
+		return unicode.IsDigit(r) || unicode.IsSpace(r) || r == '.' || r == ',' || r == '-' || r == '(' || r == ')'
+	}) {
+		if code, ok := currencySymbols[field]; ok {
+			return code
+		}
+
+		if len(field) == 3 && strings.ToUpper(field) == field && isLetters(field) {
+			return field
+		}
+	}
+
+	return ""
+}
+
+func isLetters(value string) bool {
+	for _, r := range value {
+		if !unicode.IsLetter(r) {
+			return false
+		}
+	}
+
+	return true
+}
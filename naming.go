@@ -0,0 +1,114 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/language"
+)
+
+// NamingFlags are applied to the rendered filename, so that formats do not
+// need a sprig pipe on every field for consistent names.
+type NamingFlags struct {
+	Separator string `help:"separator between words in the filename (keep, space, underscore, dash)" enum:"keep,space,underscore,dash" default:"keep"`
+	Case      string `help:"casing of the filename (keep, lower, title, kebab, snake)" enum:"keep,lower,title,kebab,snake" default:"keep"`
+	MaxLength int    `help:"maximum length in bytes of each part of the filename, 0 to disable" default:"255"`
+}
+
+var separators = map[string]string{
+	"space":      " ",
+	"underscore": "_",
+	"dash":       "-",
+}
+
+// apply rewrites each path element of the filename, leaving the extension
+// untouched.
+func (n NamingFlags) apply(filename string) string {
+	if n.Separator == "keep" && n.Case == "keep" {
+		return filename
+	}
+
+	dir, base := filepath.Split(filename)
+	ext := filepath.Ext(base)
+	stem := strings.TrimSuffix(base, ext)
+
+	elements := strings.Split(filepath.ToSlash(dir), "/")
+	for i, element := range elements {
+		elements[i] = n.applyElement(element)
+	}
+
+	return filepath.FromSlash(strings.Join(elements, "/")) + n.applyElement(stem) + ext
+}
+
+func (n NamingFlags) applyElement(element string) string {
+	if element == "" || element == "." || element == ".." {
+		return element
+	}
+
+	separator, ok := separators[n.Separator]
+
+	switch n.Case {
+	case "kebab":
+		separator, ok = "-", true
+	case "snake":
+		separator, ok = "_", true
+	}
+
+	if !ok {
+		return n.applyCase(element)
+	}
+
+	words := splitWords(element)
+	for i, word := range words {
+		words[i] = n.applyCase(word)
+	}
+
+	return strings.Join(words, separator)
+}
+
+func (n NamingFlags) applyCase(value string) string {
+	switch n.Case {
+	case "lower", "kebab", "snake":
+		return strings.ToLower(value)
+	case "title":
+		return cases.Title(language.Und).String(value)
+	default:
+		return value
+	}
+}
+
+// splitWords splits on whitespace, underscores, and dashes, except dashes or
+// underscores between digits so that dates like 2024-01-31 stay intact.
+func splitWords(value string) []string {
+	runes := []rune(value)
+	words := []string{}
+	word := &strings.Builder{}
+
+	for i, r := range runes {
+		boundary := unicode.IsSpace(r)
+
+		if r == '-' || r == '_' {
+			betweenDigits := 0 < i && i < len(runes)-1 &&
+				unicode.IsDigit(runes[i-1]) && unicode.IsDigit(runes[i+1])
+			boundary = !betweenDigits
+		}
+
+		if !boundary {
+			word.WriteRune(r)
+			continue
+		}
+
+		if 0 < word.Len() {
+			words = append(words, word.String())
+			word.Reset()
+		}
+	}
+
+	if 0 < word.Len() {
+		words = append(words, word.String())
+	}
+
+	return words
+}
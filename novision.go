@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"slices"
+	"strings"
+
+	"github.com/gen2brain/go-fitz"
+	"golang.org/x/text/language"
+)
+
+// textMarkdown converts the pages of the PDF to text without the image model,
+// for --no-vision: a page with a text layer is read from it, and a scanned
+// page with Tesseract.
+func (c *RenameFlags) textMarkdown(ctx context.Context, source string, doc *fitz.Document) (string, error) {
+	markdown := &strings.Builder{}
+	image := &bytes.Buffer{}
+
+	for _, n := range c.selectedPages(source, doc) {
+		text, err := doc.Text(n)
+		if err != nil {
+			slog.Warn("pdf.text", "page", n, "error", err)
+		}
+
+		if countText(text) < minTextLayer {
+			slog.Info("pdf.tesseract", "page", n)
+
+			image.Reset()
+
+			err = renderPage(ctx, doc, n, pageDPI, c.PageRegion, image)
+			if err != nil {
+				return "", err
+			}
+
+			text, err = c.tesseract(image)
+			if err != nil {
+				return "", fmt.Errorf("failed to read page #%d with tesseract: %w", n, err)
+			}
+		} else {
+			slog.Info("pdf.text", "page", n)
+		}
+
+		text = strings.TrimSpace(text)
+		if text == "" || c.irrelevant(text) {
+			continue
+		}
+
+		if 0 < markdown.Len() {
+			markdown.WriteString("\n\n")
+		}
+
+		markdown.WriteString(text)
+	}
+
+	return markdown.String(), nil
+}
+
+// tesseract reads the text of a page image with the tesseract command, in
+// the languages of --ocr-languages.
+func (c *RenameFlags) tesseract(image *bytes.Buffer) (string, error) {
+	path, err := exec.LookPath("tesseract")
+	if err != nil {
+		return "", fmt.Errorf("failed to find tesseract for a page without a text layer: %w", err)
+	}
+
+	args := []string{"stdin", "stdout"}
+	if languages := tesseractLanguages(c.OCRLanguages); languages != "" {
+		args = append(args, "-l", languages)
+	}
+
+	stderr := &bytes.Buffer{}
+
+	cmd := exec.Command(path, args...)
+	cmd.Stdin = image
+	cmd.Stderr = stderr
+
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+
+	return string(output), nil
+}
+
+// tesseractLanguages turns ISO 639-1 codes, such as de, into the ISO 639-2
+// codes that name Tesseract's language data, such as deu.
+func tesseractLanguages(codes []string) string {
+	languages := []string{}
+
+	for _, code := range codes {
+		base, err := language.ParseBase(strings.TrimSpace(code))
+		if err != nil {
+			continue
+		}
+
+		languages = append(languages, base.ISO3())
+	}
+
+	if len(languages) == 0 {
+		return ""
+	}
+
+	// English is kept, as most documents have some
+	if !slices.Contains(languages, "eng") {
+		languages = append(languages, "eng")
+	}
+
+	return strings.Join(languages, "+")
+}
+
+// selectedPages are the pages the image model would convert one at a time:
+// those in the page range, without the pages the scanner fed twice, up to
+// --max-pages.
+func (c *RenameFlags) selectedPages(source string, doc *fitz.Document) []int {
+	// the range is checked before the document is converted
+	startPage, endPage, _ := c.pageRange()
+	duplicates := &duplicatePages{}
+	pages := []int{}
+
+	for n := startPage; n < doc.NumPage() && n <= endPage; n++ {
+		if duplicates.duplicate(doc, n) {
+			slog.Info("pdf.duplicate", "page", n)
+			continue
+		}
+
+		if 0 < c.MaxPages && c.MaxPages <= len(pages) {
+			slog.Warn("pdf.truncate", "source", source, "pages", doc.NumPage(), "max_pages", c.MaxPages)
+			break
+		}
+
+		pages = append(pages, n)
+	}
+
+	return pages
+}
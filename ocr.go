@@ -0,0 +1,312 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// markdown converts the pages of the PDF in the page range to markdown with
+// the image model.
+func (c *RenameFlags) markdown(ctx context.Context, client *openai.Client, source string) (string, error) {
+	startPage, endPage, err := c.pageRange()
+	if err != nil {
+		return "", err
+	}
+
+	doc, err := openPDF(source)
+	if err != nil {
+		return "", fmt.Errorf("failed to open PDF: %w", err)
+	}
+	defer doc.Close()
+
+	if c.NoVision {
+		return c.textMarkdown(ctx, source, doc)
+	}
+
+	// the whole document is sent to these, so its pages cannot be cropped
+	if !c.PageRegion.whole() && (c.OCR == ocrMistral || c.VisionInput == visionInputDocument) {
+		return "", errors.New("--page-region crops the images of pages, which --ocr mistral and --vision-input document do not send")
+	}
+
+	if c.OCR == ocrMistral {
+		return c.mistralMarkdown(ctx, source, doc)
+	}
+
+	// the whole document is only sent when its pages are within the cap,
+	// as the model reads all of them
+	if c.VisionInput == visionInputDocument {
+		if c.MaxPages <= 0 || doc.NumPage() <= c.MaxPages {
+			return c.documentMarkdown(ctx, client, source)
+		}
+
+		slog.Warn("pdf.document.pages", "source", source, "pages", doc.NumPage(), "max_pages", c.MaxPages)
+	}
+
+	// pages are converted one at a time, so that only a page's image and the
+	// markdown so far are held in memory, even for a long scan
+	markdown := &strings.Builder{}
+	file := &bytes.Buffer{}
+	code := ""
+
+	imageDir := ""
+	if c.ImageDir != "" {
+		imageDir, err = c.pageImageDir(source)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	slog.Info("pdf.process", "start", startPage, "end", endPage)
+
+	systemPrompt := c.markdownPrompt()
+
+	converted := 0
+	duplicates := &duplicatePages{}
+
+	// for each page of the PDF convert to image
+	for n := 0; n < doc.NumPage(); n++ {
+		if n < startPage {
+			slog.Info("pdf.skip", "page", n)
+			continue
+		}
+		if endPage < n {
+			slog.Info("pdf.end", "page", n)
+			break
+		}
+		// a sheet the scanner fed twice is only converted once
+		if duplicates.duplicate(doc, n) {
+			slog.Info("pdf.duplicate", "page", n)
+			continue
+		}
+
+		if 0 < c.MaxPages && c.MaxPages <= converted {
+			slog.Warn("pdf.truncate", "source", source, "pages", doc.NumPage(), "max_pages", c.MaxPages)
+			break
+		}
+
+		converted++
+
+		slog.Info("pdf.open", "page", n)
+
+		// with --hybrid, a page with a text layer is sent as its exact text,
+		// with a cheap low-detail image for what the text lacks. The text
+		// layer is of the whole page, so it is not sent with --page-region.
+		textLayer := ""
+		if c.Hybrid && c.PageRegion.whole() {
+			textLayer = pageText(doc, n)
+		}
+
+		dpi, detail := float64(pageDPI), openai.ImageURLDetailAuto
+		if textLayer != "" {
+			slog.Info("pdf.text", "page", n)
+			dpi, detail = hybridDPI, openai.ImageURLDetailLow
+		}
+
+		imageURL, err := pageImage(ctx, doc, n, dpi, c.PageRegion, imageDir, file)
+		if err != nil {
+			return "", err
+		}
+
+		slog.Info("pdf.markdown", "page", n)
+
+		parts := []openai.ChatMessagePart{}
+
+		// pages after the first are read knowing the document's language,
+		// which is told with the page to keep the system prompt the same
+		if code == "" {
+			code = detectLanguage(markdown.String())
+		}
+
+		if hint, ok := languageHints[code]; ok {
+			parts = append(parts, openai.ChatMessagePart{
+				Type: openai.ChatMessagePartTypeText,
+				Text: hint,
+			})
+		}
+
+		if textLayer != "" {
+			parts = append(parts, openai.ChatMessagePart{
+				Type: openai.ChatMessagePartTypeText,
+				Text: "The text layer of the page:\n\n" + textLayer,
+			})
+		}
+
+		parts = append(parts, openai.ChatMessagePart{
+			Type: openai.ChatMessagePartTypeImageURL,
+			ImageURL: &openai.ChatMessageImageURL{
+				URL:    imageURL,
+				Detail: detail,
+			},
+		})
+
+		content, err := c.convertPage(ctx, client, c.ImageModel, source, n, systemPrompt, parts)
+		if err == nil && c.irrelevant(content) {
+			slog.Info("pdf.irrelevant", "page", n)
+			continue
+		}
+		if err == nil && c.escalates(content) {
+			slog.Info("pdf.escalate", "page", n, "model", c.EscalateModel, "chars", countText(content))
+			content, err = c.convertPage(ctx, client, c.EscalateModel, source, n, systemPrompt, parts)
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to convert image #%d to markdown: %w", n, err)
+		}
+
+		if 0 < markdown.Len() {
+			markdown.WriteString("\n\n")
+		}
+
+		markdown.WriteString(content)
+	}
+
+	// the images are only kept for retrying a document that failed
+	if imageDir != "" {
+		err = os.RemoveAll(imageDir)
+		if err != nil {
+			slog.Warn("pdf.images.remove", "dir", imageDir, "error", err)
+		}
+	}
+
+	return markdown.String(), nil
+}
+
+// pageRange is the first and last page of --page-range, counting from 0.
+// The range counts pages from 1, as a single page such as 1, pages such as
+// 2-5, pages to the end such as 3-, or all of them.
+func (c *RenameFlags) pageRange() (int, int, error) {
+	value := strings.TrimSpace(c.PageRange)
+	if value == "" || value == "all" {
+		return 0, math.MaxInt, nil
+	}
+
+	first, last, isRange := strings.Cut(value, "-")
+
+	startPage, err := strconv.Atoi(strings.TrimSpace(first))
+	if err != nil || startPage < 1 {
+		return 0, 0, fmt.Errorf("page range must be pages from 1 such as 1, 2-5, 3-, or all, got %q", c.PageRange)
+	}
+
+	endPage := startPage
+	if isRange {
+		endPage = math.MaxInt
+
+		if strings.TrimSpace(last) != "" {
+			endPage, err = strconv.Atoi(strings.TrimSpace(last))
+			if err != nil || endPage < startPage {
+				return 0, 0, fmt.Errorf("page range must be pages from 1 such as 1, 2-5, 3-, or all, got %q", c.PageRange)
+			}
+		}
+	}
+
+	if endPage != math.MaxInt {
+		endPage--
+	}
+
+	return startPage - 1, endPage, nil
+}
+
+// convertPage converts a page to markdown with the image model, sending its
+// image as a data URL, or uploading it with --vision-input file or document.
+// With --preview or --skip-page, the markdown is streamed.
+func (c *RenameFlags) convertPage(ctx context.Context, client *openai.Client, model, source string, n int, systemPrompt string, parts []openai.ChatMessagePart) (string, error) {
+	if c.VisionInput != visionInputDataURL {
+		return c.convertPageFile(ctx, client, model, n, systemPrompt, parts)
+	}
+
+	request := openai.ChatCompletionRequest{
+		Model: model,
+		Messages: []openai.ChatCompletionMessage{
+			{
+				Role:    "system",
+				Content: systemPrompt,
+			},
+			{
+				Role:         "user",
+				MultiContent: parts,
+			},
+		},
+	}
+
+	if c.streams() {
+		return c.streamPage(ctx, client, source, n, request)
+	}
+
+	response, err := c.complete(ctx, client, "markdown", request)
+	if err != nil {
+		return "", err
+	}
+
+	return response.Choices[0].Message.Content, nil
+}
+
+// promptPDFtoMarkdown is the system prompt of the image model. Everything
+// that differs between pages is given with the page, so the system prompt is
+// the same for every page of a run and cached by the provider.
+const promptPDFtoMarkdown = `
+You are tasked with converting an image of a page from a PDF document into a markdown text representation. Follow these strict guidelines to ensure accuracy and consistency:
+1. Include **all visible content from the page** without omitting or altering any information for privacy or any other reasons. 
+2. **Preserve the original structure** and intent of the document:
+   - Convert headings to appropriate markdown heading levels ('#', '##', etc.), ensuring a blank line before and after each heading.
+   - Keep paragraphs intact, ensuring no line breaks occur within words (e.g., "cor- rect" becomes "correct").
+   - Reformat lists into proper markdown syntax:
+     - Unordered lists: '-' or '*'
+     - Ordered lists: '1.', '2.', etc.
+3. Apply markdown formatting to enhance readability:
+   - Use '*italic*' and '**bold**' where present in the original content.
+   - Convert tables into markdown table format. Retain all rows and columns as they appear.
+4. Identify and **clearly mark headers, footers, and page numbers** as blockquotes ('>') but do not remove them.
+5. Strictly preserve original punctuation and capitalization:
+   - Do not add punctuation or modify the existing punctuation.
+   - Maintain original text flow without introducing unnecessary explanations.
+6. Handle duplicate content carefully:
+   - Remove only **exact or near-exact duplicates** within the page.
+   - Cross-check the context (before and after the main chunk) to avoid accidental removal of meaningful content.
+   - If no duplicates are identified, return the content as is.
+7. Avoid injecting additional content:
+   - Do not add introductory text like "Here is the converted text" or similar phrases.
+   - Ensure the output contains only the content extracted from the image.
+`
+
+// markdownPrompt is the system prompt of the image model for the run.
+func (c *RenameFlags) markdownPrompt() string {
+	systemPrompt := promptPDFtoMarkdown
+	if hint := c.ocrLanguagesPrompt(); hint != "" {
+		systemPrompt += "8. " + hint
+	}
+
+	if c.Hybrid {
+		systemPrompt += "9. " + promptTextLayer
+	}
+
+	return systemPrompt
+}
+
+// truncate cuts the markdown to --max-chars, on a character boundary.
+func (c *RenameFlags) truncate(source, markdown string) string {
+	if c.MaxChars <= 0 || utf8.RuneCountInString(markdown) <= c.MaxChars {
+		return markdown
+	}
+
+	slog.Warn("markdown.truncate", "source", source, "chars", utf8.RuneCountInString(markdown), "max_chars", c.MaxChars)
+
+	runes := 0
+	for index := range markdown {
+		if runes == c.MaxChars {
+			return markdown[:index]
+		}
+
+		runes++
+	}
+
+	return markdown
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+)
+
+type OwnershipFlags struct {
+	Chmod string `help:"permissions to set on the renamed file, in octal (e.g. 0640)"`
+	Chown string `help:"owner to set on the renamed file (user, user:group, or :group)"`
+
+	ReadOnly  bool `help:"make the renamed file read-only, so an archived document is not edited by accident"`
+	Immutable bool `help:"also set the immutable attribute of the renamed file, which has to be cleared even by root before changing it (Linux, needs CAP_LINUX_IMMUTABLE)"`
+}
+
+// ownership is the resolved form of OwnershipFlags, with -1 meaning the
+// owner or group is left unchanged.
+type ownership struct {
+	mode      os.FileMode
+	setMode   bool
+	uid, gid  int
+	readOnly  bool
+	immutable bool
+}
+
+// resolve checks the flags before any file is touched, so a typo in a user
+// name does not fail after the rename has happened.
+func (o OwnershipFlags) resolve() (ownership, error) {
+	resolved := ownership{uid: -1, gid: -1, readOnly: o.ReadOnly, immutable: o.Immutable}
+
+	if o.Immutable && !immutableSupported {
+		return resolved, errors.New("--immutable is only supported on Linux")
+	}
+
+	if o.Chmod != "" {
+		mode, err := strconv.ParseUint(o.Chmod, 8, 32)
+		if err != nil || mode > 0o7777 {
+			return resolved, fmt.Errorf("invalid mode %q, expected octal such as 0640", o.Chmod)
+		}
+
+		resolved.mode = fileMode(mode)
+		resolved.setMode = true
+	}
+
+	if o.Chown != "" {
+		owner, group, _ := strings.Cut(o.Chown, ":")
+
+		if owner != "" {
+			uid, err := lookupID(owner, func(name string) (string, error) {
+				u, err := user.Lookup(name)
+				if err != nil {
+					return "", err
+				}
+
+				return u.Uid, nil
+			})
+			if err != nil {
+				return resolved, fmt.Errorf("failed to find user %q: %w", owner, err)
+			}
+
+			resolved.uid = uid
+		}
+
+		if group != "" {
+			gid, err := lookupID(group, func(name string) (string, error) {
+				g, err := user.LookupGroup(name)
+				if err != nil {
+					return "", err
+				}
+
+				return g.Gid, nil
+			})
+			if err != nil {
+				return resolved, fmt.Errorf("failed to find group %q: %w", group, err)
+			}
+
+			resolved.gid = gid
+		}
+	}
+
+	return resolved, nil
+}
+
+// specialModes maps the setuid, setgid, and sticky bits of a Unix mode to
+// those of os.FileMode, which keeps them apart from the permissions.
+var specialModes = map[uint64]os.FileMode{
+	0o4000: os.ModeSetuid,
+	0o2000: os.ModeSetgid,
+	0o1000: os.ModeSticky,
+}
+
+// fileMode converts a Unix mode, such as 02750, to an os.FileMode.
+func fileMode(mode uint64) os.FileMode {
+	converted := os.FileMode(mode) & os.ModePerm
+
+	for bit, special := range specialModes {
+		if mode&bit != 0 {
+			converted |= special
+		}
+	}
+
+	return converted
+}
+
+// lookupID accepts either a numeric ID or a name to look up.
+func lookupID(name string, lookup func(string) (string, error)) (int, error) {
+	if id, err := strconv.Atoi(name); err == nil {
+		return id, nil
+	}
+
+	id, err := lookup(name)
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.Atoi(id)
+}
+
+func (o ownership) apply(filename string) error {
+	if o.setMode {
+		err := os.Chmod(filename, o.mode)
+		if err != nil {
+			return fmt.Errorf("failed to change mode: %w", err)
+		}
+	}
+
+	if o.uid != -1 || o.gid != -1 {
+		err := os.Chown(filename, o.uid, o.gid)
+		if err != nil {
+			return fmt.Errorf("failed to change owner: %w", err)
+		}
+	}
+
+	if o.readOnly {
+		info, err := os.Stat(filename)
+		if err != nil {
+			return fmt.Errorf("failed to stat file: %w", err)
+		}
+
+		err = os.Chmod(filename, info.Mode()&(os.ModePerm|os.ModeSetuid|os.ModeSetgid|os.ModeSticky)&^0o222)
+		if err != nil {
+			return fmt.Errorf("failed to make file read-only: %w", err)
+		}
+	}
+
+	// set last, as nothing about the file can change afterwards
+	if o.immutable {
+		err := setImmutable(filename)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// pathReplacer removes characters from extracted values that would let text
+// from a document choose the directory a file is moved into.
+var pathReplacer = strings.NewReplacer("/", "-", "\\", "-", "\x00", "")
+
+// sanitizeValues returns a copy of values that is safe to render into a
+// filename. Path separators can only come from the format itself.
+func sanitizeValues(values map[string]string) map[string]string {
+	sanitized := make(map[string]string, len(values))
+
+	for field, value := range values {
+		sanitized[field] = pathReplacer.Replace(value)
+	}
+
+	return sanitized
+}
+
+// validatePath rejects filenames that escape the working directory unless
+// the user opted into formats that produce paths.
+func (t *filenameTemplate) validatePath(filename string) error {
+	if strings.ContainsRune(filename, 0) {
+		return fmt.Errorf("rendered filename %q contains a null byte", filename)
+	}
+
+	if t.allowPaths {
+		return nil
+	}
+
+	if filepath.IsAbs(filename) || filepath.VolumeName(filename) != "" {
+		return fmt.Errorf("rendered filename %q is an absolute path, use --allow-paths to permit it", filename)
+	}
+
+	if slices.Contains(strings.Split(filepath.ToSlash(filename), "/"), "..") {
+		return fmt.Errorf("rendered filename %q leaves the current directory, use --allow-paths to permit it", filename)
+	}
+
+	if strings.ContainsAny(filename, `/\`) {
+		return fmt.Errorf("rendered filename %q contains a directory, use --allow-paths to permit it", filename)
+	}
+
+	return nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// fieldPattern extracts a field from the markdown with a regular expression,
+// which is more reliable than a model for values with a fixed shape, such as
+// invoice numbers and IBANs. The first group is the value, or the whole match
+// without one.
+type fieldPattern struct {
+	Pattern string `yaml:"pattern"`
+	// Mode is fallback to fill the field when the model left it out,
+	// override to replace what the model extracted, or check to only warn
+	// when the two differ.
+	Mode string `yaml:"mode"`
+
+	re *regexp.Regexp
+}
+
+// loadPatterns reads a YAML file mapping fields to a pattern, or to a pattern
+// and its mode, which defaults to fallback.
+func loadPatterns(path string) (map[string]*fieldPattern, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read patterns: %w", err)
+	}
+
+	var entries map[string]yaml.Node
+
+	err = yaml.Unmarshal(contents, &entries)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal patterns: %w", err)
+	}
+
+	patterns := map[string]*fieldPattern{}
+
+	for field, node := range entries {
+		pattern := &fieldPattern{Mode: "fallback"}
+
+		if node.Kind == yaml.ScalarNode {
+			err = node.Decode(&pattern.Pattern)
+		} else {
+			err = node.Decode(pattern)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal pattern of %s: %w", field, err)
+		}
+
+		if !slices.Contains([]string{"fallback", "override", "check"}, pattern.Mode) {
+			return nil, fmt.Errorf("pattern of %s has mode %q, not fallback, override, or check", field, pattern.Mode)
+		}
+
+		pattern.re, err = regexp.Compile(pattern.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse pattern of %s: %w", field, err)
+		}
+
+		patterns[field] = pattern
+	}
+
+	return patterns, nil
+}
+
+// find returns the value the pattern matches in the markdown.
+func (p *fieldPattern) find(markdown string) (string, bool) {
+	match := p.re.FindStringSubmatch(markdown)
+	if match == nil {
+		return "", false
+	}
+
+	if 1 < len(match) {
+		return strings.TrimSpace(match[1]), true
+	}
+
+	return strings.TrimSpace(match[0]), true
+}
+
+// applyPatterns fills, replaces, or checks the extracted values with the
+// values the patterns of --patterns match in the markdown.
+func (c *RenameFlags) applyPatterns(markdown string, values map[string]string) error {
+	patterns, err := loadPatterns(c.Patterns)
+	if err != nil {
+		return err
+	}
+
+	for _, field := range slices.Sorted(maps.Keys(patterns)) {
+		pattern := patterns[field]
+
+		found, ok := pattern.find(markdown)
+		if !ok {
+			continue
+		}
+
+		extracted, has := values[field]
+
+		switch {
+		case !has || strings.TrimSpace(extracted) == "":
+			slog.Info("pattern.fill", "field", field, "value", found)
+			values[field] = found
+		case samePatternValue(extracted, found):
+		case pattern.Mode == "override":
+			slog.Info("pattern.override", "field", field, "value", found, "extracted", extracted)
+			values[field] = found
+		case pattern.Mode == "check":
+			slog.Warn("pattern.mismatch", "field", field, "value", found, "extracted", extracted)
+		}
+	}
+
+	return nil
+}
+
+// samePatternValue compares values ignoring case and spacing, as an IBAN is
+// printed in groups but often extracted without them.
+func samePatternValue(a, b string) bool {
+	normalize := func(value string) string {
+		return strings.ToLower(strings.Join(strings.Fields(value), ""))
+	}
+
+	return normalize(a) == normalize(b)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// pipelines clean extracted fields before the format is rendered, each as a
+// list of template functions that the value is piped through, so cleanup is
+// defined once rather than in every format.
+type pipelines map[string]*template.Template
+
+// loadPipelines reads a YAML file mapping fields to their steps, such as
+// `Vendor: [trim, stripCorpSuffix, alias, title]`. Each step is a template
+// function, with any arguments before the value, as in `trunc 20`. The steps
+// are parsed with the functions of the format, and alias, which maps a value
+// to its canonical value.
+func loadPipelines(path string, format *template.Template, aliases aliases) (pipelines, error) {
+	if path == "" {
+		return pipelines{}, nil
+	}
+
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pipelines: %w", err)
+	}
+
+	var entries map[string][]string
+
+	err = yaml.Unmarshal(contents, &entries)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal pipelines: %w", err)
+	}
+
+	loaded := pipelines{}
+
+	for field, steps := range entries {
+		if len(steps) == 0 {
+			continue
+		}
+
+		// templates made with New share the functions of the format
+		pipeline, err := format.New("pipeline " + field).
+			Funcs(template.FuncMap{"alias": aliases.canonical}).
+			Parse("{{ . | " + strings.Join(steps, " | ") + " }}")
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse pipeline of %s: %w", field, err)
+		}
+
+		loaded[field] = pipeline
+	}
+
+	return loaded, nil
+}
+
+// apply pipes the values of the fields through their pipelines.
+func (p pipelines) apply(values map[string]string) error {
+	for _, field := range slices.Sorted(maps.Keys(p)) {
+		value, ok := values[field]
+		if !ok {
+			continue
+		}
+
+		cleaned := &strings.Builder{}
+
+		err := p[field].Execute(cleaned, value)
+		if err != nil {
+			return fmt.Errorf("failed to clean %s: %w", field, err)
+		}
+
+		values[field] = cleaned.String()
+	}
+
+	return nil
+}
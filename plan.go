@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// renamePlan is the output of plan and the input of apply, which can be
+// reviewed and edited in between.
+type renamePlan struct {
+	Documents []*plannedRename `json:"documents"`
+}
+
+type PlanCmd struct {
+	Paths       []string `arg:"" help:"PDF files, or directories of PDF files, to plan the renames of" type:"existingpath"`
+	Destination string   `help:"directory to file renamed documents into (defaults to the working directory)" type:"path"`
+
+	RenameFlags `embed:""`
+	ShardFlags  `embed:""`
+	FilterFlags `embed:""`
+}
+
+// Run extracts the new name of each document and prints the plan as JSON,
+// without moving anything. Failed documents are left out of the plan.
+func (c *PlanCmd) Run() error {
+	sources, err := planSources(c.Paths)
+	if err != nil {
+		return err
+	}
+
+	sources = c.FilterFlags.filter(c.Shard.filter(sources))
+	c.order(sources)
+
+	ctx := context.Background()
+	results := &batch{}
+	plan := renamePlan{Documents: []*plannedRename{}}
+
+	for _, source := range sources {
+		planned, err := c.plan(ctx, source)
+		results.add(source, err)
+
+		if err == nil {
+			plan.Documents = append(plan.Documents, planned)
+		}
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+
+	err = encoder.Encode(plan)
+	if err != nil {
+		return fmt.Errorf("failed to write plan: %w", err)
+	}
+
+	return results.err()
+}
+
+func (c *PlanCmd) plan(ctx context.Context, source string) (_ *plannedRename, err error) {
+	usage := documentUsage{}
+	ctx = withUsage(ctx, usage)
+
+	flags := c.RenameFlags
+	flags.dir = c.Destination
+
+	planned, err := flags.planRename(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err != nil {
+			planned.indices.release()
+		}
+	}()
+
+	_, _, err = flags.prepare(planned.Values)
+	if err != nil {
+		return nil, err
+	}
+
+	hash, err := hashFile(source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash document: %w", err)
+	}
+
+	planned.Filename, err = filepath.Abs(planned.Filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve filename: %w", err)
+	}
+
+	planned.SHA256 = hex.EncodeToString(hash)
+	planned.Proposed = planned.Filename
+	planned.Usage = usage
+
+	return planned, nil
+}
+
+// planSources lists the PDFs of the paths, including those directly inside
+// of directories, as absolute paths so a plan can be applied from anywhere.
+func planSources(paths []string) ([]string, error) {
+	sources := []string{}
+
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open document: %w", err)
+		}
+
+		if !info.IsDir() {
+			sources = append(sources, path)
+			continue
+		}
+
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list directory: %w", err)
+		}
+
+		for _, entry := range entries {
+			name := entry.Name()
+			if entry.IsDir() || strings.HasPrefix(name, ".") || !strings.EqualFold(filepath.Ext(name), ".pdf") {
+				continue
+			}
+
+			sources = append(sources, filepath.Join(path, name))
+		}
+	}
+
+	for i, source := range sources {
+		absolute, err := filepath.Abs(source)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve document: %w", err)
+		}
+
+		sources[i] = absolute
+	}
+
+	return slices.Compact(sources), nil
+}
+
+type ApplyCmd struct {
+	Plan string `arg:"" help:"plan written by the plan command, with any changes made to it" type:"existingfile"`
+
+	RenameFlags `embed:""`
+}
+
+// Run renames each document of the plan to its planned filename. A document
+// that changed since it was planned is not renamed.
+func (c *ApplyCmd) Run() error {
+	contents, err := os.ReadFile(c.Plan)
+	if err != nil {
+		return fmt.Errorf("failed to read plan: %w", err)
+	}
+
+	var plan renamePlan
+
+	err = json.Unmarshal(contents, &plan)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal plan: %w", err)
+	}
+
+	ctx := context.Background()
+	results := &batch{}
+
+	for _, planned := range plan.Documents {
+		results.add(planned.Source, c.apply(ctx, planned))
+	}
+
+	results.summarize(os.Stderr)
+
+	return results.err()
+}
+
+func (c *ApplyCmd) apply(ctx context.Context, planned *plannedRename) error {
+	if planned.Source == "" || strings.TrimSpace(planned.Filename) == "" {
+		return errors.New("planned document has no source or filename")
+	}
+
+	// a filename edited in the plan, or in a review, may be relative to the
+	// working directory, while the proposed one is absolute
+	filename, err := filepath.Abs(planned.Filename)
+	if err != nil {
+		return fmt.Errorf("failed to resolve filename: %w", err)
+	}
+
+	planned.Filename = filename
+
+	unlock, err := lockFile(planned.Source)
+	if err != nil {
+		return fmt.Errorf("failed to acquire lock: %w", err)
+	}
+	defer func() { _ = unlock() }()
+
+	if planned.SHA256 != "" {
+		hash, err := hashFile(planned.Source)
+		if err != nil {
+			return fmt.Errorf("failed to hash document: %w", err)
+		}
+
+		if hex.EncodeToString(hash) != planned.SHA256 {
+			return fmt.Errorf("%q changed since it was planned", planned.Source)
+		}
+	}
+
+	if planned.Values == nil {
+		planned.Values = map[string]string{}
+	}
+
+	if c.DryRun {
+		fmt.Printf("%s -> %s\n", planned.Source, planned.Filename)
+		return nil
+	}
+
+	err = c.applyRename(ctx, planned)
+	if err != nil {
+		return err
+	}
+
+	// the document is already renamed, so a correction that cannot be
+	// recorded does not fail it
+	if planned.Proposed != "" && planned.Proposed != planned.Filename {
+		err = c.recordCorrection(planned)
+		if err != nil {
+			slog.Error("corrections.record", "filename", planned.Filename, "error", err)
+		}
+	}
+
+	return nil
+}
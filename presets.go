@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// presets are built-in formats for popular filing systems. They look up the
+// extracted category in the table given with --preset-map.
+var presets = map[string]string{
+	// Johnny.Decimal maps a category to its numbered folder, e.g.
+	// `Bank Statement: "11 Banking"`, filed under its area, e.g. `10-19`. An
+	// area can be named by mapping it too, e.g. `10-19: "10-19 Finance"`.
+	"johnny-decimal": `{{$category := lookup "preset" .Category | default "00 Unsorted"}}` +
+		`{{jdArea $category}}/{{$category}}/{{.Date}} {{.Title}}.pdf`,
+
+	// PARA maps a category to a folder under Projects, Areas, Resources, or
+	// Archives, e.g. `Bank Statement: Areas/Finance`.
+	"para": `{{lookup "preset" .Category | default "Resources"}}/{{.Date}} {{.Title}}.pdf`,
+}
+
+var jdCategory = regexp.MustCompile(`^(\d)(\d)\b`)
+
+// jdArea returns the Johnny.Decimal area, e.g. `10-19`, that a numbered
+// category belongs to, using the area's name from the table if it has one.
+func jdArea(tables lookupTables) func(string) (string, error) {
+	return func(category string) (string, error) {
+		matches := jdCategory.FindStringSubmatch(category)
+		if matches == nil {
+			return "", fmt.Errorf("category %q does not start with a Johnny.Decimal number", category)
+		}
+
+		tens, _ := strconv.Atoi(matches[1])
+		area := fmt.Sprintf("%d0-%d9", tens, tens)
+
+		if named, _ := tables.lookup("preset", area); named != "" {
+			return named, nil
+		}
+
+		return area, nil
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/Masterminds/sprig/v3"
+)
+
+// documentInfo is what is known about the original file, before anything is
+// extracted from it.
+type documentInfo struct {
+	// OriginalName is the filename the document had, such as a name given by
+	// the scanner.
+	OriginalName string
+	// SourceFolder is the name of the folder the document was in.
+	SourceFolder string
+	// ScanDate is the modification date of the file, formatted as
+	// 2006-01-02.
+	ScanDate string
+	// Language is the ISO 639-1 code of the document's language, detected
+	// once it is converted to markdown.
+	Language string
+}
+
+func (c *RenameFlags) documentInfo(source string) (documentInfo, error) {
+	info, err := os.Stat(source)
+	if err != nil {
+		return documentInfo{}, fmt.Errorf("failed to open document: %w", err)
+	}
+
+	folder, err := filepath.Abs(filepath.Dir(source))
+	if err != nil {
+		return documentInfo{}, fmt.Errorf("failed to find absolute path: %w", err)
+	}
+
+	name := c.originalName
+	if name == "" {
+		name = filepath.Base(source)
+	}
+
+	return documentInfo{
+		OriginalName: name,
+		SourceFolder: filepath.Base(folder),
+		ScanDate:     info.ModTime().Format("2006-01-02"),
+	}, nil
+}
+
+// originalNamePrompt is the context given to the extraction requests about
+// the original filename, unless it is disabled.
+func (c *RenameFlags) originalNamePrompt(info documentInfo) string {
+	if !c.OriginalName {
+		return ""
+	}
+
+	return fmt.Sprintf("\n\t- The original filename was: '%s'. It may contain the date, a job or account number, or other values to reuse.", info.OriginalName)
+}
+
+// prompt renders the additional prompt, which is a template with the
+// document's info, such as "the original filename was {{.OriginalName}}".
+func (c *RenameFlags) prompt(info documentInfo) (string, error) {
+	if !strings.Contains(c.Prompt, "{{") {
+		return c.Prompt, nil
+	}
+
+	tmpl, err := template.New("prompt").
+		Funcs(sprig.FuncMap()).
+		Option("missingkey=error").
+		Parse(c.Prompt)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse prompt: %w", err)
+	}
+
+	prompt := &strings.Builder{}
+
+	err = tmpl.Execute(prompt, info)
+	if err != nil {
+		return "", fmt.Errorf("failed to render prompt: %w", err)
+	}
+
+	return prompt.String(), nil
+}
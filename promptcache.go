@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// cacheControlTransport marks the system prompts of chat completion requests
+// with Anthropic's cache_control, which Claude models and the gateways to
+// them need to cache a prompt. OpenAI caches long prompts without it.
+type cacheControlTransport struct {
+	base http.RoundTripper
+}
+
+func (t *cacheControlTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	if request.Body == nil || request.Method != http.MethodPost {
+		return t.base.RoundTrip(request)
+	}
+
+	body, err := io.ReadAll(request.Body)
+	_ = request.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read request: %w", err)
+	}
+
+	marked, err := markCacheControl(body)
+	if err != nil {
+		// a request that is not a chat completion is sent as it is
+		marked = body
+	}
+
+	request = request.Clone(request.Context())
+	request.Body = io.NopCloser(bytes.NewReader(marked))
+	request.ContentLength = int64(len(marked))
+
+	return t.base.RoundTrip(request)
+}
+
+// markCacheControl turns the content of the first system message into a text
+// part marked as a cache breakpoint. It is the prompt that stays the same for
+// the run, while the messages after it differ by document or page.
+func markCacheControl(body []byte) ([]byte, error) {
+	var request map[string]json.RawMessage
+
+	err := json.Unmarshal(body, &request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal request: %w", err)
+	}
+
+	var messages []map[string]any
+
+	err = json.Unmarshal(request["messages"], &messages)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal messages: %w", err)
+	}
+
+	if len(messages) == 0 || messages[0]["role"] != "system" {
+		return body, nil
+	}
+
+	content, ok := messages[0]["content"].(string)
+	if !ok || content == "" {
+		return body, nil
+	}
+
+	messages[0]["content"] = []map[string]any{{
+		"type":          "text",
+		"text":          content,
+		"cache_control": map[string]string{"type": "ephemeral"},
+	}}
+
+	request["messages"], err = json.Marshal(messages)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal messages: %w", err)
+	}
+
+	return json.Marshal(request)
+}
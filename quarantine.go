@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// quarantined is the error file written next to a quarantined document.
+type quarantined struct {
+	Run         string    `json:"run,omitempty"`
+	Source      string    `json:"source"`
+	Destination string    `json:"destination"`
+	Error       string    `json:"error"`
+	Kind        string    `json:"kind"`
+	Attempts    int       `json:"attempts"`
+	Time        time.Time `json:"time"`
+
+	// Filename and Values are the rename proposed for a document left for
+	// review.
+	Filename string            `json:"filename,omitempty"`
+	Values   map[string]string `json:"values,omitempty"`
+}
+
+// quarantine moves a document that failed to be renamed into the quarantine
+// directory, and then writes a `.error.json` file describing the failure and where
+// the document was to be filed. Documents left for review, such as those
+// below --auto-threshold, are moved into the review directory instead, with
+// the rename proposed for them.
+// Nothing is moved without such a directory, in a dry run, when another
+// instance holds the document's lock, or when the document was already
+// renamed.
+func (c *RenameFlags) quarantine(source, destination string, cause error) error {
+	dir := c.QuarantineDir
+
+	var (
+		review   reviewable
+		renamed  renamedError
+		proposed string
+		values   map[string]string
+	)
+
+	if errors.As(cause, &review) {
+		dir = c.ReviewDir
+		proposed, values = review.proposed()
+	}
+
+	if dir == "" || c.DryRun || errors.Is(cause, errLocked) || errors.As(cause, &renamed) {
+		return nil
+	}
+
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return fmt.Errorf("failed to create quarantine directory: %w", err)
+	}
+
+	// earlier failures with the same name are kept
+	filename := availableName(dir, filepath.Base(source))
+
+	// the original locations are kept for retrying the document later
+	original, err := filepath.Abs(source)
+	if err != nil {
+		return fmt.Errorf("failed to find absolute path: %w", err)
+	}
+
+	if !isRemote(destination) {
+		destination, err = filepath.Abs(destination)
+		if err != nil {
+			return fmt.Errorf("failed to find absolute path: %w", err)
+		}
+	}
+
+	// the record is only written for a document that was moved, so there
+	// is no record without a document to retry
+	err = renameFile(source, filename)
+	if err != nil {
+		return fmt.Errorf("failed to quarantine %q: %w", source, err)
+	}
+
+	record := quarantined{
+		Source:      original,
+		Destination: destination,
+		Filename:    proposed,
+		Values:      values,
+	}
+
+	err = record.save(filename, cause)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("quarantine", "source", source, "filename", filename, "error", cause)
+
+	return nil
+}
+
+// availableName returns the filename of name in dir, numbered when a file of
+// that name is already there.
+func availableName(dir, name string) string {
+	ext := filepath.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	filename := filepath.Join(dir, name)
+
+	for i := 1; ; i++ {
+		_, err := os.Lstat(filename)
+		if errors.Is(err, os.ErrNotExist) {
+			return filename
+		}
+
+		filename = filepath.Join(dir, fmt.Sprintf("%s-%d%s", stem, i, ext))
+	}
+}
+
+// save records another failed attempt, and the run it failed in, in the
+// error file of the quarantined document.
+func (q quarantined) save(filename string, cause error) error {
+	q.Run = run.ID
+	q.Error = cause.Error()
+	q.Kind = failureKind(cause)
+	q.Attempts++
+	q.Time = time.Now()
+
+	payload, err := json.MarshalIndent(q, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal quarantine error: %w", err)
+	}
+
+	err = writeFile(filename+".error.json", 0o644, false, func(file io.Writer) error {
+		_, err := file.Write(payload)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write quarantine error: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// quirk is a part of the OpenAI API that a local server, such as llama.cpp
+// or LM Studio, rejects.
+type quirk string
+
+const (
+	// quirkResponseFormat is a server without JSON mode, which is asked
+	// for JSON by the prompt alone.
+	quirkResponseFormat quirk = "response_format"
+	// quirkImageURL is a server that takes an image_url as the URL itself
+	// rather than an object with the URL and its detail.
+	quirkImageURL quirk = "image_url"
+)
+
+// allQuirks are the quirks worked around, in the order they are tried.
+var allQuirks = []quirk{quirkResponseFormat, quirkImageURL}
+
+// quirks are the quirks detected, by endpoint, model, and quirk, so only the
+// first request to a server is rejected for them.
+var quirks sync.Map
+
+// quirksTransport detects what a server rejects from the error it answers
+// with, and sends the request again without it, instead of failing every
+// document.
+type quirksTransport struct {
+	base http.RoundTripper
+}
+
+func (t *quirksTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	if request.Body == nil || !strings.HasSuffix(request.URL.Path, "/chat/completions") {
+		return t.base.RoundTrip(request)
+	}
+
+	body, err := io.ReadAll(request.Body)
+	_ = request.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read request: %w", err)
+	}
+
+	var completion map[string]json.RawMessage
+
+	err = json.Unmarshal(body, &completion)
+	if err != nil {
+		return t.send(request, body)
+	}
+
+	var model string
+	_ = json.Unmarshal(completion["model"], &model)
+
+	key := request.URL.Host + " " + model + " "
+	jsonMode := bytes.Contains(completion["response_format"], []byte("json_object"))
+
+	// quirks found by this request are only kept for the server once a
+	// request without them succeeds, so an unrelated error is not taken
+	// for one
+	found := []quirk{}
+
+	for {
+		detected := slices.Clone(found)
+		for _, q := range allQuirks {
+			if _, ok := quirks.Load(key + string(q)); ok && !slices.Contains(detected, q) {
+				detected = append(detected, q)
+			}
+		}
+
+		payload, err := withoutQuirks(completion, detected)
+		if err != nil {
+			return nil, err
+		}
+
+		response, err := t.send(request, payload)
+		if err != nil || response.StatusCode < 400 {
+			if err == nil {
+				for _, q := range found {
+					slog.Warn("provider.quirk", "host", request.URL.Host, "model", model, "quirk", q)
+					quirks.Store(key+string(q), true)
+				}
+			}
+
+			if err == nil && jsonMode && slices.Contains(detected, quirkResponseFormat) {
+				return jsonResponse(response)
+			}
+
+			return response, err
+		}
+
+		message, err := io.ReadAll(response.Body)
+		_ = response.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read response: %w", err)
+		}
+
+		q := detectQuirk(string(message), completion, detected)
+		if q == "" {
+			response.Body = io.NopCloser(bytes.NewReader(message))
+			return response, nil
+		}
+
+		found = append(found, q)
+	}
+}
+
+func (t *quirksTransport) send(request *http.Request, body []byte) (*http.Response, error) {
+	request = request.Clone(request.Context())
+	request.Body = io.NopCloser(bytes.NewReader(body))
+	request.ContentLength = int64(len(body))
+
+	return t.base.RoundTrip(request)
+}
+
+// detectQuirk finds a quirk the error message is about, which the request
+// has and which was not already worked around. An image_url is only a quirk
+// when the server says it must be a string, as providers also reject images
+// that are too large or unreadable with errors naming it.
+func detectQuirk(message string, completion map[string]json.RawMessage, detected []quirk) quirk {
+	message = strings.ToLower(message)
+
+	_, hasFormat := completion["response_format"]
+	if hasFormat && !slices.Contains(detected, quirkResponseFormat) &&
+		(strings.Contains(message, "response_format") || strings.Contains(message, "json_object")) {
+		return quirkResponseFormat
+	}
+
+	if bytes.Contains(completion["messages"], []byte(`"image_url":{`)) && !slices.Contains(detected, quirkImageURL) &&
+		strings.Contains(message, "image_url") && imageURLSchemaError(message) {
+		return quirkImageURL
+	}
+
+	return ""
+}
+
+// imageURLSchemaError reports whether the lowercased message is a server's
+// complaint that image_url is an object rather than a string.
+func imageURLSchemaError(message string) bool {
+	for _, complaint := range []string{"must be a string", "expected string", "expected a string", "got object", "got an object", "not a string"} {
+		if strings.Contains(message, complaint) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// withoutQuirks removes what the server rejects from the request.
+func withoutQuirks(completion map[string]json.RawMessage, detected []quirk) ([]byte, error) {
+	if len(detected) == 0 {
+		return json.Marshal(completion)
+	}
+
+	request := maps.Clone(completion)
+
+	if slices.Contains(detected, quirkResponseFormat) {
+		delete(request, "response_format")
+	}
+
+	if slices.Contains(detected, quirkImageURL) {
+		var messages []map[string]any
+
+		err := json.Unmarshal(request["messages"], &messages)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal messages: %w", err)
+		}
+
+		for _, message := range messages {
+			parts, ok := message["content"].([]any)
+			if !ok {
+				continue
+			}
+
+			for _, part := range parts {
+				part, ok := part.(map[string]any)
+				if !ok {
+					continue
+				}
+
+				if image, ok := part["image_url"].(map[string]any); ok {
+					part["image_url"] = image["url"]
+				}
+			}
+		}
+
+		request["messages"], err = json.Marshal(messages)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal messages: %w", err)
+		}
+	}
+
+	return json.Marshal(request)
+}
+
+// jsonResponse cuts the JSON object out of the replies of a server without
+// JSON mode, which may wrap it in a code fence or explain it.
+func jsonResponse(response *http.Response) (*http.Response, error) {
+	body, err := io.ReadAll(response.Body)
+	_ = response.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	var completion map[string]any
+
+	err = json.Unmarshal(body, &completion)
+	if err == nil {
+		choices, _ := completion["choices"].([]any)
+		for _, choice := range choices {
+			message, _ := choice.(map[string]any)["message"].(map[string]any)
+			if content, ok := message["content"].(string); ok {
+				message["content"] = jsonObject(content)
+			}
+		}
+
+		if fixed, err := json.Marshal(completion); err == nil {
+			body = fixed
+		}
+	}
+
+	response.Body = io.NopCloser(bytes.NewReader(body))
+	response.ContentLength = int64(len(body))
+	response.Header.Del("Content-Length")
+
+	return response, nil
+}
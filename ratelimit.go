@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// providerLimiter is shared by every worker, so that concurrent documents stay
+// within the provider's limits together.
+var providerLimiter = &rateLimiter{}
+
+// rateLimiter limits requests and tokens over a sliding minute.
+type rateLimiter struct {
+	mu       sync.Mutex
+	requests []time.Time
+	tokens   []tokenUse
+}
+
+type tokenUse struct {
+	time   time.Time
+	tokens int
+}
+
+// wait blocks until a request fits within the requests and tokens per minute,
+// and counts it. A limit of zero is no limit. As the tokens of a request are
+// only known once it is answered, a request waits for earlier usage to leave
+// the window.
+func (l *rateLimiter) wait(ctx context.Context, rpm, tpm int) error {
+	for {
+		delay := l.reserve(rpm, tpm)
+		if delay <= 0 {
+			return nil
+		}
+
+		slog.Info("ratelimit.wait", "delay", delay)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+func (l *rateLimiter) reserve(rpm, tpm int) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	windowStart := now.Add(-time.Minute)
+
+	for len(l.requests) > 0 && !l.requests[0].After(windowStart) {
+		l.requests = l.requests[1:]
+	}
+
+	for len(l.tokens) > 0 && !l.tokens[0].time.After(windowStart) {
+		l.tokens = l.tokens[1:]
+	}
+
+	var delay time.Duration
+
+	if 0 < rpm && rpm <= len(l.requests) {
+		delay = l.requests[len(l.requests)-rpm].Sub(windowStart)
+	}
+
+	if 0 < tpm {
+		used := 0
+		for _, use := range l.tokens {
+			used += use.tokens
+		}
+
+		// the oldest usage leaves the window first
+		for _, use := range l.tokens {
+			if used < tpm {
+				break
+			}
+
+			used -= use.tokens
+			delay = max(delay, use.time.Sub(windowStart))
+		}
+	}
+
+	if 0 < delay {
+		return delay
+	}
+
+	l.requests = append(l.requests, now)
+
+	return 0
+}
+
+// use counts the tokens of an answered request.
+func (l *rateLimiter) use(tokens int) {
+	if tokens == 0 {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.tokens = append(l.tokens, tokenUse{time: time.Now(), tokens: tokens})
+}
@@ -0,0 +1,423 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+const (
+	// receiptDPI renders pages for finding the receipts on them, which
+	// needs only their outlines.
+	receiptDPI = 30
+	// receiptGap is the most space, in inches, between the lines of a
+	// receipt, so that receipts further apart than it are told apart.
+	receiptGap = 0.4
+	// receiptMinSize and receiptMaxWidth, in inches, bound what is taken
+	// for a receipt rather than a smudge or the text of a letter.
+	receiptMinSize  = 1.0
+	receiptMaxWidth = 4.5
+	// receiptMargin is kept around each receipt, in inches, when it is cut
+	// out of the page.
+	receiptMargin = 0.1
+)
+
+// findReceipts returns the areas of the page, at receiptDPI, that hold a
+// receipt each, when there are several. Pixels that differ from the color at
+// the edges of the page are ink, which is spread by half of receiptGap so the
+// lines of a receipt join up, and each group of ink is a receipt.
+func findReceipts(page *image.RGBA) []image.Rectangle {
+	bounds := page.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	gray := func(x, y int) int {
+		pixel := page.Pix[page.PixOffset(bounds.Min.X+x, bounds.Min.Y+y):]
+		return (299*int(pixel[0]) + 587*int(pixel[1]) + 114*int(pixel[2])) / 1000
+	}
+
+	// the scanner's lid shows at the edges
+	edges := []int{}
+	for x := range width {
+		edges = append(edges, gray(x, 0), gray(x, height-1))
+	}
+	for y := range height {
+		edges = append(edges, gray(0, y), gray(width-1, y))
+	}
+	slices.Sort(edges)
+	background := edges[len(edges)/2]
+
+	ink := make([]bool, width*height)
+	for y := range height {
+		for x := range width {
+			difference := gray(x, y) - background
+			ink[y*width+x] = difference < -48 || 48 < difference
+		}
+	}
+
+	ink = spread(ink, width, height, int(receiptGap*receiptDPI/2))
+
+	receipts := []image.Rectangle{}
+	seen := make([]bool, width*height)
+
+	for start := range ink {
+		if !ink[start] || seen[start] {
+			continue
+		}
+
+		area := image.Rect(start%width, start/width, start%width+1, start/width+1)
+		queue := []int{start}
+		seen[start] = true
+
+		for 0 < len(queue) {
+			i := queue[len(queue)-1]
+			queue = queue[:len(queue)-1]
+
+			x, y := i%width, i/width
+			area = area.Union(image.Rect(x, y, x+1, y+1))
+
+			for _, next := range [][2]int{{x - 1, y}, {x + 1, y}, {x, y - 1}, {x, y + 1}} {
+				if next[0] < 0 || width <= next[0] || next[1] < 0 || height <= next[1] {
+					continue
+				}
+
+				j := next[1]*width + next[0]
+				if ink[j] && !seen[j] {
+					seen[j] = true
+					queue = append(queue, j)
+				}
+			}
+		}
+
+		minSize := int(receiptMinSize * receiptDPI)
+		if area.Dx() < minSize || area.Dy() < minSize {
+			continue
+		}
+
+		// a page of text, such as a letter, is not split into its paragraphs
+		if int(receiptMaxWidth*receiptDPI) < area.Dx() {
+			return nil
+		}
+
+		receipts = append(receipts, area)
+	}
+
+	if len(receipts) < 2 {
+		return nil
+	}
+
+	return receipts
+}
+
+// spread marks every pixel within radius of ink as ink too, one axis at a
+// time.
+func spread(ink []bool, width, height, radius int) []bool {
+	horizontal := make([]bool, len(ink))
+	for y := range height {
+		last := -radius - 1
+		for x := range width {
+			if ink[y*width+x] {
+				last = x
+			}
+			horizontal[y*width+x] = x-last <= radius
+		}
+
+		last = width + radius
+		for x := width - 1; 0 <= x; x-- {
+			if ink[y*width+x] {
+				last = x
+			}
+			horizontal[y*width+x] = horizontal[y*width+x] || last-x <= radius
+		}
+	}
+
+	spread := make([]bool, len(ink))
+	for x := range width {
+		last := -radius - 1
+		for y := range height {
+			if horizontal[y*width+x] {
+				last = y
+			}
+			spread[y*width+x] = y-last <= radius
+		}
+
+		last = height + radius
+		for y := height - 1; 0 <= y; y-- {
+			if horizontal[y*width+x] {
+				last = y
+			}
+			spread[y*width+x] = spread[y*width+x] || last-y <= radius
+		}
+	}
+
+	return spread
+}
+
+// splitReceipts writes each receipt found on the only page of the document
+// as a PDF of its own into dir, returning their filenames, or none when the
+// document is not a page of several receipts.
+func splitReceipts(source, dir string) ([]string, error) {
+	doc, err := openPDF(source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open PDF: %w", err)
+	}
+	defer doc.Close()
+
+	if doc.NumPage() != 1 {
+		return nil, nil
+	}
+
+	outlines, err := doc.ImageDPI(0, receiptDPI)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert page #0 to image: %w", err)
+	}
+
+	receipts := findReceipts(outlines)
+	if len(receipts) == 0 {
+		return nil, nil
+	}
+
+	page, err := doc.ImageDPI(0, pageDPI)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert page #0 to image: %w", err)
+	}
+
+	stem := strings.TrimSuffix(filepath.Base(source), filepath.Ext(source))
+	filenames := []string{}
+
+	for i, receipt := range receipts {
+		// the areas are scaled up to the page's resolution, with a margin
+		margin := int(receiptMargin * receiptDPI)
+		area := image.Rect(
+			(receipt.Min.X-margin)*pageDPI/receiptDPI,
+			(receipt.Min.Y-margin)*pageDPI/receiptDPI,
+			(receipt.Max.X+margin)*pageDPI/receiptDPI,
+			(receipt.Max.Y+margin)*pageDPI/receiptDPI,
+		).Add(page.Bounds().Min).Intersect(page.Bounds())
+
+		filename := filepath.Join(dir, fmt.Sprintf("%s-%d.pdf", stem, i+1))
+
+		err = writeFile(filename, 0o644, false, func(file io.Writer) error {
+			return writeImagePDF(file, page.SubImage(area), pageDPI)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to write receipt %d: %w", i+1, err)
+		}
+
+		filenames = append(filenames, filename)
+	}
+
+	slog.Info("receipts.split", "source", source, "receipts", len(filenames))
+
+	return filenames, nil
+}
+
+// writeImagePDF writes a PDF of a single page showing the image at its
+// resolution, as fitz cannot write PDFs.
+func writeImagePDF(w io.Writer, picture image.Image, dpi float64) error {
+	photo := &bytes.Buffer{}
+
+	err := jpeg.Encode(photo, picture, &jpeg.Options{Quality: 90})
+	if err != nil {
+		return fmt.Errorf("failed to encode image: %w", err)
+	}
+
+	size := picture.Bounds().Size()
+	width, height := float64(size.X)*72/dpi, float64(size.Y)*72/dpi
+	content := fmt.Sprintf("q %.2f 0 0 %.2f 0 0 cm /Image Do Q", width, height)
+
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] /Resources << /XObject << /Image 4 0 R >> >> /Contents 5 0 R >>", width, height),
+		fmt.Sprintf("<< /Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceRGB /BitsPerComponent 8 /Filter /DCTDecode /Length %d >>\nstream\n%s\nendstream", size.X, size.Y, photo.Len(), photo.Bytes()),
+		fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(content), content),
+	}
+
+	pdf := &bytes.Buffer{}
+	pdf.WriteString("%PDF-1.4\n")
+
+	offsets := []int{}
+	for i, object := range objects {
+		offsets = append(offsets, pdf.Len())
+		fmt.Fprintf(pdf, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+
+	xref := pdf.Len()
+	fmt.Fprintf(pdf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(pdf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(pdf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+
+	_, err = w.Write(pdf.Bytes())
+
+	return err
+}
+
+// receiptProgress records the receipts of a page that were renamed, in a
+// `.receipts.json` file next to it, so that renaming the page again after
+// some of its receipts failed does not file the others twice.
+type receiptProgress struct {
+	Receipts int            `json:"receipts"`
+	Renamed  map[int]string `json:"renamed"`
+
+	filename string
+}
+
+func loadReceiptProgress(source string, receipts int) (*receiptProgress, error) {
+	progress := &receiptProgress{
+		Receipts: receipts,
+		Renamed:  map[int]string{},
+		filename: source + ".receipts.json",
+	}
+
+	contents, err := os.ReadFile(progress.filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return progress, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read receipt progress: %w", err)
+	}
+
+	err = json.Unmarshal(contents, progress)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal receipt progress: %w", err)
+	}
+
+	if progress.Receipts != receipts {
+		return nil, fmt.Errorf("%q was split into %d receipts before and %d now, remove %s to rename them all again", source, progress.Receipts, receipts, progress.filename)
+	}
+
+	return progress, nil
+}
+
+func (p *receiptProgress) save() error {
+	payload, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal receipt progress: %w", err)
+	}
+
+	err = writeFile(p.filename, 0o644, false, func(file io.Writer) error {
+		_, err := file.Write(payload)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write receipt progress: %w", err)
+	}
+
+	return nil
+}
+
+// renameReceipts renames each receipt on a page of several as a document of
+// its own, named after the original. Receipts renamed before are skipped.
+// Once every receipt is renamed, the original is set aside by fileSplit. A
+// document that is not a page of several receipts is renamed as usual.
+func (c *RenameCmd) renameReceipts(ctx context.Context, source string) (bool, error) {
+	staging, err := os.MkdirTemp("", "pdfrenamer-receipts-*")
+	if err != nil {
+		return false, fmt.Errorf("failed to create staging directory: %w", err)
+	}
+	defer func() { _ = os.RemoveAll(staging) }()
+
+	receipts, err := splitReceipts(source, staging)
+	if err != nil || len(receipts) == 0 {
+		return false, err
+	}
+
+	progress, err := loadReceiptProgress(source, len(receipts))
+	if err != nil {
+		return true, err
+	}
+
+	flags := c.RenameFlags
+	flags.dir = c.Destination
+	flags.originalName = filepath.Base(source)
+
+	results := &batch{}
+
+	for i, receipt := range receipts {
+		name := fmt.Sprintf("%s#%d", source, i+1)
+
+		if filename, ok := progress.Renamed[i+1]; ok {
+			slog.Info("receipts.skip", "source", name, "filename", filename)
+			continue
+		}
+
+		filename, err := flags.rename(ctx, receipt)
+		if err != nil {
+			results.add(name, errors.Join(err, flags.quarantine(receipt, c.Destination, err)))
+			continue
+		}
+
+		results.add(name, nil)
+		c.report(name, filename)
+
+		if c.DryRun {
+			continue
+		}
+
+		progress.Renamed[i+1] = filename
+
+		err = progress.save()
+		if err != nil {
+			return true, err
+		}
+	}
+
+	if 0 < len(results.failures) {
+		results.summarize(os.Stderr)
+		return true, results.err()
+	}
+
+	if c.DryRun {
+		return true, nil
+	}
+
+	return true, c.fileSplit(source, progress)
+}
+
+// fileSplit moves a page whose receipts were all renamed into the review
+// directory, or the quarantine directory, for checking how it was cut, and
+// records the move in the run so that undo moves it back. Without either
+// directory, the page is kept where it is, and its progress keeps it from
+// being split again.
+func (c *RenameCmd) fileSplit(source string, progress *receiptProgress) error {
+	dir := cmp.Or(c.ReviewDir, c.QuarantineDir)
+	if dir == "" {
+		slog.Info("receipts.keep", "source", source, "progress", progress.filename)
+		return nil
+	}
+
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return fmt.Errorf("failed to create review directory: %w", err)
+	}
+
+	filename := availableName(dir, filepath.Base(source))
+
+	err = renameFile(source, filename)
+	if err != nil {
+		return fmt.Errorf("failed to file split document: %w", err)
+	}
+
+	run.renamed(source, filename)
+	slog.Info("receipts.file", "source", source, "filename", filename)
+
+	err = os.Remove(progress.filename)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove receipt progress: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"unicode/utf8"
+)
+
+// contentLogKeys are the log attributes that hold a document's content: its
+// markdown, the values extracted from it, the prompts rendered with them, and
+// the names, folders, and categories made of them.
+var contentLogKeys = []string{
+	"markdown", "payload", "values", "value", "known", "extracted", "prompt",
+	"addressee", "folder", "category", "violation",
+	"filename", "destination", "dst", "new",
+}
+
+// redactLogs is whether the logs are redacted, for the errors written to
+// stderr outside of them.
+var redactLogs bool
+
+// newLogger logs JSON to the writer. With redact, the attributes that hold a
+// document's content are replaced with a hash and their length, which still
+// tells whether two runs saw the same content.
+func newLogger(w io.Writer, redact bool) *slog.Logger {
+	options := &slog.HandlerOptions{}
+	if redact {
+		options.ReplaceAttr = redactContent
+	}
+
+	return slog.New(slog.NewJSONHandler(w, options)).With("run", run.ID)
+}
+
+func redactContent(_ []string, attr slog.Attr) slog.Attr {
+	// errors quote the values, names, and proposed renames they failed on,
+	// so only their kind is kept
+	if err, ok := attr.Value.Any().(error); ok {
+		return slog.String(attr.Key, failureKind(err)+": "+redactedContent(err.Error()))
+	}
+
+	if !slices.Contains(contentLogKeys, attr.Key) {
+		return attr
+	}
+
+	if values, ok := attr.Value.Any().(map[string]string); ok {
+		redacted := make(map[string]string, len(values))
+		for key, value := range values {
+			redacted[key] = redactedContent(value)
+		}
+
+		return slog.Any(attr.Key, redacted)
+	}
+
+	return slog.String(attr.Key, redactedContent(fmt.Sprint(attr.Value.Any())))
+}
+
+// errorText is the message of an error written to stderr, as a hash when the
+// logs are redacted.
+func errorText(err error) string {
+	if !redactLogs {
+		return err.Error()
+	}
+
+	return redactedContent(err.Error())
+}
+
+func redactedContent(content string) string {
+	if content == "" {
+		return ""
+	}
+
+	hash := sha256.Sum256([]byte(content))
+
+	return fmt.Sprintf("sha256:%s (%d chars)", hex.EncodeToString(hash[:6]), utf8.RuneCountInString(content))
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/alecthomas/kong"
+)
+
+// regions are the named parts of a page for --page-region, as the left, top,
+// right, and bottom of the part in fractions of the page.
+var regions = map[string][4]float64{
+	"top-half":     {0, 0, 1, 0.5},
+	"bottom-half":  {0, 0.5, 1, 1},
+	"top-third":    {0, 0, 1, 1.0 / 3},
+	"top-quarter":  {0, 0, 1, 0.25},
+	"left-half":    {0, 0, 0.5, 1},
+	"right-half":   {0.5, 0, 1, 1},
+	"bottom-third": {0, 2.0 / 3, 1, 1},
+}
+
+// pageRegion is the part of each page sent to the image model, such as the
+// letterhead, which is enough for the title and date of a long letter at a
+// fraction of the tokens. The zero value is the whole page.
+type pageRegion struct {
+	name  string
+	bound [4]float64
+}
+
+func (r *pageRegion) Decode(ctx *kong.DecodeContext) error {
+	var value string
+
+	err := ctx.Scan.PopValueInto("region", &value)
+	if err != nil {
+		return err
+	}
+
+	region, err := parseRegion(value)
+	if err != nil {
+		return err
+	}
+
+	*r = region
+
+	return nil
+}
+
+func (r pageRegion) MarshalText() ([]byte, error) {
+	return []byte(r.name), nil
+}
+
+// parseRegion reads a named region, or the left, top, right, and bottom of
+// one in fractions of the page, from its top left, such as 0,0,1,0.2.
+func parseRegion(value string) (pageRegion, error) {
+	if bound, ok := regions[value]; ok {
+		return pageRegion{name: value, bound: bound}, nil
+	}
+
+	edges := strings.Split(value, ",")
+	if len(edges) != 4 {
+		return pageRegion{}, fmt.Errorf("region must be one of %s, or left,top,right,bottom in fractions of the page, got %q", strings.Join(slices.Sorted(maps.Keys(regions)), ", "), value)
+	}
+
+	region := pageRegion{name: value}
+
+	for i, edge := range edges {
+		fraction, err := strconv.ParseFloat(strings.TrimSpace(edge), 64)
+		if err != nil || fraction < 0 || 1 < fraction {
+			return pageRegion{}, fmt.Errorf("region edge %q must be a fraction of the page from 0 to 1", edge)
+		}
+
+		region.bound[i] = fraction
+	}
+
+	if region.bound[2] <= region.bound[0] || region.bound[3] <= region.bound[1] {
+		return pageRegion{}, fmt.Errorf("region %q must have its right and bottom past its left and top", value)
+	}
+
+	return region, nil
+}
+
+// whole reports whether the region is the whole page.
+func (r pageRegion) whole() bool {
+	return r.name == ""
+}
+
+// crop returns the region of the page's image.
+func (r pageRegion) crop(page *image.RGBA) image.Image {
+	if r.whole() {
+		return page
+	}
+
+	bounds := page.Bounds()
+	width, height := float64(bounds.Dx()), float64(bounds.Dy())
+
+	return page.SubImage(image.Rect(
+		bounds.Min.X+int(r.bound[0]*width),
+		bounds.Min.Y+int(r.bound[1]*height),
+		bounds.Min.X+int(r.bound[2]*width),
+		bounds.Min.Y+int(r.bound[3]*height),
+	))
+}
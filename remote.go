@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+type RemoteCmd struct {
+	Filename string `arg:"" type:"existingfile" help:"PDF file to rename"`
+
+	Server       string        `help:"URL of the pdfrenamer server" env:"PDFRENAMER_SERVER" required:""`
+	PollInterval time.Duration `help:"how often to check if the server has finished" default:"2s"`
+	Timeout      time.Duration `help:"how long to wait for the server to finish" default:"10m"`
+
+	DryRun bool `help:"do not rename files, just print what would be done"`
+}
+
+// Run uploads the file for a dry run on the server, which holds the API keys
+// and configuration, and then applies the proposed name locally.
+func (c *RemoteCmd) Run() error {
+	unlock, err := lockFile(c.Filename)
+	if err != nil {
+		return fmt.Errorf("failed to acquire lock: %w", err)
+	}
+	defer func() { _ = unlock() }()
+
+	base, err := url.Parse(c.Server)
+	if err != nil {
+		return fmt.Errorf("failed to parse server URL: %w", err)
+	}
+
+	uploaded, err := c.upload(base.JoinPath("documents").String())
+	if err != nil {
+		return err
+	}
+
+	slog.Info("remote.upload", "id", uploaded.ID)
+
+	finished, err := c.wait(base.JoinPath("documents", uploaded.ID).String())
+	if err != nil {
+		return err
+	}
+
+	if finished.Status == jobFailed {
+		return fmt.Errorf("server failed to rename file: %s", finished.Error)
+	}
+
+	if !filepath.IsLocal(finished.Name) {
+		return fmt.Errorf("server proposed a name outside the current directory: %q", finished.Name)
+	}
+
+	if c.DryRun {
+		fmt.Println(finished.Name)
+		return nil
+	}
+
+	err = os.MkdirAll(filepath.Dir(finished.Name), 0o755)
+	if err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	err = refuseOverwrite(c.Filename, finished.Name)
+	if err != nil {
+		return fmt.Errorf("failed to rename file: %w", err)
+	}
+
+	err = renameFile(c.Filename, finished.Name)
+	if err != nil {
+		return fmt.Errorf("failed to rename file: %w", err)
+	}
+
+	return nil
+}
+
+func (c *RemoteCmd) upload(endpoint string) (job, error) {
+	file, err := os.Open(c.Filename)
+	if err != nil {
+		return job{}, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	body, writer := io.Pipe()
+	form := multipart.NewWriter(writer)
+
+	go func() {
+		part, err := form.CreateFormFile("file", filepath.Base(c.Filename))
+		if err == nil {
+			_, err = io.Copy(part, file)
+		}
+		if err == nil {
+			err = form.WriteField("dry_run", "true")
+		}
+		if err == nil {
+			err = form.Close()
+		}
+
+		_ = writer.CloseWithError(err)
+	}()
+
+	response, err := http.Post(endpoint, form.FormDataContentType(), body)
+	if err != nil {
+		return job{}, fmt.Errorf("failed to upload file: %w", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusAccepted {
+		return job{}, fmt.Errorf("failed to upload file: %w", responseError(response))
+	}
+
+	var uploaded job
+
+	err = json.NewDecoder(response.Body).Decode(&uploaded)
+	if err != nil {
+		return job{}, fmt.Errorf("failed to decode upload response: %w", err)
+	}
+
+	return uploaded, nil
+}
+
+func (c *RemoteCmd) wait(endpoint string) (job, error) {
+	deadline := time.Now().Add(c.Timeout)
+
+	for time.Now().Before(deadline) {
+		response, err := http.Get(endpoint)
+		if err != nil {
+			return job{}, fmt.Errorf("failed to check job: %w", err)
+		}
+
+		var current job
+
+		if response.StatusCode != http.StatusOK {
+			err = responseError(response)
+		} else {
+			err = json.NewDecoder(response.Body).Decode(&current)
+		}
+
+		_ = response.Body.Close()
+
+		if err != nil {
+			return job{}, fmt.Errorf("failed to check job: %w", err)
+		}
+
+		if current.Status == jobDone || current.Status == jobFailed {
+			return current, nil
+		}
+
+		time.Sleep(c.PollInterval)
+	}
+
+	return job{}, errors.New("timed out waiting for the server")
+}
+
+// responseError reads the error returned by the server.
+func responseError(response *http.Response) error {
+	var payload struct {
+		Error string `json:"error"`
+	}
+
+	err := json.NewDecoder(response.Body).Decode(&payload)
+	if err != nil || payload.Error == "" {
+		return fmt.Errorf("unexpected status %s", response.Status)
+	}
+
+	return errors.New(payload.Error)
+}
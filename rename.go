@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// renameFile moves src to dst. When they are on different devices, where
+// os.Rename fails with EXDEV, the file is copied, synced, verified, and only
+// then is the source removed.
+func renameFile(src, dst string) error {
+	err := os.Rename(src, dst)
+	if err == nil {
+		syncDir(filepath.Dir(dst))
+		return nil
+	}
+
+	if !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+
+	slog.Info("rename.copy", "src", src, "dst", dst)
+
+	err = copyFile(src, dst)
+	if err != nil {
+		return fmt.Errorf("failed to copy across filesystems: %w", err)
+	}
+
+	err = os.Remove(src)
+	if err != nil {
+		return fmt.Errorf("failed to remove source after copy: %w", err)
+	}
+
+	return nil
+}
+
+// copyFile copies src into a temporary file next to dst, fsyncs it, verifies
+// its checksum, and then moves it into place.
+func copyFile(src, dst string) error {
+	source, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to open source: %w", err)
+	}
+	defer source.Close()
+
+	info, err := source.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat source: %w", err)
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+
+	tempName := temp.Name()
+	defer func() { _ = os.Remove(tempName) }()
+
+	sourceHash := sha256.New()
+
+	_, err = io.Copy(temp, io.TeeReader(source, sourceHash))
+	if err != nil {
+		_ = temp.Close()
+		return fmt.Errorf("failed to copy contents: %w", err)
+	}
+
+	err = temp.Sync()
+	if err != nil {
+		_ = temp.Close()
+		return fmt.Errorf("failed to sync temporary file: %w", err)
+	}
+
+	err = temp.Close()
+	if err != nil {
+		return fmt.Errorf("failed to close temporary file: %w", err)
+	}
+
+	destinationHash, err := hashFile(tempName)
+	if err != nil {
+		return fmt.Errorf("failed to verify copy: %w", err)
+	}
+
+	if !bytes.Equal(sourceHash.Sum(nil), destinationHash) {
+		return fmt.Errorf("checksum mismatch after copying %q", src)
+	}
+
+	err = os.Chmod(tempName, info.Mode().Perm())
+	if err != nil {
+		return fmt.Errorf("failed to preserve permissions: %w", err)
+	}
+
+	err = os.Chtimes(tempName, info.ModTime(), info.ModTime())
+	if err != nil {
+		return fmt.Errorf("failed to preserve modification time: %w", err)
+	}
+
+	err = os.Rename(tempName, dst)
+	if err != nil {
+		return fmt.Errorf("failed to move copy into place: %w", err)
+	}
+
+	syncDir(filepath.Dir(dst))
+
+	return nil
+}
+
+func hashFile(filename string) ([]byte, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+
+	_, err = io.Copy(hash, file)
+	if err != nil {
+		return nil, err
+	}
+
+	return hash.Sum(nil), nil
+}
+
+// refuseOverwrite returns an error when filename is taken by another file
+// than source. The same file under another name, such as a rename that only
+// changes its case on a case-insensitive file system, is not an error.
+func refuseOverwrite(source, filename string) error {
+	existing, err := os.Stat(filename)
+	if err != nil {
+		return nil
+	}
+
+	current, err := os.Stat(source)
+	if err != nil || !os.SameFile(existing, current) {
+		return &os.PathError{Op: "rename", Path: filename, Err: os.ErrExist}
+	}
+
+	return nil
+}
+
+// writeFile writes a file through a synced temporary file next to it, which
+// is then moved into place, so a crash never leaves it half written. With
+// exclusive, an existing file is not replaced and os.ErrExist is returned.
+func writeFile(filename string, perm os.FileMode, exclusive bool, write func(io.Writer) error) error {
+	temp, err := os.CreateTemp(filepath.Dir(filename), "."+filepath.Base(filename)+".*.tmp")
+	if err != nil {
+		return err
+	}
+
+	tempName := temp.Name()
+	defer func() { _ = os.Remove(tempName) }()
+
+	err = write(temp)
+	if err == nil {
+		err = temp.Sync()
+	}
+	if err == nil {
+		err = temp.Chmod(perm)
+	}
+
+	closeErr := temp.Close()
+	if err != nil {
+		return err
+	}
+	if closeErr != nil {
+		return closeErr
+	}
+
+	if exclusive {
+		// a hard link fails when the file exists, where a rename would
+		// replace it
+		err = os.Link(tempName, filename)
+
+		// filesystems without hard links, such as SMB shares, are checked
+		// first instead
+		if err != nil && !errors.Is(err, os.ErrExist) {
+			_, err = os.Lstat(filename)
+			if err != nil {
+				err = os.Rename(tempName, filename)
+			} else {
+				err = os.ErrExist
+			}
+		}
+
+		if errors.Is(err, os.ErrExist) {
+			return &os.PathError{Op: "create", Path: filename, Err: os.ErrExist}
+		}
+	} else {
+		err = os.Rename(tempName, filename)
+	}
+	if err != nil {
+		return err
+	}
+
+	syncDir(filepath.Dir(filename))
+
+	return nil
+}
+
+// syncFile sets the permissions of a file written by another program and
+// flushes it to disk, before it is moved into place.
+func syncFile(filename string, perm os.FileMode) error {
+	file, err := os.OpenFile(filename, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	err = file.Chmod(perm)
+	if err != nil {
+		return err
+	}
+
+	return file.Sync()
+}
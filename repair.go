@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+
+	"github.com/gen2brain/go-fitz"
+)
+
+// openPDF opens the PDF, repairing it first when it cannot be opened as is.
+// Scanners and email gateways often produce PDFs with junk around them, such
+// as MIME headers before %PDF- or padding after %%EOF, or truncated ones.
+func openPDF(filename string) (*fitz.Document, error) {
+	doc, err := fitz.New(filename)
+	if err == nil {
+		return doc, nil
+	}
+
+	slog.Warn("pdf.repair", "filename", filename, "error", err)
+
+	data, readErr := os.ReadFile(filename)
+	if readErr != nil {
+		return nil, fmt.Errorf("failed to read PDF: %w", readErr)
+	}
+
+	if repaired, ok := repairPDF(data); ok {
+		doc, repairErr := fitz.NewFromMemory(repaired)
+		if repairErr == nil {
+			slog.Info("pdf.repaired", "filename", filename)
+			return doc, nil
+		}
+	}
+
+	// qpdf rebuilds the cross-reference table and objects of PDFs too broken
+	// for the trimming above, when it is installed
+	if rewritten, qpdfErr := qpdfRewrite(filename); qpdfErr == nil {
+		doc, rewriteErr := fitz.NewFromMemory(rewritten)
+		if rewriteErr == nil {
+			slog.Info("pdf.repaired", "filename", filename, "with", "qpdf")
+			return doc, nil
+		}
+	} else {
+		slog.Debug("pdf.qpdf", "filename", filename, "error", qpdfErr)
+	}
+
+	return nil, err
+}
+
+// repairPDF trims everything before the %PDF- header and after the last
+// %%EOF marker, adding the marker when the file was truncated. It reports
+// false when there was nothing to repair.
+func repairPDF(data []byte) ([]byte, bool) {
+	start := bytes.Index(data, []byte("%PDF-"))
+	if start < 0 {
+		return nil, false
+	}
+
+	repaired := data[start:]
+
+	if end := bytes.LastIndex(repaired, []byte("%%EOF")); 0 <= end {
+		repaired = repaired[:end+len("%%EOF")]
+	} else {
+		repaired = append(bytes.Clone(repaired), []byte("\n%%EOF\n")...)
+	}
+
+	if bytes.Equal(repaired, data) {
+		return nil, false
+	}
+
+	return repaired, true
+}
+
+func qpdfRewrite(filename string) ([]byte, error) {
+	path, err := exec.LookPath("qpdf")
+	if err != nil {
+		return nil, fmt.Errorf("failed to find qpdf: %w", err)
+	}
+
+	stderr := &bytes.Buffer{}
+
+	cmd := exec.Command(path, "--warning-exit-0", filename, "-")
+	cmd.Stderr = stderr
+
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+
+	if len(output) == 0 {
+		return nil, errors.New("qpdf wrote nothing")
+	}
+
+	return output, nil
+}
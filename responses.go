@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// visionInput is how pages are given to the image model.
+const (
+	visionInputDataURL  = "data-url"
+	visionInputFile     = "file"
+	visionInputDocument = "document"
+)
+
+// responsesRequest is a request to the Responses API, which, unlike chat
+// completions, references images and PDFs uploaded to the file API by ID.
+type responsesRequest struct {
+	Model        string          `json:"model"`
+	Instructions string          `json:"instructions,omitempty"`
+	Input        []responseInput `json:"input"`
+}
+
+type responseInput struct {
+	Role    string                 `json:"role"`
+	Content []responseInputContent `json:"content"`
+}
+
+type responseInputContent struct {
+	Type   string `json:"type"`
+	Text   string `json:"text,omitempty"`
+	FileID string `json:"file_id,omitempty"`
+	Detail string `json:"detail,omitempty"`
+}
+
+type responsesResponse struct {
+	Output []struct {
+		Type    string `json:"type"`
+		Content []struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		} `json:"content"`
+	} `json:"output"`
+	Usage struct {
+		InputTokens        int `json:"input_tokens"`
+		OutputTokens       int `json:"output_tokens"`
+		TotalTokens        int `json:"total_tokens"`
+		InputTokensDetails struct {
+			CachedTokens int `json:"cached_tokens"`
+		} `json:"input_tokens_details"`
+	} `json:"usage"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// usage is the token usage of the response, as chat completions report it.
+func (r responsesResponse) usage() openai.Usage {
+	return openai.Usage{
+		PromptTokens:     r.Usage.InputTokens,
+		CompletionTokens: r.Usage.OutputTokens,
+		TotalTokens:      r.Usage.TotalTokens,
+		PromptTokensDetails: &openai.PromptTokensDetails{
+			CachedTokens: r.Usage.InputTokensDetails.CachedTokens,
+		},
+	}
+}
+
+// text is the output text of the response.
+func (r responsesResponse) text() string {
+	text := &strings.Builder{}
+
+	for _, output := range r.Output {
+		for _, content := range output.Content {
+			if content.Type == "output_text" {
+				text.WriteString(content.Text)
+			}
+		}
+	}
+
+	return text.String()
+}
+
+// respond sends a request to the Responses API for a stage of the pipeline,
+// within the same rate limits and circuit breaker as chat completions.
+func (c *RenameFlags) respond(ctx context.Context, stage string, request responsesRequest) (string, error) {
+	response := responsesResponse{}
+
+	err := c.callProvider(ctx, stage, request.Model, func(ctx context.Context, _ *span) (openai.Usage, error) {
+		var err error
+
+		response, err = c.postResponses(ctx, request)
+
+		return response.usage(), err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return response.text(), nil
+}
+
+func (c *RenameFlags) postResponses(ctx context.Context, request responsesRequest) (responsesResponse, error) {
+	var response responsesResponse
+
+	err := c.postJSON(ctx, "/responses", request, &response)
+	if err != nil && response.Error != nil {
+		return response, fmt.Errorf("provider returned an error: %s", response.Error.Message)
+	}
+
+	return response, err
+}
+
+// postJSON sends a request to an endpoint of the provider that the OpenAI
+// client does not cover, unmarshaling the response, or the error it returned.
+func (c *RenameFlags) postJSON(ctx context.Context, path string, request, response any) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	endpoint := c.Endpoint
+	if endpoint == "" {
+		endpoint = openai.DefaultConfig("").BaseURL
+	}
+
+	httpRequest, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(endpoint, "/")+path, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	httpRequest.Header.Set("Content-Type", "application/json")
+	httpRequest.Header.Set("Authorization", "Bearer "+c.ApiKey)
+
+	httpResponse, err := c.httpClient().Do(httpRequest)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer httpResponse.Body.Close()
+
+	payload, err := io.ReadAll(httpResponse.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+
+	err = json.Unmarshal(payload, response)
+	if httpResponse.StatusCode != http.StatusOK {
+		return providerError{fmt.Errorf("provider returned %s: %s", httpResponse.Status, strings.TrimSpace(string(payload)))}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	return nil
+}
+
+// upload stores the contents in the provider's file API for the purpose,
+// returning its ID and a function that deletes it once it was used.
+func upload(ctx context.Context, client *openai.Client, name string, contents []byte, purpose string) (string, func(), error) {
+	file, err := client.CreateFileBytes(ctx, openai.FileBytesRequest{
+		Name:    name,
+		Bytes:   contents,
+		Purpose: openai.PurposeType(purpose),
+	})
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to upload %s: %w", name, err)
+	}
+
+	slog.Info("file.upload", "name", name, "id", file.ID, "bytes", len(contents))
+
+	remove := func() {
+		// the request is done, so the upload is removed even once the
+		// document's context is canceled
+		err := client.DeleteFile(context.WithoutCancel(ctx), file.ID)
+		if err != nil {
+			slog.Warn("file.delete", "id", file.ID, "error", err)
+		}
+	}
+
+	return file.ID, remove, nil
+}
+
+// convertPageFile converts a page to markdown with the Responses API, with
+// its image uploaded to the file API instead of sent as a data URL.
+func (c *RenameFlags) convertPageFile(ctx context.Context, client *openai.Client, model string, n int, systemPrompt string, parts []openai.ChatMessagePart) (string, error) {
+	content := []responseInputContent{}
+
+	for _, part := range parts {
+		if part.ImageURL == nil {
+			content = append(content, responseInputContent{Type: "input_text", Text: part.Text})
+			continue
+		}
+
+		_, encoded, ok := strings.Cut(part.ImageURL.URL, ";base64,")
+		if !ok {
+			return "", errors.New("failed to upload page image: it is not a data URL")
+		}
+
+		image, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return "", fmt.Errorf("failed to decode page image: %w", err)
+		}
+
+		id, remove, err := upload(ctx, client, fmt.Sprintf("page-%d.jpg", n), image, "vision")
+		if err != nil {
+			return "", err
+		}
+		defer remove()
+
+		content = append(content, responseInputContent{Type: "input_image", FileID: id, Detail: string(part.ImageURL.Detail)})
+	}
+
+	return c.respond(ctx, "markdown", responsesRequest{
+		Model:        model,
+		Instructions: systemPrompt,
+		Input:        []responseInput{{Role: "user", Content: content}},
+	})
+}
+
+// promptDocument is given with a whole PDF, which the image model converts in
+// one request instead of page by page.
+const promptDocument = "The whole PDF document is attached instead of an image of a page. Convert every page in order, separating the pages with a blank line."
+
+// documentMarkdown converts the whole PDF to markdown in one request, with
+// the PDF uploaded to the file API, for models that read documents.
+func (c *RenameFlags) documentMarkdown(ctx context.Context, client *openai.Client, source string) (string, error) {
+	contents, err := os.ReadFile(source)
+	if err != nil {
+		return "", fmt.Errorf("failed to read PDF: %w", err)
+	}
+
+	id, remove, err := upload(ctx, client, filepath.Base(source), contents, "user_data")
+	if err != nil {
+		return "", err
+	}
+	defer remove()
+
+	slog.Info("pdf.markdown", "document", source)
+
+	markdown, err := c.respond(ctx, "markdown", responsesRequest{
+		Model:        c.ImageModel,
+		Instructions: c.markdownPrompt(),
+		Input: []responseInput{{
+			Role: "user",
+			Content: []responseInputContent{
+				{Type: "input_text", Text: promptDocument},
+				{Type: "input_file", FileID: id},
+			},
+		}},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to convert document to markdown: %w", err)
+	}
+
+	return markdown, nil
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type RetryCmd struct {
+	S3Endpoint string `help:"S3 endpoint for S3 compatible storage, using path-style addressing" name:"s3-endpoint"`
+	RunID      string `help:"only retry the documents that last failed in this run" name:"run"`
+
+	RenameFlags `embed:""`
+}
+
+// Run renames each quarantined document into the destination it originally
+// had. Documents that fail again stay in quarantine with the new error.
+func (c *RetryCmd) Run() error {
+	if c.QuarantineDir == "" {
+		return errors.New("retry requires --quarantine-dir")
+	}
+
+	records, err := filepath.Glob(filepath.Join(c.QuarantineDir, "*.error.json"))
+	if err != nil {
+		return fmt.Errorf("failed to list quarantine: %w", err)
+	}
+
+	ctx := context.Background()
+	results := &batch{}
+
+	for _, record := range records {
+		filename := strings.TrimSuffix(record, ".error.json")
+
+		if c.RunID != "" {
+			failed, err := loadQuarantined(filename)
+			if err == nil && failed.Run != c.RunID {
+				continue
+			}
+		}
+
+		results.add(filepath.Base(filename), c.retry(ctx, filename))
+	}
+
+	results.summarize(os.Stderr)
+
+	return results.err()
+}
+
+func (c *RetryCmd) retry(ctx context.Context, filename string) error {
+	record, err := loadQuarantined(filename)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("retry", "filename", filename, "source", record.Source, "attempts", record.Attempts)
+
+	rename := &RenameCmd{
+		Filenames:   []string{filename},
+		RenameFlags: c.RenameFlags,
+		StorageFlags: StorageFlags{
+			Destination: record.Destination,
+			S3Endpoint:  c.S3Endpoint,
+		},
+	}
+	// a failed document is already in quarantine, and one left for review is
+	// moved along with its record by refile
+	rename.QuarantineDir = ""
+	rename.ReviewDir = ""
+
+	err = rename.renameDocument(ctx, filename)
+	if err != nil {
+		if c.DryRun {
+			return err
+		}
+
+		return errors.Join(err, c.refile(filename, record, err))
+	}
+
+	if c.DryRun {
+		return nil
+	}
+
+	err = os.Remove(filename + ".error.json")
+	if err != nil {
+		return fmt.Errorf("failed to remove quarantine error: %w", err)
+	}
+
+	return nil
+}
+
+// refile records another failed attempt of a quarantined document. A document
+// that is now left for review is moved into the review directory, and its
+// record with it, so the record stays next to the document. The record of a
+// document that was renamed before failing is removed, as it is no longer in
+// quarantine.
+func (c *RetryCmd) refile(filename string, record quarantined, cause error) error {
+	var (
+		review  reviewable
+		renamed renamedError
+	)
+
+	if errors.As(cause, &renamed) {
+		err := os.Remove(filename + ".error.json")
+		if err != nil {
+			return fmt.Errorf("failed to remove quarantine error: %w", err)
+		}
+
+		return nil
+	}
+
+	if c.ReviewDir == "" || !errors.As(cause, &review) {
+		record.Filename, record.Values = "", nil
+		return record.save(filename, cause)
+	}
+
+	record.Filename, record.Values = review.proposed()
+
+	err := os.MkdirAll(c.ReviewDir, 0o755)
+	if err != nil {
+		return fmt.Errorf("failed to create review directory: %w", err)
+	}
+
+	reviewed := availableName(c.ReviewDir, filepath.Base(filename))
+
+	err = renameFile(filename, reviewed)
+	if err != nil {
+		return fmt.Errorf("failed to move %q for review: %w", filename, err)
+	}
+
+	err = record.save(reviewed, cause)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(filename + ".error.json")
+	if err != nil {
+		return fmt.Errorf("failed to remove quarantine error: %w", err)
+	}
+
+	slog.Info("quarantine", "source", filename, "filename", reviewed, "error", cause)
+
+	return nil
+}
+
+// loadQuarantined reads the error file of the quarantined document.
+func loadQuarantined(filename string) (quarantined, error) {
+	var record quarantined
+
+	contents, err := os.ReadFile(filename + ".error.json")
+	if err != nil {
+		return record, fmt.Errorf("failed to read quarantine error: %w", err)
+	}
+
+	err = json.Unmarshal(contents, &record)
+	if err != nil {
+		return record, fmt.Errorf("failed to unmarshal quarantine error: %w", err)
+	}
+
+	return record, nil
+}
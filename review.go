@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const reviewHeader = `# Proposed renames, one per line as "source -> new name".
+# Edit a new name to change it, or delete a line to skip its document.
+# Lines starting with # are ignored, and an empty file renames nothing.
+`
+
+// review plans the renames of every document, opens them in the user's
+// editor, and applies the renames that survive editing.
+func (c *RenameCmd) review(ctx context.Context) error {
+	results := &batch{}
+	planner := &PlanCmd{Destination: c.Destination, RenameFlags: c.RenameFlags}
+	planned := []*plannedRename{}
+
+	for _, source := range c.Filenames {
+		if isRemote(source) || isRemote(c.Destination) || strings.EqualFold(filepath.Ext(source), ".zip") {
+			return fmt.Errorf("--review only renames local PDFs, not %q", source)
+		}
+
+		// documents are counted once they are renamed or skipped, as
+		// deleting their line in the editor leaves them out
+		plan, err := planner.plan(ctx, source)
+		if err != nil {
+			results.add(source, err)
+			continue
+		}
+
+		planned = append(planned, plan)
+	}
+
+	if len(planned) == 0 {
+		results.summarize(os.Stderr)
+		return results.err()
+	}
+
+	edited, err := editRenames(planned)
+	if err != nil {
+		return err
+	}
+
+	applier := &ApplyCmd{RenameFlags: c.RenameFlags}
+
+	for _, plan := range planned {
+		filename, ok := edited[plan.Source]
+		if !ok {
+			slog.Info("review.skip", "source", plan.Source)
+			continue
+		}
+
+		plan.Filename = filename
+
+		results.add(plan.Source, applier.apply(ctx, plan))
+	}
+
+	results.summarize(os.Stderr)
+
+	return results.err()
+}
+
+// editRenames writes the planned renames to a file, opens it in the editor,
+// and returns the new name of each document left in it, by source.
+func editRenames(planned []*plannedRename) (map[string]string, error) {
+	file, err := os.CreateTemp("", "pdfrenamer-review-*.txt")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create review file: %w", err)
+	}
+	defer func() { _ = os.Remove(file.Name()) }()
+
+	writer := bufio.NewWriter(file)
+	_, _ = writer.WriteString(reviewHeader)
+
+	for _, plan := range planned {
+		fmt.Fprintf(writer, "%s -> %s\n", plan.Source, displayPath(plan.Filename))
+	}
+
+	err = writer.Flush()
+	_ = file.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to write review file: %w", err)
+	}
+
+	editor := strings.Fields(cmp.Or(os.Getenv("VISUAL"), os.Getenv("EDITOR"), "vi"))
+
+	cmd := exec.Command(editor[0], append(editor[1:], file.Name())...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+
+	err = cmd.Run()
+	if err != nil {
+		return nil, fmt.Errorf("failed to run editor: %w", err)
+	}
+
+	contents, err := os.ReadFile(file.Name())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read review file: %w", err)
+	}
+
+	return parseRenames(string(contents), planned)
+}
+
+// parseRenames reads the lines of an edited review file. Lines are matched
+// to documents by their source, so new names may contain " -> ".
+func parseRenames(contents string, planned []*plannedRename) (map[string]string, error) {
+	edited := map[string]string{}
+
+	for number, line := range strings.Split(contents, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		found := false
+
+		for _, plan := range planned {
+			filename, ok := strings.CutPrefix(line, plan.Source+" -> ")
+			if !ok {
+				continue
+			}
+
+			filename = strings.TrimSpace(filename)
+			if filename == "" {
+				return nil, fmt.Errorf("line %d of the review has no new name", number+1)
+			}
+
+			edited[plan.Source] = filename
+			found = true
+
+			break
+		}
+
+		if !found {
+			return nil, fmt.Errorf("line %d of the review does not start with a document: %s", number+1, line)
+		}
+	}
+
+	return edited, nil
+}
+
+// displayPath shortens a filename in the working directory to a relative
+// path, for reading and editing.
+func displayPath(filename string) string {
+	wd, err := os.Getwd()
+	if err != nil {
+		return filename
+	}
+
+	relative, err := filepath.Rel(wd, filename)
+	if err != nil || strings.HasPrefix(relative, "..") {
+		return filename
+	}
+
+	return relative
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// fieldRule is a sanity check of an extracted value, so that a document is
+// reviewed instead of filed with obviously wrong data, such as a total of 0
+// or a date decades ago.
+type fieldRule struct {
+	// Min and Max bound an amount, inclusively.
+	Min *float64 `yaml:"min"`
+	Max *float64 `yaml:"max"`
+	// Years is how many years back a date may be. It may not be in the
+	// future either.
+	Years int `yaml:"years"`
+	// Currencies are the ISO 4217 codes allowed for the currency of an
+	// amount, or of a currency field.
+	Currencies []string `yaml:"currencies"`
+}
+
+// loadRules reads a YAML file mapping fields to their rules. Unknown rules
+// are an error, as a misspelled one would never be checked.
+func loadRules(path string) (map[string]*fieldRule, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rules: %w", err)
+	}
+
+	rules := map[string]*fieldRule{}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(contents))
+	decoder.KnownFields(true)
+
+	err = decoder.Decode(&rules)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to unmarshal rules: %w", err)
+	}
+
+	return rules, nil
+}
+
+// check returns how the value of the field breaks the rule, if it does.
+func (r *fieldRule) check(field, value string, dates *dateParser, now time.Time) []string {
+	violations := []string{}
+
+	if r.Min != nil || r.Max != nil {
+		amount, err := parseAmount(value)
+
+		switch {
+		case err != nil:
+			violations = append(violations, fmt.Sprintf("%s %q is not an amount", field, value))
+		case r.Min != nil && amount < *r.Min:
+			violations = append(violations, fmt.Sprintf("%s %q is below %v", field, value, *r.Min))
+		case r.Max != nil && *r.Max < amount:
+			violations = append(violations, fmt.Sprintf("%s %q is above %v", field, value, *r.Max))
+		}
+	}
+
+	if 0 < r.Years {
+		date, err := dates.parse(value)
+
+		switch {
+		case err != nil:
+			violations = append(violations, fmt.Sprintf("%s %q is not a date", field, value))
+		case now.Before(date):
+			violations = append(violations, fmt.Sprintf("%s %q is in the future", field, value))
+		case date.Before(now.AddDate(-r.Years, 0, 0)):
+			violations = append(violations, fmt.Sprintf("%s %q is more than %d years ago", field, value, r.Years))
+		}
+	}
+
+	if 0 < len(r.Currencies) {
+		currency := currencyOf(value)
+
+		if !slices.ContainsFunc(r.Currencies, func(allowed string) bool {
+			return strings.EqualFold(allowed, currency)
+		}) {
+			violations = append(violations, fmt.Sprintf("%s %q is not in %s", field, value, strings.Join(r.Currencies, ", ")))
+		}
+	}
+
+	return violations
+}
+
+// ruleViolations returns how the extracted values break the rules of
+// --rules. Fields that were not extracted are not checked.
+func (c *RenameFlags) ruleViolations(values map[string]string) ([]string, error) {
+	rules, err := loadRules(c.Rules)
+	if err != nil || len(rules) == 0 {
+		return nil, err
+	}
+
+	dates, err := c.dates()
+	if err != nil {
+		return nil, err
+	}
+
+	// dates are compared by day, so a document dated today is not in the
+	// future
+	now := time.Now().In(dates.location)
+	now = time.Date(now.Year(), now.Month(), now.Day(), 23, 59, 59, 0, dates.location)
+
+	violations := []string{}
+
+	for _, field := range slices.Sorted(maps.Keys(rules)) {
+		value := strings.TrimSpace(values[field])
+		if value == "" || rules[field] == nil {
+			continue
+		}
+
+		for _, violation := range rules[field].check(field, value, dates, now) {
+			slog.Warn("rule.violation", "field", field, "value", value, "violation", violation)
+			violations = append(violations, violation)
+		}
+	}
+
+	return violations, nil
+}
+
+// ruleError is returned for a document with values that break the rules of
+// --rules. It holds the rename that was proposed, for reviewing it.
+type ruleError struct {
+	violations []string
+
+	filename string
+	values   map[string]string
+}
+
+func (e ruleError) Error() string {
+	return fmt.Sprintf("%s, leaving %q for review", strings.Join(e.violations, "; "), e.filename)
+}
+
+func (e ruleError) proposed() (string, map[string]string) {
+	return e.filename, e.values
+}
+
+// checkRules leaves a planned rename that breaks the rules for review.
+func (c *RenameFlags) checkRules(plan *plannedRename) error {
+	if len(plan.violations) == 0 {
+		return nil
+	}
+
+	return ruleError{
+		violations: plan.violations,
+		filename:   plan.Filename,
+		values:     plan.Values,
+	}
+}
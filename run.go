@@ -0,0 +1,414 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alecthomas/kong"
+)
+
+// runManifest records an invocation: its arguments, its configuration, and
+// the result of each document, so it can be audited, retried, and undone by
+// its ID. The results are appended to a JSON lines file next to the manifest
+// as documents finish, rather than kept in memory, so that the server and
+// the watchers do not grow with every document, and a run that crashes still
+// has the results of the documents it finished.
+type runManifest struct {
+	ID       string         `json:"id"`
+	Command  string         `json:"command"`
+	Args     []string       `json:"args"`
+	Config   map[string]any `json:"config"`
+	Started  time.Time      `json:"started"`
+	Finished time.Time      `json:"finished"`
+	Exit     int            `json:"exit"`
+
+	// Results are only set for a loaded run.
+	Results []runResult `json:"results,omitempty"`
+
+	mu sync.Mutex
+	// dir is the runs directory, when the run is recorded.
+	dir string
+	// recorded is the number of results appended.
+	recorded int
+}
+
+// runResult is a document renamed or failed during a run.
+type runResult struct {
+	Source   string    `json:"source"`
+	Filename string    `json:"filename,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	Kind     string    `json:"kind,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+// run is the manifest of this invocation.
+var run = newRunManifest()
+
+func newRunManifest() *runManifest {
+	suffix := make([]byte, 3)
+	_, _ = rand.Read(suffix)
+
+	now := time.Now()
+
+	return &runManifest{
+		ID:      now.UTC().Format("20060102T150405Z") + "-" + hex.EncodeToString(suffix),
+		Started: now,
+	}
+}
+
+// renamed records a document moved to its new name.
+func (r *runManifest) renamed(source, filename string) {
+	r.add(runResult{Source: absolutePath(source), Filename: absolutePath(filename)})
+}
+
+// failed records a document that failed to be renamed.
+func (r *runManifest) failed(source string, err error) {
+	r.add(runResult{Source: redactURI(source), Error: err.Error(), Kind: failureKind(err)})
+}
+
+func (r *runManifest) add(result runResult) {
+	result.Time = time.Now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.dir == "" {
+		return
+	}
+
+	// the document is already renamed or failed, so a result that cannot
+	// be recorded does not fail it
+	err := r.append(result)
+	if err != nil {
+		slog.Error("run.manifest", "error", err)
+	}
+}
+
+// append writes the result to the results file of the run, writing the
+// manifest before the first result.
+func (r *runManifest) append(result runResult) error {
+	if r.recorded == 0 {
+		err := os.MkdirAll(r.dir, 0o755)
+		if err != nil {
+			return fmt.Errorf("failed to create runs directory: %w", err)
+		}
+
+		err = r.write()
+		if err != nil {
+			return err
+		}
+	}
+
+	payload, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("failed to marshal run result: %w", err)
+	}
+
+	file, err := os.OpenFile(filepath.Join(r.dir, r.ID+".jsonl"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open run results: %w", err)
+	}
+
+	_, err = file.Write(append(payload, '\n'))
+	if err != nil {
+		_ = file.Close()
+		return fmt.Errorf("failed to write run result: %w", err)
+	}
+
+	err = file.Close()
+	if err != nil {
+		return fmt.Errorf("failed to write run result: %w", err)
+	}
+
+	r.recorded++
+
+	return nil
+}
+
+// runRecorder is implemented by the commands embedding RenameFlags, whose
+// runs are recorded.
+type runRecorder interface {
+	renameFlags() *RenameFlags
+}
+
+func (c *RenameFlags) renameFlags() *RenameFlags {
+	return c
+}
+
+func (c *RenameFlags) runsDir() (string, error) {
+	if c.RunsDir != "" {
+		return c.RunsDir, nil
+	}
+
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find config directory: %w", err)
+	}
+
+	return filepath.Join(dir, "pdfrenamer", "runs"), nil
+}
+
+// start records the run of a command that renames documents, once any
+// document is renamed or fails. Dry runs are not recorded.
+func (r *runManifest) start(ctx *kong.Context) error {
+	recorder, ok := ctx.Selected().Target.Addr().Interface().(runRecorder)
+	if !ok {
+		return nil
+	}
+
+	flags := recorder.renameFlags()
+	if flags.DryRun {
+		return nil
+	}
+
+	dir, err := flags.runsDir()
+	if err != nil {
+		return err
+	}
+
+	config, err := runConfig(recorder)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.Command = ctx.Command()
+	r.Args = redactArgs(ctx.Args)
+	r.Config = config
+	r.dir = dir
+
+	return nil
+}
+
+// save writes the manifest again with how the run finished, when any
+// document was renamed or failed.
+func (r *runManifest) save(err error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.recorded == 0 {
+		return nil
+	}
+
+	r.Finished = time.Now()
+	r.Exit = 0
+
+	if err != nil {
+		r.Exit = exitCode(err)
+	}
+
+	err = r.write()
+	if err != nil {
+		return err
+	}
+
+	slog.Info("run.manifest", "filename", filepath.Join(r.dir, r.ID+".json"))
+
+	return nil
+}
+
+// write writes the manifest, without its results.
+func (r *runManifest) write() error {
+	payload, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal run manifest: %w", err)
+	}
+
+	err = writeFile(filepath.Join(r.dir, r.ID+".json"), 0o644, false, func(w io.Writer) error {
+		_, err := w.Write(payload)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write run manifest: %w", err)
+	}
+
+	return nil
+}
+
+// runConfig snapshots the flags of the command, without the API key.
+func runConfig(command any) (map[string]any, error) {
+	payload, err := json.Marshal(command)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal run config: %w", err)
+	}
+
+	config := map[string]any{}
+
+	err = json.Unmarshal(payload, &config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal run config: %w", err)
+	}
+
+	if key, ok := config["ApiKey"].(string); ok && key != "" {
+		config["ApiKey"] = "redacted"
+	}
+
+	// headers may carry a gateway's key
+	if headers, ok := config["Header"].(map[string]any); ok {
+		for name := range headers {
+			headers[name] = "redacted"
+		}
+	}
+
+	for key, value := range config {
+		config[key] = redactValue(value)
+	}
+
+	return config, nil
+}
+
+// redactValue removes the passwords of the URIs in a configuration value.
+func redactValue(value any) any {
+	switch value := value.(type) {
+	case string:
+		return redactURI(value)
+	case []any:
+		for i := range value {
+			value[i] = redactValue(value[i])
+		}
+	case map[string]any:
+		for key := range value {
+			value[key] = redactValue(value[key])
+		}
+	}
+
+	return value
+}
+
+// loadRun reads the manifest of a past run.
+func (c *RenameFlags) loadRun(id string) (*runManifest, error) {
+	dir, err := c.runsDir()
+	if err != nil {
+		return nil, err
+	}
+
+	contents, err := os.ReadFile(filepath.Join(dir, filepath.Base(id)+".json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("run %q not found in %s", id, dir)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read run manifest: %w", err)
+	}
+
+	manifest := &runManifest{}
+
+	err = json.Unmarshal(contents, manifest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal run manifest: %w", err)
+	}
+
+	// manifests written before results were appended hold them
+	if manifest.Results != nil {
+		return manifest, nil
+	}
+
+	file, err := os.Open(filepath.Join(dir, filepath.Base(id)+".jsonl"))
+	if errors.Is(err, os.ErrNotExist) {
+		return manifest, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read run results: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1024*1024)
+
+	for line := 1; scanner.Scan(); line++ {
+		var result runResult
+
+		err := json.Unmarshal(scanner.Bytes(), &result)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal run result line %d: %w", line, err)
+		}
+
+		manifest.Results = append(manifest.Results, result)
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read run results: %w", err)
+	}
+
+	return manifest, nil
+}
+
+// redactArgs removes the API key, the values of headers, and the passwords of
+// URIs from the command line.
+func redactArgs(args []string) []string {
+	redacted := []string{}
+	secret, header := false, false
+
+	for _, arg := range args {
+		switch {
+		case secret:
+			arg = "redacted"
+		case header:
+			arg = redactHeader(arg)
+		case strings.HasPrefix(arg, "--api-key="):
+			arg = "--api-key=redacted"
+		case strings.HasPrefix(arg, "--header="):
+			arg = "--header=" + redactHeader(strings.TrimPrefix(arg, "--header="))
+		default:
+			arg = redactURI(arg)
+		}
+
+		secret, header = arg == "--api-key", arg == "--header"
+		redacted = append(redacted, arg)
+	}
+
+	return redacted
+}
+
+// redactHeader removes the values of headers given as name=value, separated
+// by semicolons.
+func redactHeader(arg string) string {
+	headers := strings.Split(arg, ";")
+	for i, header := range headers {
+		name, _, _ := strings.Cut(header, "=")
+		headers[i] = name + "=redacted"
+	}
+
+	return strings.Join(headers, ";")
+}
+
+// redactURI removes the password from a URI, such as of an SFTP share.
+func redactURI(name string) string {
+	if !isRemote(name) {
+		return name
+	}
+
+	parsed, err := url.Parse(name)
+	if err != nil {
+		return name
+	}
+
+	return parsed.Redacted()
+}
+
+func absolutePath(name string) string {
+	if isRemote(name) {
+		return redactURI(name)
+	}
+
+	absolute, err := filepath.Abs(name)
+	if err != nil {
+		return name
+	}
+
+	return absolute
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// renamedMetadata marks objects written by pdfrenamer, so the notifications
+// for them are not processed again.
+const renamedMetadata = "x-amz-meta-pdfrenamer"
+
+// s3Bucket is a minimal S3 client for the objects pdfrenamer reads and
+// renames.
+type s3Bucket struct {
+	aws      *awsClient
+	name     string
+	endpoint string
+}
+
+func newS3Bucket(aws *awsClient, name, endpoint string) *s3Bucket {
+	return &s3Bucket{aws: aws, name: name, endpoint: strings.TrimSuffix(endpoint, "/")}
+}
+
+// url uses virtual-hosted addressing on AWS, and path-style addressing for a
+// custom endpoint such as MinIO.
+func (b *s3Bucket) url(key string) string {
+	if b.endpoint != "" {
+		return b.endpoint + "/" + awsEscape(b.name) + "/" + awsEscapePath(key)
+	}
+
+	return fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", b.name, b.aws.region, awsEscapePath(key))
+}
+
+func (b *s3Bucket) request(ctx context.Context, method, key string) (*http.Request, error) {
+	request, err := http.NewRequestWithContext(ctx, method, b.url(key), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create S3 request: %w", err)
+	}
+
+	return request, nil
+}
+
+// renamed reports whether the object was written by pdfrenamer.
+func (b *s3Bucket) renamed(ctx context.Context, key string) (bool, error) {
+	request, err := b.request(ctx, http.MethodHead, key)
+	if err != nil {
+		return false, err
+	}
+
+	response, err := b.aws.do(request, "s3", nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to head s3://%s/%s: %w", b.name, key, err)
+	}
+	defer response.Body.Close()
+
+	return response.Header.Get(renamedMetadata) != "", nil
+}
+
+func (b *s3Bucket) get(ctx context.Context, key string, w io.Writer) error {
+	request, err := b.request(ctx, http.MethodGet, key)
+	if err != nil {
+		return err
+	}
+
+	response, err := b.aws.do(request, "s3", nil)
+	if err != nil {
+		return fmt.Errorf("failed to get s3://%s/%s: %w", b.name, key, err)
+	}
+	defer response.Body.Close()
+
+	_, err = io.Copy(w, response.Body)
+	if err != nil {
+		return fmt.Errorf("failed to download s3://%s/%s: %w", b.name, key, err)
+	}
+
+	return nil
+}
+
+// put uploads the object, marked as renamed, unless it already exists.
+func (b *s3Bucket) put(ctx context.Context, key string, r io.Reader) error {
+	payload, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("failed to read upload: %w", err)
+	}
+
+	request, err := b.request(ctx, http.MethodPut, key)
+	if err != nil {
+		return err
+	}
+
+	request.Header.Set(renamedMetadata, "renamed")
+	request.Header.Set("Content-Type", "application/pdf")
+	request.Header.Set("If-None-Match", "*")
+
+	response, err := b.aws.do(request, "s3", payload)
+	if err != nil {
+		return fmt.Errorf("failed to put s3://%s/%s: %w", b.name, key, err)
+	}
+
+	return response.Body.Close()
+}
+
+func (b *s3Bucket) delete(ctx context.Context, key string) error {
+	request, err := b.request(ctx, http.MethodDelete, key)
+	if err != nil {
+		return err
+	}
+
+	response, err := b.aws.do(request, "s3", nil)
+	if err != nil {
+		return fmt.Errorf("failed to delete s3://%s/%s: %w", b.name, key, err)
+	}
+
+	return response.Body.Close()
+}
+
+// exists reports whether there is an object at the key.
+func (b *s3Bucket) exists(ctx context.Context, key string) (bool, error) {
+	request, err := b.request(ctx, http.MethodHead, key)
+	if err != nil {
+		return false, err
+	}
+
+	response, err := b.aws.do(request, "s3", nil)
+
+	var status awsStatusError
+	if errors.As(err, &status) && status.code == http.StatusNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to head s3://%s/%s: %w", b.name, key, err)
+	}
+
+	return true, response.Body.Close()
+}
+
+// move copies the object to its new key, marked as renamed, and then
+// deletes the original. An existing object at the new key is not replaced:
+// it is checked for first, and the copy is conditional as well, for stores
+// that support conditional copies.
+func (b *s3Bucket) move(ctx context.Context, from, to string) error {
+	exists, err := b.exists(ctx, to)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return fmt.Errorf("s3://%s/%s already exists", b.name, to)
+	}
+
+	request, err := b.request(ctx, http.MethodPut, to)
+	if err != nil {
+		return err
+	}
+
+	request.Header.Set("If-None-Match", "*")
+
+	request.Header.Set("X-Amz-Copy-Source", "/"+awsEscape(b.name)+"/"+awsEscapePath(from))
+	request.Header.Set("X-Amz-Metadata-Directive", "REPLACE")
+	request.Header.Set(renamedMetadata, "renamed")
+	request.Header.Set("Content-Type", "application/pdf")
+
+	response, err := b.aws.do(request, "s3", nil)
+	if err != nil {
+		return fmt.Errorf("failed to copy s3://%s/%s: %w", b.name, from, err)
+	}
+
+	// a copy can fail after the 200 status has been sent
+	body, err := io.ReadAll(response.Body)
+	_ = response.Body.Close()
+	if err != nil || strings.Contains(string(body), "<Error>") {
+		return fmt.Errorf("failed to copy s3://%s/%s: %s", b.name, from, body)
+	}
+
+	return b.delete(ctx, from)
+}
+
+// close does nothing, as requests do not hold a connection.
+func (b *s3Bucket) close() error {
+	return nil
+}
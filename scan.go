@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+type ScanCmd struct {
+	Scanner    string        `help:"URL of the eSCL (AirScan) scanner, such as http://192.168.1.20" required:""`
+	Source     string        `help:"where the paper is scanned from (platen, feeder, duplex)" enum:"platen,feeder,duplex" default:"feeder"`
+	Resolution int           `help:"resolution to scan at, in DPI" default:"300"`
+	Color      string        `help:"color mode to scan in (color, gray, mono)" enum:"color,gray,mono" default:"gray"`
+	Timeout    time.Duration `help:"how long to wait for the scanner to finish" default:"5m"`
+
+	Destination string `help:"directory to write the scans into and file them from (defaults to the working directory)" type:"path"`
+
+	RenameFlags `embed:""`
+}
+
+// esclNamespace is the namespace of the eSCL scan settings, and pwgNamespace
+// of the settings shared with other PWG standards.
+const (
+	esclNamespace = "http://schemas.hp.com/imaging/escl/2011/05/03"
+	pwgNamespace  = "http://www.pwg.org/schemas/2010/12/sm"
+)
+
+// esclScanSettings is the request body of an eSCL scan job.
+type esclScanSettings struct {
+	XMLName        xml.Name `xml:"scan:ScanSettings"`
+	ScanNamespace  string   `xml:"xmlns:scan,attr"`
+	PWGNamespace   string   `xml:"xmlns:pwg,attr"`
+	Version        string   `xml:"pwg:Version"`
+	Intent         string   `xml:"scan:Intent"`
+	InputSource    string   `xml:"pwg:InputSource"`
+	Duplex         bool     `xml:"scan:Duplex,omitempty"`
+	ColorMode      string   `xml:"scan:ColorMode"`
+	XResolution    int      `xml:"scan:XResolution"`
+	YResolution    int      `xml:"scan:YResolution"`
+	DocumentFormat string   `xml:"pwg:DocumentFormat"`
+	FormatExt      string   `xml:"scan:DocumentFormatExt"`
+}
+
+var esclColorModes = map[string]string{
+	"color": "RGB24",
+	"gray":  "Grayscale8",
+	"mono":  "BlackAndWhite1",
+}
+
+// Run scans the paper in the scanner as PDFs, writes them into the
+// destination, and renames each one. A scan that fails to be renamed is kept
+// under its scan name, or quarantined.
+func (c *ScanCmd) Run() error {
+	ctx, cancel := context.WithTimeout(context.Background(), c.Timeout)
+	defer cancel()
+
+	scanner, err := url.Parse(c.Scanner)
+	if err != nil {
+		return fmt.Errorf("failed to parse scanner URL: %w", err)
+	}
+
+	client := &http.Client{Timeout: c.Timeout}
+
+	job, err := c.startJob(ctx, client, scanner)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("scan.job", "job", job)
+
+	scans, err := c.download(ctx, client, job)
+	if err != nil {
+		return err
+	}
+
+	results := &batch{}
+
+	for _, scan := range scans {
+		flags := c.RenameFlags
+		flags.dir = c.Destination
+
+		filename, err := flags.rename(context.Background(), scan)
+		if err != nil {
+			err = errors.Join(err, c.quarantine(scan, c.Destination, err))
+		} else {
+			fmt.Printf("%s -> %s\n", scan, filename)
+		}
+
+		results.add(scan, err)
+	}
+
+	if len(scans) != 1 {
+		results.summarize(os.Stderr)
+	}
+
+	return results.err()
+}
+
+// startJob asks the scanner to scan, returning the URL of the job.
+func (c *ScanCmd) startJob(ctx context.Context, client *http.Client, scanner *url.URL) (*url.URL, error) {
+	settings := esclScanSettings{
+		ScanNamespace:  esclNamespace,
+		PWGNamespace:   pwgNamespace,
+		Version:        "2.6",
+		Intent:         "Document",
+		InputSource:    "Feeder",
+		Duplex:         c.Source == "duplex",
+		ColorMode:      esclColorModes[c.Color],
+		XResolution:    c.Resolution,
+		YResolution:    c.Resolution,
+		DocumentFormat: "application/pdf",
+		FormatExt:      "application/pdf",
+	}
+
+	if c.Source == "platen" {
+		settings.InputSource = "Platen"
+	}
+
+	body, err := xml.Marshal(settings)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal scan settings: %w", err)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, scanner.JoinPath("eSCL", "ScanJobs").String(), bytes.NewReader(append([]byte(xml.Header), body...)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create scan job request: %w", err)
+	}
+	request.Header.Set("Content-Type", "text/xml")
+
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start scan: %w", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusCreated {
+		message, _ := io.ReadAll(io.LimitReader(response.Body, 1024))
+		return nil, fmt.Errorf("failed to start scan: %s: %s", response.Status, strings.TrimSpace(string(message)))
+	}
+
+	location, err := response.Location()
+	if err != nil {
+		return nil, fmt.Errorf("failed to find scan job: %w", err)
+	}
+
+	return location, nil
+}
+
+// download fetches each document of the job until the scanner has no more,
+// writing them into the destination. Scanners answer 503 while they are
+// still scanning.
+func (c *ScanCmd) download(ctx context.Context, client *http.Client, job *url.URL) ([]string, error) {
+	dir := c.Destination
+	if dir == "" {
+		dir = "."
+	}
+
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create destination: %w", err)
+	}
+
+	stamp := time.Now().Format("20060102-150405")
+	scans := []string{}
+
+	for {
+		request, err := http.NewRequestWithContext(ctx, http.MethodGet, job.JoinPath("NextDocument").String(), nil)
+		if err != nil {
+			return scans, fmt.Errorf("failed to create scan request: %w", err)
+		}
+
+		response, err := client.Do(request)
+		if err != nil {
+			return scans, fmt.Errorf("failed to download scan: %w", err)
+		}
+
+		switch response.StatusCode {
+		case http.StatusOK:
+		case http.StatusNotFound, http.StatusGone:
+			// the job has no more documents
+			_ = response.Body.Close()
+
+			if len(scans) == 0 {
+				return nil, errors.New("scanner returned no documents, is there paper in it?")
+			}
+
+			return scans, nil
+		case http.StatusServiceUnavailable:
+			_ = response.Body.Close()
+
+			select {
+			case <-ctx.Done():
+				return scans, fmt.Errorf("failed to download scan: %w", ctx.Err())
+			case <-time.After(time.Second):
+			}
+
+			continue
+		default:
+			_ = response.Body.Close()
+			return scans, fmt.Errorf("failed to download scan: %s", response.Status)
+		}
+
+		filename := filepath.Join(dir, fmt.Sprintf("scan-%s-%d.pdf", stamp, len(scans)+1))
+
+		err = writeFile(filename, 0o644, true, func(file io.Writer) error {
+			_, err := io.Copy(file, response.Body)
+			return err
+		})
+		_ = response.Body.Close()
+		if err != nil {
+			return scans, fmt.Errorf("failed to write scan: %w", err)
+		}
+
+		slog.Info("scan.document", "filename", filename)
+
+		scans = append(scans, filename)
+	}
+}
@@ -0,0 +1,530 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+type ServeCmd struct {
+	Listen        string `help:"address to listen on" default:"localhost:8080"`
+	Dir           string `help:"directory uploaded documents are stored and renamed in" type:"existingdir" required:""`
+	Workers       int    `help:"number of documents processed at the same time" default:"1"`
+	MaxUploadSize int64  `help:"maximum size in bytes of an uploaded document" default:"104857600"`
+
+	PidFile         string        `help:"file to write the process ID to while serving" type:"path"`
+	ShutdownTimeout time.Duration `help:"how long to wait for uploads in progress when shutting down" default:"30s"`
+	JobTTL          time.Duration `help:"how long the status of a finished job is kept (0 keeps it until the server stops)" name:"job-ttl" default:"24h"`
+
+	RenameFlags `embed:""`
+}
+
+// job is an uploaded document being processed in the background.
+type job struct {
+	ID       string    `json:"id"`
+	Status   string    `json:"status"`
+	Filename string    `json:"filename"`
+	Name     string    `json:"name,omitempty"`
+	DryRun   bool      `json:"dry_run"`
+	Error    string    `json:"error,omitempty"`
+	Created  time.Time `json:"created"`
+	Updated  time.Time `json:"updated"`
+
+	callback string
+}
+
+const (
+	jobQueued     = "queued"
+	jobProcessing = "processing"
+	jobDone       = "done"
+	jobFailed     = "failed"
+)
+
+type server struct {
+	*ServeCmd
+
+	mu      sync.Mutex
+	jobs    map[string]*job
+	queue   chan string
+	closing bool
+
+	// callbacks are the notifications still being posted
+	callbacks sync.WaitGroup
+}
+
+// Run serves until it receives SIGINT or SIGTERM. It then stops accepting
+// uploads, and finishes the documents already uploaded before exiting, while
+// a second signal exits straight away. SIGHUP reloads the configuration.
+func (c *ServeCmd) Run() error {
+	// formats are relative to the upload directory, not the working directory
+	c.dir = c.Dir
+
+	if c.PidFile != "" {
+		remove, err := writePidFile(c.PidFile)
+		if err != nil {
+			return err
+		}
+		defer remove()
+	}
+
+	s := &server{
+		ServeCmd: c,
+		jobs:     map[string]*job{},
+		queue:    make(chan string, 1024),
+	}
+
+	metrics.queueDepth = func() int { return len(s.queue) }
+
+	workers := sync.WaitGroup{}
+
+	for range max(c.Workers, 1) {
+		workers.Add(1)
+
+		go func() {
+			defer workers.Done()
+			s.work()
+		}()
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /documents", s.upload)
+	mux.HandleFunc("GET /documents/{id}", s.status)
+	mux.HandleFunc("POST /analyze", s.analyze)
+	mux.Handle("GET /metrics", metrics)
+
+	listener, err := net.Listen("tcp", c.Listen)
+	if err != nil {
+		return fmt.Errorf("failed to listen: %w", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go s.reloads(ctx)
+	go s.expire(ctx)
+
+	server := &http.Server{Handler: mux}
+	served := make(chan error, 1)
+
+	go func() { served <- server.Serve(listener) }()
+
+	slog.Info("server.listen", "address", listener.Addr().String())
+
+	if !loopback(listener.Addr()) {
+		slog.Warn("server.unauthenticated", "address", listener.Addr().String())
+	}
+	notifySystemd("READY=1\nSTATUS=listening on " + listener.Addr().String())
+
+	select {
+	case err := <-served:
+		return fmt.Errorf("failed to serve: %w", err)
+	case <-ctx.Done():
+	}
+
+	// a second signal is no longer caught, and exits
+	stop()
+	notifySystemd("STOPPING=1")
+
+	shutdown, cancel := context.WithTimeout(context.Background(), c.ShutdownTimeout)
+	defer cancel()
+
+	err = server.Shutdown(shutdown)
+	if err != nil {
+		slog.Warn("server.shutdown", "error", err)
+	}
+
+	s.mu.Lock()
+	s.closing = true
+	close(s.queue)
+	s.mu.Unlock()
+
+	slog.Info("server.drain", "queued", len(s.queue))
+
+	workers.Wait()
+	s.callbacks.Wait()
+
+	slog.Info("server.stop")
+
+	return nil
+}
+
+// loopback reports whether the address only accepts connections from this
+// machine, as the server does not authenticate requests.
+func loopback(addr net.Addr) bool {
+	tcp, ok := addr.(*net.TCPAddr)
+
+	return ok && tcp.IP.IsLoopback()
+}
+
+// reloads reloads the configuration on each SIGHUP until the context is done.
+func (s *server) reloads(ctx context.Context) {
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+	defer signal.Stop(hangups)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangups:
+			s.reload()
+		}
+	}
+}
+
+// expire forgets finished jobs once they are older than the TTL, so a server
+// running for months does not hold every job it ever ran.
+func (s *server) expire(ctx context.Context) {
+	if s.JobTTL <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(min(s.JobTTL, time.Minute))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			expired := 0
+
+			s.mu.Lock()
+			for id, finished := range s.jobs {
+				if (finished.Status == jobDone || finished.Status == jobFailed) && s.JobTTL < now.Sub(finished.Updated) {
+					delete(s.jobs, id)
+					expired++
+				}
+			}
+			s.mu.Unlock()
+
+			if 0 < expired {
+				slog.Info("server.expire", "jobs", expired)
+			}
+		}
+	}
+}
+
+// reload checks the files of the configuration after they were edited: the
+// format with its aliases, pipelines, and lookup tables, and the rules,
+// patterns, and addressees. It only checks them, and keeps nothing it loads:
+// each document reads the files when it is processed, so the documents
+// processed from now on use the edits anyway, and a file that no longer loads
+// is reported straight away rather than failing the next document. The flags
+// are those the server was started with.
+func (s *server) reload() {
+	notifySystemd("RELOADING=1")
+	defer notifySystemd("READY=1")
+
+	s.mu.Lock()
+	flags := s.RenameFlags
+	s.mu.Unlock()
+
+	_, err := flags.parseTemplate()
+	if err == nil {
+		_, err = loadRules(flags.Rules)
+	}
+	if err == nil {
+		_, err = loadPatterns(flags.Patterns)
+	}
+	if err == nil && flags.Addressees != "" {
+		_, err = loadAddresseeFolders(flags.Addressees)
+	}
+
+	if err != nil {
+		slog.Error("server.reload", "error", err)
+		return
+	}
+
+	slog.Info("server.reload")
+}
+
+// upload stores a multipart PDF upload, from the "file" field, and queues it
+// for processing. An optional "callback" URL receives the finished job. With
+// "dry_run" set, the name is only proposed and the upload is discarded.
+func (s *server) upload(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, s.MaxUploadSize)
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("failed to read upload: %w", err))
+		return
+	}
+	defer file.Close()
+
+	id, err := newJobID()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	filename, err := s.store(id, header.Filename, file)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	now := time.Now()
+	queued := &job{
+		ID:       id,
+		Status:   jobQueued,
+		Filename: filename,
+		Created:  now,
+		Updated:  now,
+		DryRun:   r.FormValue("dry_run") == "true",
+		callback: r.FormValue("callback"),
+	}
+
+	s.mu.Lock()
+	if s.closing {
+		s.mu.Unlock()
+		_ = os.Remove(filename)
+		writeError(w, http.StatusServiceUnavailable, errors.New("server is shutting down"))
+
+		return
+	}
+
+	s.jobs[id] = queued
+	response := *queued
+
+	full := false
+	select {
+	case s.queue <- id:
+	default:
+		full = true
+	}
+	s.mu.Unlock()
+
+	if full {
+		_ = os.Remove(filename)
+		s.finish(id, "", errors.New("queue is full"))
+		writeError(w, http.StatusServiceUnavailable, errors.New("queue is full"))
+
+		return
+	}
+
+	slog.Info("server.upload", "id", id, "filename", filename)
+
+	writeJSON(w, http.StatusAccepted, response)
+}
+
+// analyze responds with the markdown and extracted values of a multipart PDF
+// upload, from the "file" field, without renaming or storing anything.
+func (s *server) analyze(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, s.MaxUploadSize)
+
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("failed to read upload: %w", err))
+		return
+	}
+	defer file.Close()
+
+	temp, err := os.CreateTemp("", "pdfrenamer-*.pdf")
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("failed to create temporary file: %w", err))
+		return
+	}
+	defer func() { _ = os.Remove(temp.Name()) }()
+
+	_, err = io.Copy(temp, file)
+	_ = temp.Close()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("failed to write temporary file: %w", err))
+		return
+	}
+
+	s.mu.Lock()
+	flags := s.RenameFlags
+	s.mu.Unlock()
+
+	result, err := flags.analyze(r.Context(), temp.Name())
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	response := struct {
+		Markdown string            `json:"markdown"`
+		Values   map[string]string `json:"values"`
+		Name     string            `json:"name,omitempty"`
+		Error    string            `json:"error,omitempty"`
+	}{
+		Markdown: result.Markdown,
+		Values:   result.Values,
+	}
+
+	err = result.template.clean(result.Values)
+	if err == nil {
+		response.Name, err = result.template.render(result.Values)
+	}
+
+	// nothing is renamed, so the name does not take an index
+	result.template.indices.release()
+
+	if err != nil {
+		response.Error = err.Error()
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (s *server) status(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	found, ok := s.jobs[r.PathValue("id")]
+	var response job
+	if ok {
+		response = *found
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		writeError(w, http.StatusNotFound, errors.New("job not found"))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// store writes the upload into the directory, keeping only the base of the
+// client's filename and prefixing the job ID to avoid collisions.
+func (s *server) store(id, name string, contents io.Reader) (string, error) {
+	base := filepath.Base(filepath.Clean("/" + strings.ReplaceAll(name, `\`, "/")))
+	if base == "/" || base == "." {
+		base = "upload.pdf"
+	}
+
+	filename := filepath.Join(s.Dir, id+"-"+base)
+
+	file, err := os.OpenFile(filename, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		return "", fmt.Errorf("failed to create upload: %w", err)
+	}
+	defer file.Close()
+
+	_, err = io.Copy(file, contents)
+	if err != nil {
+		_ = os.Remove(filename)
+		return "", fmt.Errorf("failed to write upload: %w", err)
+	}
+
+	return filename, nil
+}
+
+func (s *server) work() {
+	for id := range s.queue {
+		s.mu.Lock()
+		current := s.jobs[id]
+		current.Status = jobProcessing
+		current.Updated = time.Now()
+		source := current.Filename
+		flags := s.RenameFlags
+		flags.DryRun = flags.DryRun || current.DryRun
+		flags.originalName = strings.TrimPrefix(filepath.Base(source), id+"-")
+		s.mu.Unlock()
+
+		slog.Info("server.process", "id", id, "filename", source)
+
+		filename, err := flags.rename(context.Background(), source)
+		metrics.document(err)
+
+		if current.DryRun {
+			_ = os.Remove(source)
+		} else if err != nil {
+			run.failed(source, err)
+
+			qerr := flags.quarantine(source, s.Dir, err)
+			if qerr != nil {
+				slog.Error("server.quarantine", "id", id, "error", qerr)
+			}
+		}
+
+		s.finish(id, filename, err)
+	}
+}
+
+func (s *server) finish(id, filename string, err error) {
+	s.mu.Lock()
+	current := s.jobs[id]
+	current.Updated = time.Now()
+
+	if err != nil {
+		current.Status = jobFailed
+		current.Error = err.Error()
+	} else {
+		current.Status = jobDone
+		current.Filename = filename
+		current.Name, _ = filepath.Rel(s.Dir, filename)
+	}
+
+	finished := *current
+	s.mu.Unlock()
+
+	slog.Info("server.finish", "id", id, "status", finished.Status, "filename", finished.Filename, "error", finished.Error)
+
+	if finished.callback != "" {
+		s.callbacks.Add(1)
+
+		go func() {
+			defer s.callbacks.Done()
+			notify(finished)
+		}()
+	}
+}
+
+// notify posts the finished job to its callback URL.
+func notify(finished job) {
+	payload, err := json.Marshal(finished)
+	if err != nil {
+		slog.Error("server.callback", "id", finished.ID, "error", err)
+		return
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+
+	response, err := client.Post(finished.callback, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		slog.Error("server.callback", "id", finished.ID, "error", err)
+		return
+	}
+	defer response.Body.Close()
+
+	slog.Info("server.callback", "id", finished.ID, "status", response.StatusCode)
+}
+
+func newJobID() (string, error) {
+	id := make([]byte, 16)
+
+	_, err := rand.Read(id)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate job ID: %w", err)
+	}
+
+	return hex.EncodeToString(id), nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	_ = json.NewEncoder(w).Encode(value)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// sftpServer reads and files documents over SFTP. Keys are absolute paths,
+// or relative to the home directory when they start with `~/`.
+type sftpServer struct {
+	conn   *ssh.Client
+	client *sftp.Client
+	host   string
+}
+
+// newSFTPServer connects with the password in the URI, the SSH agent, or the
+// default private keys in ~/.ssh, verifying the host key against
+// ~/.ssh/known_hosts.
+func newSFTPServer(uri *url.URL) (*sftpServer, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to find home directory: %w", err)
+	}
+
+	hostKeys, err := knownhosts.New(filepath.Join(home, ".ssh", "known_hosts"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load known hosts: %w", err)
+	}
+
+	username := os.Getenv("USER")
+	auth := []ssh.AuthMethod{}
+
+	if uri.User != nil {
+		username = uri.User.Username()
+		if password, ok := uri.User.Password(); ok {
+			auth = append(auth, ssh.Password(password))
+		}
+	}
+
+	if socket := os.Getenv("SSH_AUTH_SOCK"); socket != "" {
+		agentConn, err := net.Dial("unix", socket)
+		if err == nil {
+			// the agent is only needed to sign in
+			defer agentConn.Close()
+
+			auth = append(auth, ssh.PublicKeysCallback(agent.NewClient(agentConn).Signers))
+		}
+	}
+
+	signers := []ssh.Signer{}
+	for _, name := range []string{"id_ed25519", "id_ecdsa", "id_rsa"} {
+		key, err := os.ReadFile(filepath.Join(home, ".ssh", name))
+		if err != nil {
+			continue
+		}
+
+		signer, err := ssh.ParsePrivateKey(key)
+		if err != nil {
+			// passphrase protected keys are used through the agent
+			continue
+		}
+
+		signers = append(signers, signer)
+	}
+
+	if 0 < len(signers) {
+		auth = append(auth, ssh.PublicKeys(signers...))
+	}
+
+	address := uri.Host
+	if uri.Port() == "" {
+		address = net.JoinHostPort(uri.Hostname(), "22")
+	}
+
+	conn, err := ssh.Dial("tcp", address, &ssh.ClientConfig{
+		User:            username,
+		Auth:            auth,
+		HostKeyCallback: hostKeys,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", address, err)
+	}
+
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("failed to start SFTP on %s: %w", address, err)
+	}
+
+	return &sftpServer{conn: conn, client: client, host: uri.Host}, nil
+}
+
+func (s *sftpServer) path(key string) string {
+	if relative, ok := strings.CutPrefix(key, "~/"); ok {
+		return relative
+	}
+
+	return "/" + key
+}
+
+func (s *sftpServer) get(_ context.Context, key string, w io.Writer) error {
+	file, err := s.client.Open(s.path(key))
+	if err != nil {
+		return fmt.Errorf("failed to open sftp://%s/%s: %w", s.host, key, err)
+	}
+	defer file.Close()
+
+	_, err = io.Copy(w, file)
+	if err != nil {
+		return fmt.Errorf("failed to download sftp://%s/%s: %w", s.host, key, err)
+	}
+
+	return nil
+}
+
+// put uploads the file, refusing to overwrite an existing file.
+func (s *sftpServer) put(_ context.Context, key string, r io.Reader) error {
+	filename := s.path(key)
+
+	err := s.client.MkdirAll(path.Dir(filename))
+	if err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	file, err := s.client.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_EXCL)
+	if err != nil {
+		return fmt.Errorf("failed to create sftp://%s/%s: %w", s.host, key, err)
+	}
+
+	_, err = io.Copy(file, r)
+	if err != nil {
+		_ = file.Close()
+		_ = s.client.Remove(filename)
+
+		return fmt.Errorf("failed to upload sftp://%s/%s: %w", s.host, key, err)
+	}
+
+	return file.Close()
+}
+
+func (s *sftpServer) delete(_ context.Context, key string) error {
+	err := s.client.Remove(s.path(key))
+	if err != nil {
+		return fmt.Errorf("failed to delete sftp://%s/%s: %w", s.host, key, err)
+	}
+
+	return nil
+}
+
+// move renames the file on the server, refusing to overwrite an existing
+// file.
+func (s *sftpServer) move(_ context.Context, from, to string) error {
+	filename := s.path(to)
+
+	err := s.client.MkdirAll(path.Dir(filename))
+	if err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	_, err = s.client.Stat(filename)
+	if err == nil {
+		return fmt.Errorf("sftp://%s/%s already exists", s.host, to)
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to check sftp://%s/%s: %w", s.host, to, err)
+	}
+
+	err = s.client.Rename(s.path(from), filename)
+	if err != nil {
+		return fmt.Errorf("failed to move sftp://%s/%s: %w", s.host, from, err)
+	}
+
+	return nil
+}
+
+// close ends the SFTP session and its SSH connection.
+func (s *sftpServer) close() error {
+	return errors.Join(s.client.Close(), s.conn.Close())
+}
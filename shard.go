@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/alecthomas/kong"
+)
+
+type ShardFlags struct {
+	Shard shard `help:"only rename the documents in shard i of n, counting from 0, so several pods split a large run by the hash of each name" placeholder:"i/n"`
+}
+
+// shard is a part of the documents given to every instance, chosen by the
+// hash of their names. The zero value is every document.
+type shard struct {
+	index, count int
+}
+
+func (s *shard) Decode(ctx *kong.DecodeContext) error {
+	var value string
+
+	err := ctx.Scan.PopValueInto("shard", &value)
+	if err != nil {
+		return err
+	}
+
+	index, count, ok := strings.Cut(value, "/")
+	if ok {
+		s.index, err = strconv.Atoi(index)
+		if err == nil {
+			s.count, err = strconv.Atoi(count)
+		}
+	}
+
+	if !ok || err != nil || s.count < 1 || s.index < 0 || s.count <= s.index {
+		return fmt.Errorf("expected a shard as i/n with 0 <= i < n, not %q", value)
+	}
+
+	return nil
+}
+
+func (s shard) MarshalText() ([]byte, error) {
+	if s.count == 0 {
+		return nil, nil
+	}
+
+	return []byte(fmt.Sprintf("%d/%d", s.index, s.count)), nil
+}
+
+// includes reports whether the document is in the shard. Names are hashed as
+// given, so every instance has to be given the same names, such as the same
+// URIs, or paths on volumes mounted in the same place.
+func (s shard) includes(name string) bool {
+	if s.count == 0 {
+		return true
+	}
+
+	if !isRemote(name) {
+		name = filepath.ToSlash(filepath.Clean(name))
+	}
+
+	hash := fnv.New64a()
+	_, _ = hash.Write([]byte(name))
+
+	return hash.Sum64()%uint64(s.count) == uint64(s.index)
+}
+
+// filter returns the names in the shard.
+func (s shard) filter(names []string) []string {
+	filtered := []string{}
+
+	for _, name := range names {
+		if s.includes(name) {
+			filtered = append(filtered, name)
+		}
+	}
+
+	return filtered
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/alecthomas/kong"
+)
+
+// shellExtensionLabel is the entry added to the context menu of PDFs.
+const shellExtensionLabel = "Rename with AI"
+
+// registerShellExtensionFlag adds the context menu entry and exits, like
+// --version, so no document is needed.
+type registerShellExtensionFlag bool
+
+// BeforeReset registers the entry to run pdfrenamer on the clicked PDF with
+// the other flags given, so the provider and destination are set up once.
+func (f registerShellExtensionFlag) BeforeReset(app *kong.Kong) error {
+	err := registerShellExtension(shellExtensionArgs(os.Args[1:]))
+	if err != nil {
+		return fmt.Errorf("failed to register shell extension: %w", err)
+	}
+
+	fmt.Fprintf(app.Stdout, "added %q to the context menu of PDFs\n", shellExtensionLabel)
+	app.Exit(0)
+
+	return nil
+}
+
+// unregisterShellExtensionFlag removes the context menu entry and exits.
+type unregisterShellExtensionFlag bool
+
+func (f unregisterShellExtensionFlag) BeforeReset(app *kong.Kong) error {
+	err := unregisterShellExtension()
+	if err != nil {
+		return fmt.Errorf("failed to unregister shell extension: %w", err)
+	}
+
+	fmt.Fprintf(app.Stdout, "removed %q from the context menu of PDFs\n", shellExtensionLabel)
+	app.Exit(0)
+
+	return nil
+}
+
+// shellExtensionArgs drops the registration flag and any command from the
+// arguments, leaving the flags the entry renames with.
+func shellExtensionArgs(args []string) []string {
+	args = slices.DeleteFunc(slices.Clone(args), func(arg string) bool {
+		return strings.HasPrefix(arg, "--register-shell-extension")
+	})
+
+	if len(args) > 0 && args[0] == "rename" {
+		args = args[1:]
+	}
+
+	return args
+}
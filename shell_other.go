@@ -0,0 +1,13 @@
+//go:build !windows
+
+package main
+
+import "errors"
+
+func registerShellExtension([]string) error {
+	return errors.New("the context menu entry is only supported on Windows")
+}
+
+func unregisterShellExtension() error {
+	return errors.New("the context menu entry is only supported on Windows")
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+// shellExtensionKey adds the entry for the current user to every PDF,
+// whichever application opens them.
+const shellExtensionKey = `Software\Classes\SystemFileAssociations\.pdf\shell\pdfrenamer`
+
+// registerShellExtension adds a verb to the context menu of PDFs in Explorer,
+// which runs this executable with the arguments on the clicked file.
+func registerShellExtension(args []string) error {
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to find executable: %w", err)
+	}
+
+	command := []string{syscall.EscapeArg(executable)}
+	for _, arg := range args {
+		command = append(command, syscall.EscapeArg(arg))
+	}
+
+	command = append(command, `"%1"`)
+
+	values := map[string]map[string]string{
+		shellExtensionKey: {
+			"":     shellExtensionLabel,
+			"Icon": executable,
+		},
+		shellExtensionKey + `\command`: {
+			"": strings.Join(command, " "),
+		},
+	}
+
+	for path, entries := range values {
+		key, _, err := registry.CreateKey(registry.CURRENT_USER, path, registry.SET_VALUE)
+		if err != nil {
+			return fmt.Errorf("failed to create registry key: %w", err)
+		}
+
+		for name, value := range entries {
+			err = key.SetStringValue(name, value)
+			if err != nil {
+				_ = key.Close()
+				return fmt.Errorf("failed to set registry value: %w", err)
+			}
+		}
+
+		_ = key.Close()
+	}
+
+	return nil
+}
+
+// unregisterShellExtension removes the verb, which is not an error when it
+// was never added.
+func unregisterShellExtension() error {
+	for _, path := range []string{shellExtensionKey + `\command`, shellExtensionKey} {
+		err := registry.DeleteKey(registry.CURRENT_USER, path)
+		if err != nil && !errors.Is(err, registry.ErrNotExist) {
+			return fmt.Errorf("failed to delete registry key: %w", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// documentResult is the line of JSON printed for each document with --json.
+type documentResult struct {
+	Source   string `json:"source"`
+	OK       bool   `json:"ok"`
+	Filename string `json:"filename,omitempty"`
+	Error    string `json:"error,omitempty"`
+	Kind     string `json:"kind,omitempty"`
+}
+
+// renameJSON renames each document and prints its result as a line of JSON,
+// for Shortcuts and Finder Quick Actions, which pass the selected files as
+// arguments and have no terminal to prompt in. The exit code is the same as
+// for a batch, so some documents failing exits with exitPartial.
+func (c *RenameCmd) renameJSON(ctx context.Context) error {
+	if c.Review {
+		return errors.New("--review prompts in an editor, which cannot be used with --json")
+	}
+
+	c.renamed = map[string]string{}
+	encoder := json.NewEncoder(os.Stdout)
+	results := &batch{}
+
+	for _, source := range c.Filenames {
+		err := c.renameDocument(ctx, source)
+		results.add(source, err)
+
+		result := documentResult{Source: source, OK: err == nil, Filename: c.renamed[source]}
+		if err != nil {
+			result.Error = err.Error()
+			result.Kind = failureKind(err)
+		}
+
+		err = encoder.Encode(result)
+		if err != nil {
+			return fmt.Errorf("failed to write result: %w", err)
+		}
+	}
+
+	return results.err()
+}
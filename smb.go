@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/hirochachacha/go-smb2"
+)
+
+// smbShare reads and files documents on a Windows share.
+type smbShare struct {
+	conn    net.Conn
+	session *smb2.Session
+	share   *smb2.Share
+	uri     string
+}
+
+// newSMBShare signs in with the credentials in the URI, which may include a
+// domain as `DOMAIN;user`, or SMB_USERNAME and SMB_PASSWORD, and mounts the
+// share.
+func newSMBShare(ctx context.Context, uri *url.URL, name string) (*smbShare, error) {
+	initiator := &smb2.NTLMInitiator{
+		User:     os.Getenv("SMB_USERNAME"),
+		Password: os.Getenv("SMB_PASSWORD"),
+	}
+
+	if uri.User != nil {
+		initiator.User = uri.User.Username()
+		if password, ok := uri.User.Password(); ok {
+			initiator.Password = password
+		}
+	}
+
+	if domain, user, ok := strings.Cut(initiator.User, ";"); ok {
+		initiator.Domain, initiator.User = domain, user
+	}
+
+	address := uri.Host
+	if uri.Port() == "" {
+		address = net.JoinHostPort(uri.Hostname(), "445")
+	}
+
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", address, err)
+	}
+
+	dialer := &smb2.Dialer{Initiator: initiator}
+
+	session, err := dialer.DialContext(ctx, conn)
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("failed to sign in to %s: %w", address, err)
+	}
+
+	share, err := session.Mount(name)
+	if err != nil {
+		_ = session.Logoff()
+		return nil, fmt.Errorf("failed to mount %s: %w", name, err)
+	}
+
+	return &smbShare{
+		conn:    conn,
+		session: session,
+		share:   share,
+		uri:     "smb://" + uri.Host + "/" + name,
+	}, nil
+}
+
+func (s *smbShare) get(ctx context.Context, key string, w io.Writer) error {
+	file, err := s.share.WithContext(ctx).Open(key)
+	if err != nil {
+		return fmt.Errorf("failed to open %s/%s: %w", s.uri, key, err)
+	}
+	defer file.Close()
+
+	_, err = io.Copy(w, file)
+	if err != nil {
+		return fmt.Errorf("failed to download %s/%s: %w", s.uri, key, err)
+	}
+
+	return nil
+}
+
+// put uploads the file, refusing to overwrite an existing file.
+func (s *smbShare) put(ctx context.Context, key string, r io.Reader) error {
+	share := s.share.WithContext(ctx)
+
+	err := s.mkdirAll(share, path.Dir(key))
+	if err != nil {
+		return err
+	}
+
+	file, err := share.OpenFile(key, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to create %s/%s: %w", s.uri, key, err)
+	}
+
+	_, err = io.Copy(file, r)
+	if err != nil {
+		_ = file.Close()
+		_ = share.Remove(key)
+
+		return fmt.Errorf("failed to upload %s/%s: %w", s.uri, key, err)
+	}
+
+	return file.Close()
+}
+
+func (s *smbShare) delete(ctx context.Context, key string) error {
+	err := s.share.WithContext(ctx).Remove(key)
+	if err != nil {
+		return fmt.Errorf("failed to delete %s/%s: %w", s.uri, key, err)
+	}
+
+	return nil
+}
+
+// move renames the file on the share, which never replaces an existing file.
+func (s *smbShare) move(ctx context.Context, from, to string) error {
+	share := s.share.WithContext(ctx)
+
+	err := s.mkdirAll(share, path.Dir(to))
+	if err != nil {
+		return err
+	}
+
+	err = share.Rename(from, to)
+	if err != nil {
+		return fmt.Errorf("failed to move %s/%s: %w", s.uri, from, err)
+	}
+
+	return nil
+}
+
+func (s *smbShare) mkdirAll(share *smb2.Share, dir string) error {
+	if dir == "." {
+		return nil
+	}
+
+	err := share.MkdirAll(dir, 0o755)
+	if err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	return nil
+}
+
+// close unmounts the share and signs off, which closes the connection, or
+// closes it when signing off fails.
+func (s *smbShare) close() error {
+	err := errors.Join(s.share.Umount(), s.session.Logoff())
+	if err != nil {
+		_ = s.conn.Close()
+	}
+
+	return err
+}
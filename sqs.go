@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+type SQSCmd struct {
+	QueueURL          string `help:"URL of the SQS queue receiving S3 ObjectCreated notifications" required:""`
+	Region            string `help:"AWS region (defaults to AWS_REGION)"`
+	S3Endpoint        string `help:"S3 endpoint for S3 compatible storage, using path-style addressing" name:"s3-endpoint"`
+	DestinationPrefix string `help:"key prefix renamed objects are moved under (defaults to the prefix of the original object)"`
+
+	RenameFlags `embed:""`
+}
+
+// s3Event is an S3 event notification, which may be wrapped in an SNS
+// notification.
+type s3Event struct {
+	Type    string `json:"Type"`
+	Message string `json:"Message"`
+	Event   string `json:"Event"`
+	Records []struct {
+		EventName string `json:"eventName"`
+		S3        struct {
+			Bucket struct {
+				Name string `json:"name"`
+			} `json:"bucket"`
+			Object struct {
+				Key string `json:"key"`
+			} `json:"object"`
+		} `json:"s3"`
+	} `json:"Records"`
+}
+
+type sqsMessage struct {
+	MessageID     string `json:"MessageId"`
+	ReceiptHandle string `json:"ReceiptHandle"`
+	Body          string `json:"Body"`
+}
+
+// Run processes new uploads until interrupted. A message is only deleted once
+// every object it references has been renamed, so failures are retried after
+// the queue's visibility timeout.
+func (c *SQSCmd) Run() error {
+	ctx := context.Background()
+
+	err := c.checkRemote()
+	if err != nil {
+		return err
+	}
+
+	client, err := newAWSClient(ctx, c.Region)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("sqs.listen", "queue", c.QueueURL)
+
+	for {
+		messages, err := c.receive(ctx, client)
+		if err != nil {
+			slog.Error("sqs.receive", "error", err)
+			time.Sleep(10 * time.Second)
+
+			continue
+		}
+
+		for _, message := range messages {
+			err := c.handle(ctx, client, message)
+			if err != nil {
+				slog.Error("sqs.message", "id", message.MessageID, "error", err)
+				continue
+			}
+
+			err = c.call(ctx, client, "DeleteMessage", map[string]any{
+				"QueueUrl":      c.QueueURL,
+				"ReceiptHandle": message.ReceiptHandle,
+			}, nil)
+			if err != nil {
+				slog.Error("sqs.delete", "id", message.MessageID, "error", err)
+			}
+		}
+	}
+}
+
+func (c *SQSCmd) receive(ctx context.Context, client *awsClient) ([]sqsMessage, error) {
+	var response struct {
+		Messages []sqsMessage `json:"Messages"`
+	}
+
+	err := c.call(ctx, client, "ReceiveMessage", map[string]any{
+		"QueueUrl":            c.QueueURL,
+		"MaxNumberOfMessages": 10,
+		"WaitTimeSeconds":     20,
+	}, &response)
+
+	return response.Messages, err
+}
+
+// call invokes an SQS action using its JSON protocol.
+func (c *SQSCmd) call(ctx context.Context, client *awsClient, action string, input, output any) error {
+	queue, err := url.Parse(c.QueueURL)
+	if err != nil {
+		return fmt.Errorf("failed to parse queue URL: %w", err)
+	}
+
+	payload, err := json.Marshal(input)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %w", action, err)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, queue.Scheme+"://"+queue.Host+"/", nil)
+	if err != nil {
+		return fmt.Errorf("failed to create %s request: %w", action, err)
+	}
+
+	request.Header.Set("Content-Type", "application/x-amz-json-1.0")
+	request.Header.Set("X-Amz-Target", "AmazonSQS."+action)
+
+	response, err := client.do(request, "sqs", payload)
+	if err != nil {
+		return fmt.Errorf("failed to %s: %w", action, err)
+	}
+	defer response.Body.Close()
+
+	if output == nil {
+		return nil
+	}
+
+	err = json.NewDecoder(response.Body).Decode(output)
+	if err != nil {
+		return fmt.Errorf("failed to decode %s: %w", action, err)
+	}
+
+	return nil
+}
+
+func (c *SQSCmd) handle(ctx context.Context, client *awsClient, message sqsMessage) error {
+	var event s3Event
+
+	err := json.Unmarshal([]byte(message.Body), &event)
+	if err != nil {
+		return fmt.Errorf("failed to decode notification: %w", err)
+	}
+
+	if event.Type == "Notification" {
+		err = json.Unmarshal([]byte(event.Message), &event)
+		if err != nil {
+			return fmt.Errorf("failed to decode SNS notification: %w", err)
+		}
+	}
+
+	if event.Event == "s3:TestEvent" {
+		return nil
+	}
+
+	for _, record := range event.Records {
+		if !strings.HasPrefix(record.EventName, "ObjectCreated:") {
+			continue
+		}
+
+		// keys in notifications are URL encoded, with spaces as plus signs
+		key, err := url.QueryUnescape(record.S3.Object.Key)
+		if err != nil {
+			return fmt.Errorf("failed to decode key %q: %w", record.S3.Object.Key, err)
+		}
+
+		if !strings.EqualFold(path.Ext(key), ".pdf") {
+			continue
+		}
+
+		bucket := newS3Bucket(client, record.S3.Bucket.Name, c.S3Endpoint)
+
+		err = c.process(ctx, bucket, key)
+		if err != nil {
+			return fmt.Errorf("failed to process s3://%s/%s: %w", bucket.name, key, err)
+		}
+	}
+
+	return nil
+}
+
+// process downloads the object, renames it locally, and moves the object to
+// the new key.
+func (c *SQSCmd) process(ctx context.Context, bucket *s3Bucket, key string) error {
+	renamed, err := bucket.renamed(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	if renamed {
+		slog.Info("sqs.skip", "bucket", bucket.name, "key", key)
+		return nil
+	}
+
+	staging, err := os.MkdirTemp("", "pdfrenamer-s3-*")
+	if err != nil {
+		return fmt.Errorf("failed to create staging directory: %w", err)
+	}
+	defer func() { _ = os.RemoveAll(staging) }()
+
+	source := filepath.Join(staging, path.Base(key))
+
+	file, err := os.Create(source)
+	if err != nil {
+		return fmt.Errorf("failed to create download: %w", err)
+	}
+
+	err = bucket.get(ctx, key, file)
+	_ = file.Close()
+	if err != nil {
+		return err
+	}
+
+	flags := c.RenameFlags
+	flags.dir = filepath.Join(staging, "renamed")
+
+	prefix := c.DestinationPrefix
+	if prefix == "" {
+		prefix = path.Dir(key)
+	}
+
+	// the key a staged file is filed at
+	keyOf := func(filename string) (string, error) {
+		if filename == source {
+			return key, nil
+		}
+
+		name, err := filepath.Rel(flags.dir, filename)
+		if err != nil {
+			return "", fmt.Errorf("failed to find new name: %w", err)
+		}
+
+		return strings.TrimPrefix(path.Join(prefix, filepath.ToSlash(name)), "./"), nil
+	}
+
+	flags.locate = func(filename string) string {
+		key, err := keyOf(filename)
+		if err != nil {
+			return filename
+		}
+
+		return "s3://" + bucket.name + "/" + key
+	}
+
+	filename, err := flags.rename(ctx, source)
+	if err != nil {
+		return err
+	}
+
+	newKey, err := keyOf(filename)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("sqs.rename", "bucket", bucket.name, "key", key, "new", newKey)
+
+	if c.DryRun || newKey == key {
+		return nil
+	}
+
+	return bucket.move(ctx, key, newKey)
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// defaultPrices are the prices per million prompt and completion tokens of
+// common models, in US dollars.
+var defaultPrices = map[string]tokenPrice{
+	"gpt-4o":      {Prompt: 2.50, Completion: 10.00},
+	"gpt-4o-mini": {Prompt: 0.15, Completion: 0.60},
+}
+
+type tokenPrice struct {
+	Prompt     float64
+	Completion float64
+}
+
+// parsePrices adds prices formatted as prompt/completion, by model, to the
+// default prices.
+func parsePrices(flags map[string]string) (map[string]tokenPrice, error) {
+	prices := maps.Clone(defaultPrices)
+
+	for model, price := range flags {
+		prompt, completion, _ := strings.Cut(price, "/")
+
+		promptPrice, err := strconv.ParseFloat(prompt, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse prompt price of %s: %w", model, err)
+		}
+
+		completionPrice, err := strconv.ParseFloat(completion, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse completion price of %s: %w", model, err)
+		}
+
+		prices[model] = tokenPrice{Prompt: promptPrice, Completion: completionPrice}
+	}
+
+	return prices, nil
+}
+
+// priceOf finds the price of the model, also under its name without the
+// vendor prefix that gateways such as OpenRouter give it, as in openai/gpt-4o.
+func priceOf(prices map[string]tokenPrice, model string) (tokenPrice, bool) {
+	if price, ok := prices[model]; ok {
+		return price, true
+	}
+
+	_, name, ok := strings.Cut(model, "/")
+	if !ok {
+		return tokenPrice{}, false
+	}
+
+	price, ok := prices[name]
+
+	return price, ok
+}
+
+// cost is the price of the tokens in US dollars.
+func (p tokenPrice) cost(tokens ledgerTokens) float64 {
+	return (float64(tokens.Prompt)*p.Prompt + float64(tokens.Completion)*p.Completion) / 1_000_000
+}
+
+type StatsCmd struct {
+	Ledger string            `help:"ledger to aggregate (defaults to the user config directory)" type:"path"`
+	Fields []string          `help:"extracted fields to list the most common values of" default:"Vendor,Category"`
+	Top    int               `help:"number of most common values to list for each field" default:"5"`
+	Price  map[string]string `help:"price per million prompt and completion tokens of a model, e.g. gpt-4o=2.50/10.00"`
+}
+
+// Run aggregates the ledger of renamed documents, for budgeting the spend on
+// the provider.
+func (c *StatsCmd) Run() error {
+	path := c.Ledger
+	if path == "" {
+		var err error
+
+		path, err = defaultLedgerPath()
+		if err != nil {
+			return err
+		}
+	}
+
+	entries, err := loadLedger(path)
+	if err != nil {
+		return err
+	}
+
+	if len(entries) == 0 {
+		return fmt.Errorf("no documents in ledger %q: %w", path, errNothingToDo)
+	}
+
+	prices, err := parsePrices(c.Price)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	c.write(w, entries, prices)
+
+	return w.Flush()
+}
+
+func (c *StatsCmd) write(w io.Writer, entries []ledgerEntry, prices map[string]tokenPrice) {
+	pages := 0
+	months := map[string][2]int{}
+	usage := map[string]ledgerTokens{}
+
+	for _, entry := range entries {
+		pages += entry.Pages
+
+		month := entry.Time.Local().Format("2006-01")
+		months[month] = [2]int{months[month][0] + 1, months[month][1] + entry.Pages}
+
+		for model, tokens := range entry.Usage {
+			total := usage[model]
+			total.Requests += tokens.Requests
+			total.Prompt += tokens.Prompt
+			total.Completion += tokens.Completion
+			usage[model] = total
+		}
+	}
+
+	fmt.Fprintf(w, "documents:\t%d\n", len(entries))
+	fmt.Fprintf(w, "pages:\t%d\t(%.1f per document)\n", pages, float64(pages)/float64(len(entries)))
+
+	fmt.Fprintln(w, "\nmonth\tdocuments\tpages")
+	for _, month := range slices.Sorted(maps.Keys(months)) {
+		fmt.Fprintf(w, "%s\t%d\t%d\n", month, months[month][0], months[month][1])
+	}
+
+	fmt.Fprintln(w, "\nmodel\tprompt tokens\tcompletion tokens\tcost")
+	for _, model := range slices.Sorted(maps.Keys(usage)) {
+		tokens := usage[model]
+
+		cost := "unknown"
+		if price, ok := priceOf(prices, model); ok {
+			cost = fmt.Sprintf("$%.2f", price.cost(tokens))
+		}
+
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\n", model, tokens.Prompt, tokens.Completion, cost)
+	}
+
+	for _, field := range c.Fields {
+		counts := map[string]int{}
+		for _, entry := range entries {
+			if value := strings.TrimSpace(entry.Values[field]); value != "" {
+				counts[value]++
+			}
+		}
+
+		values := slices.SortedFunc(maps.Keys(counts), func(a, b string) int {
+			return cmp.Or(counts[b]-counts[a], strings.Compare(a, b))
+		})
+
+		fmt.Fprintf(w, "\n%s\tdocuments\n", strings.ToLower(field))
+		for _, value := range values[:min(c.Top, len(values))] {
+			fmt.Fprintf(w, "%s\t%d\n", value, counts[value])
+		}
+	}
+}
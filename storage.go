@@ -0,0 +1,312 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// objectStore is a bucket in a cloud object store that documents are read
+// from and filed into.
+type objectStore interface {
+	get(ctx context.Context, key string, w io.Writer) error
+	put(ctx context.Context, key string, r io.Reader) error
+	delete(ctx context.Context, key string) error
+	// move renames an object within the bucket.
+	move(ctx context.Context, from, to string) error
+	// close releases the connection to the store, if it holds one.
+	close() error
+}
+
+// location is a local path, or an object in a bucket when store is set.
+type location struct {
+	store objectStore
+	uri   string
+	key   string
+}
+
+func (l location) remote() bool {
+	return l.store != nil
+}
+
+// storageSchemes are the URI schemes of the supported object stores.
+var storageSchemes = []string{"s3", "gs", "webdav", "webdavs", "sftp", "smb"}
+
+// isRemote reports whether name is an object store URI rather than a path.
+func isRemote(name string) bool {
+	for _, scheme := range storageSchemes {
+		if strings.HasPrefix(name, scheme+"://") {
+			return true
+		}
+	}
+
+	return false
+}
+
+type StorageFlags struct {
+	Destination string `help:"directory, or s3://, gs://, webdav(s)://, sftp://, or smb:// URI, to file renamed documents into (defaults to the working directory, or the folder of a remote document)"`
+	S3Endpoint  string `help:"S3 endpoint for S3 compatible storage, using path-style addressing" name:"s3-endpoint"`
+}
+
+// open resolves a path or object store URI. Cloud credentials are only loaded
+// for URIs, so local renames do not require them.
+func (f *StorageFlags) open(ctx context.Context, name string) (location, error) {
+	if !isRemote(name) {
+		return location{key: name}, nil
+	}
+
+	uri, err := url.Parse(name)
+	if err != nil {
+		return location{}, fmt.Errorf("failed to parse %q: %w", name, err)
+	}
+
+	if uri.Host == "" {
+		return location{}, fmt.Errorf("no bucket in %q", name)
+	}
+
+	loc := location{
+		uri: uri.Scheme + "://" + uri.Host,
+		key: strings.TrimPrefix(uri.Path, "/"),
+	}
+
+	switch uri.Scheme {
+	case "s3":
+		client, err := newAWSClient(ctx, "")
+		if err != nil {
+			return location{}, err
+		}
+
+		loc.store = newS3Bucket(client, uri.Host, f.S3Endpoint)
+	case "gs":
+		loc.store, err = newGCSBucket(ctx, uri.Host)
+		if err != nil {
+			return location{}, err
+		}
+	case "webdav", "webdavs":
+		loc.store = newWebDAVShare(uri)
+	case "sftp":
+		loc.store, err = newSFTPServer(uri)
+		if err != nil {
+			return location{}, err
+		}
+	case "smb":
+		// the share is part of the location, as files cannot be renamed
+		// between shares
+		share, key, _ := strings.Cut(loc.key, "/")
+		if share == "" {
+			return location{}, fmt.Errorf("no share in %q", name)
+		}
+
+		store, err := newSMBShare(ctx, uri, share)
+		if err != nil {
+			return location{}, err
+		}
+
+		loc.store, loc.uri, loc.key = store, store.uri, key
+	}
+
+	return loc, nil
+}
+
+// close releases the connection to the store of a remote location.
+func (l location) close() {
+	if !l.remote() {
+		return
+	}
+
+	err := l.store.close()
+	if err != nil {
+		slog.Warn("storage.close", "uri", l.uri, "error", err)
+	}
+}
+
+// String returns the path or URI of the location.
+func (l location) String() string {
+	if !l.remote() {
+		return l.key
+	}
+
+	return l.uri + "/" + l.key
+}
+
+// join returns the location of name inside of a directory location.
+func (l location) join(name string) location {
+	l.key = strings.TrimPrefix(path.Join(l.key, name), "./")
+	if l.key == "." {
+		l.key = ""
+	}
+
+	return l
+}
+
+// download copies the object to filename.
+func (l location) download(ctx context.Context, filename string) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("failed to create download: %w", err)
+	}
+
+	err = l.store.get(ctx, l.key, file)
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// upload copies filename to the object.
+func (l location) upload(ctx context.Context, filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return fmt.Errorf("failed to open upload: %w", err)
+	}
+	defer file.Close()
+
+	return l.store.put(ctx, l.key, file)
+}
+
+// renameObject renames a document when the input or the destination is in an
+// object store. Remote documents are downloaded to a staging directory,
+// renamed there, and filed into the destination, removing the original. The
+// run manifest and the ledger record the URIs, not the staging directory.
+func (c *RenameCmd) renameObject(ctx context.Context, name string) error {
+	err := c.checkRemote()
+	if err != nil {
+		return err
+	}
+
+	source, err := c.open(ctx, name)
+	if err != nil {
+		return err
+	}
+	defer source.close()
+
+	destination, err := c.open(ctx, c.Destination)
+	if err != nil {
+		return err
+	}
+	defer destination.close()
+
+	// remote documents stay in their folder by default
+	if c.Destination == "" && source.remote() {
+		destination = source
+		destination.key = path.Dir(source.key)
+	}
+
+	staging, err := os.MkdirTemp("", "pdfrenamer-objects-*")
+	if err != nil {
+		return fmt.Errorf("failed to create staging directory: %w", err)
+	}
+	defer func() { _ = os.RemoveAll(staging) }()
+
+	filename := source.key
+	switch {
+	case source.remote():
+		filename = filepath.Join(staging, path.Base(source.key))
+
+		err = source.download(ctx, filename)
+		if err != nil {
+			return err
+		}
+	case destination.remote():
+		// the staged copy is locked while it is renamed, so the document
+		// is locked too
+		unlock, err := lockFile(source.key)
+		if err != nil {
+			return fmt.Errorf("failed to acquire lock: %w", err)
+		}
+		defer func() { _ = unlock() }()
+
+		// the local document is only removed once it has been uploaded
+		filename = filepath.Join(staging, filepath.Base(source.key))
+
+		err = copyFile(source.key, filename)
+		if err != nil {
+			return fmt.Errorf("failed to stage %q: %w", source.key, err)
+		}
+	}
+
+	flags := c.RenameFlags
+	flags.dir = destination.key
+	if destination.remote() {
+		flags.dir = filepath.Join(staging, "renamed")
+	}
+
+	// where a staged file is filed
+	locate := func(staged string) (location, error) {
+		if staged == filename {
+			return source, nil
+		}
+
+		if !destination.remote() {
+			return location{key: staged}, nil
+		}
+
+		name, err := filepath.Rel(flags.dir, staged)
+		if err != nil || !filepath.IsLocal(name) {
+			return location{}, fmt.Errorf("failed to file %q outside of %s", staged, destination)
+		}
+
+		return destination.join(filepath.ToSlash(name)), nil
+	}
+
+	flags.locate = func(staged string) string {
+		filed, err := locate(staged)
+		if err != nil {
+			return staged
+		}
+
+		return filed.String()
+	}
+
+	renamed, err := flags.rename(ctx, filename)
+	if err != nil {
+		return err
+	}
+
+	target, err := locate(renamed)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("storage.rename", "source", source.String(), "destination", target.String())
+
+	c.report(source.String(), target.String())
+
+	if c.DryRun {
+		return nil
+	}
+
+	switch {
+	case source.remote() && source.uri == target.uri:
+		if source.key == target.key {
+			return nil
+		}
+
+		return source.store.move(ctx, source.key, target.key)
+	case target.remote():
+		err = target.upload(ctx, renamed)
+		if err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case source.remote():
+		return source.store.delete(ctx, source.key)
+	case target.remote():
+		err = os.Remove(source.key)
+		if err != nil {
+			return fmt.Errorf("failed to remove %q: %w", source.key, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/alecthomas/kong"
+	"github.com/sashabaranov/go-openai"
+)
+
+// pagePattern is a regular expression matched against the markdown of a page
+// as it arrives.
+type pagePattern struct {
+	*regexp.Regexp
+}
+
+func (p *pagePattern) Decode(ctx *kong.DecodeContext) error {
+	var value string
+
+	err := ctx.Scan.PopValueInto("pattern", &value)
+	if err != nil {
+		return err
+	}
+
+	p.Regexp, err = regexp.Compile(value)
+	if err != nil {
+		return fmt.Errorf("failed to parse regular expression: %w", err)
+	}
+
+	return nil
+}
+
+func (p pagePattern) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+// streams reports whether pages are converted with streaming completions,
+// which --preview and --skip-page need to see the markdown as it arrives.
+// Bedrock's pages are converted whole, and only then checked for --skip-page.
+func (c *RenameFlags) streams() bool {
+	return !c.Bedrock && ((c.Preview && isTerminal(os.Stderr)) || len(c.SkipPage) != 0)
+}
+
+// isTerminal reports whether the file is a terminal rather than a pipe or a
+// regular file.
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	if err != nil {
+		return false
+	}
+
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// previewMu keeps the previews of documents converted at the same time from
+// breaking each other's lines.
+var previewMu sync.Mutex
+
+// preview writes the markdown of a page to the terminal as it arrives.
+type preview struct {
+	w      io.Writer
+	source string
+	page   int
+	line   strings.Builder
+}
+
+// write shows the complete lines of the delta, each prefixed with the
+// document and page, holding back a partial line until it is complete.
+func (p *preview) write(delta string) {
+	if p == nil {
+		return
+	}
+
+	p.line.WriteString(delta)
+
+	text := p.line.String()
+	end := strings.LastIndexByte(text, '\n')
+	if end < 0 {
+		return
+	}
+
+	p.line.Reset()
+	p.line.WriteString(text[end+1:])
+
+	previewMu.Lock()
+	defer previewMu.Unlock()
+
+	for _, line := range strings.Split(text[:end], "\n") {
+		fmt.Fprintf(p.w, "%s #%d │ %s\n", p.source, p.page, line)
+	}
+}
+
+// flush shows the partial line left once the page is done.
+func (p *preview) flush() {
+	if 0 < p.line.Len() {
+		p.write("\n")
+	}
+}
+
+// streamPage converts a page to markdown with a streaming completion, showing
+// it with --preview and cancelling it once it matches --skip-page, which
+// leaves the markdown that arrived until then.
+func (c *RenameFlags) streamPage(ctx context.Context, client *openai.Client, source string, n int, request openai.ChatCompletionRequest) (string, error) {
+	var view *preview
+	if c.Preview && isTerminal(os.Stderr) {
+		view = &preview{w: os.Stderr, source: filepath.Base(source), page: n}
+		defer view.flush()
+	}
+
+	markdown := &strings.Builder{}
+
+	request.Stream = true
+	request.StreamOptions = &openai.StreamOptions{IncludeUsage: true}
+
+	err := c.callProvider(ctx, "markdown", request.Model, func(ctx context.Context, _ *span) (openai.Usage, error) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		usage := openai.Usage{}
+
+		stream, err := client.CreateChatCompletionStream(ctx, request)
+		if err == nil {
+			err = receive(stream, &usage, func(delta string) bool {
+				markdown.WriteString(delta)
+				view.write(delta)
+
+				return !c.irrelevant(markdown.String())
+			})
+		}
+
+		return usage, err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return markdown.String(), nil
+}
+
+// receive reads the deltas of the stream until it ends, or until more
+// returns false, which closes the stream so the provider stops generating.
+func receive(stream *openai.ChatCompletionStream, usage *openai.Usage, more func(delta string) bool) error {
+	defer stream.Close()
+
+	for {
+		response, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if response.Usage != nil {
+			*usage = *response.Usage
+		}
+
+		if len(response.Choices) == 0 {
+			continue
+		}
+
+		if !more(response.Choices[0].Delta.Content) {
+			return nil
+		}
+	}
+}
+
+// irrelevant reports whether the markdown of a page matches --skip-page.
+func (c *RenameFlags) irrelevant(markdown string) bool {
+	for _, pattern := range c.SkipPage {
+		if pattern.MatchString(markdown) {
+			return true
+		}
+	}
+
+	return false
+}
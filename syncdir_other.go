@@ -0,0 +1,7 @@
+//go:build !unix
+
+package main
+
+// syncDir does nothing, as a directory cannot be opened for syncing outside
+// of Unix.
+func syncDir(string) {}
@@ -0,0 +1,28 @@
+//go:build unix
+
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"os"
+	"syscall"
+)
+
+// syncDir flushes directory entries so a completed rename survives a crash.
+// File systems that cannot sync a directory, such as some network shares,
+// refuse with EINVAL or ENOTSUP, which is not a problem. The rename has
+// already happened, so a directory that cannot be synced is only a warning.
+func syncDir(dir string) {
+	file, err := os.Open(dir)
+	if err != nil {
+		slog.Warn("rename.sync", "dir", dir, "error", err)
+		return
+	}
+	defer file.Close()
+
+	err = file.Sync()
+	if err != nil && !errors.Is(err, syscall.EINVAL) && !errors.Is(err, errors.ErrUnsupported) {
+		slog.Warn("rename.sync", "dir", dir, "error", err)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// markdownTables returns the rows of each table in the markdown, without the
+// rows separating the header.
+func markdownTables(markdown string) [][][]string {
+	tables := [][][]string{}
+	rows := [][]string{}
+
+	flush := func() {
+		if 0 < len(rows) {
+			tables = append(tables, rows)
+			rows = [][]string{}
+		}
+	}
+
+	for _, line := range strings.Split(markdown, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "|") {
+			flush()
+			continue
+		}
+
+		if strings.Trim(line, "|:- \t") == "" {
+			continue
+		}
+
+		rows = append(rows, tableCells(line))
+	}
+
+	flush()
+
+	return tables
+}
+
+// tableCells splits a row of a markdown table, keeping escaped pipes.
+func tableCells(line string) []string {
+	line = strings.TrimPrefix(line, "|")
+	if strings.HasSuffix(line, "|") && !strings.HasSuffix(line, `\|`) {
+		line = strings.TrimSuffix(line, "|")
+	}
+
+	cells := []string{}
+	cell := &strings.Builder{}
+
+	for i := 0; i < len(line); i++ {
+		switch {
+		case line[i] == '\\' && i+1 < len(line) && line[i+1] == '|':
+			cell.WriteByte('|')
+			i++
+		case line[i] == '|':
+			cells = append(cells, strings.TrimSpace(cell.String()))
+			cell.Reset()
+		default:
+			cell.WriteByte(line[i])
+		}
+	}
+
+	return append(cells, strings.TrimSpace(cell.String()))
+}
+
+// writeTables writes each table in the markdown as a CSV file next to the
+// renamed document, named after it, and returns their filenames.
+func writeTables(filename, markdown string) ([]string, error) {
+	stem := strings.TrimSuffix(filename, filepath.Ext(filename))
+	written := []string{}
+
+	for index, rows := range markdownTables(markdown) {
+		name := fmt.Sprintf("%s.table-%d.csv", stem, index+1)
+
+		err := writeFile(name, 0o644, true, func(file io.Writer) error {
+			return csv.NewWriter(file).WriteAll(rows)
+		})
+		if err != nil {
+			return written, fmt.Errorf("failed to write table: %w", err)
+		}
+
+		written = append(written, name)
+	}
+
+	return written, nil
+}
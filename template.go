@@ -0,0 +1,350 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+
+	"github.com/Masterminds/sprig/v3"
+)
+
+type TemplateFlags struct {
+	Format    string            `help:"format of the file to rename to" default:"{{.Title}}.pdf"`
+	Aliases   string            `help:"YAML file mapping extracted values to canonical values" type:"existingfile"`
+	Lookup    map[string]string `help:"named CSV or YAML tables for the lookup function (name=path)"`
+	Pipelines string            `help:"YAML file of the template functions each extracted field is piped through before the format, e.g. Vendor: [trim, stripCorpSuffix, alias, title]" type:"existingfile"`
+
+	Preset    string `help:"use a built-in format for a filing system instead of --format (johnny-decimal, para)" enum:",johnny-decimal,para" default:""`
+	PresetMap string `help:"CSV or YAML table mapping extracted categories to the preset's folders" type:"existingfile"`
+
+	AllowPaths bool `help:"allow formats that move files into other directories"`
+
+	FiscalYearStart int    `help:"month (1 to 12) the fiscal year starts in, for fiscalYearOf" default:"1"`
+	DateOrder       string `help:"order of the day and month in numeric dates such as 03/04/2024 (mdy, dmy)" enum:"mdy,dmy" default:"mdy"`
+	TimeZone        string `help:"time zone of extracted dates, such as Europe/Berlin (defaults to the local time zone)"`
+
+	NamingFlags `embed:""`
+
+	// ledger is the ledger nextIndex counts documents in, instead of the
+	// default one.
+	ledger string
+}
+
+// filenameTemplate is a parsed filename format along with the user-provided
+// data that its functions use.
+type filenameTemplate struct {
+	*template.Template
+
+	aliases    aliases
+	pipelines  pipelines
+	naming     NamingFlags
+	allowPaths bool
+
+	// indices are the indices nextIndex gave the document rendered with
+	// the template.
+	indices *documentIndices
+}
+
+// format returns the preset's format when one is selected.
+func (f *TemplateFlags) format() string {
+	if f.Preset != "" {
+		return presets[f.Preset]
+	}
+
+	return f.Format
+}
+
+// parse loads the files referenced by the flags and parses the format with
+// the template functions available to users.
+func (f *TemplateFlags) parse() (*filenameTemplate, error) {
+	aliases, err := loadAliases(f.Aliases)
+	if err != nil {
+		return nil, err
+	}
+
+	tables, err := loadLookupTables(f.Lookup)
+	if err != nil {
+		return nil, err
+	}
+
+	allowPaths := f.AllowPaths
+
+	if f.Preset != "" {
+		if f.PresetMap == "" {
+			return nil, fmt.Errorf("preset %q requires --preset-map", f.Preset)
+		}
+
+		tables["preset"], err = loadMapping(f.PresetMap)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load preset map: %w", err)
+		}
+
+		// presets file documents into folders
+		allowPaths = true
+	}
+
+	indices := newDocumentIndices(f.ledger)
+
+	funcs := template.FuncMap{
+		"canonical":           aliases.canonical,
+		"currencyOf":          currencyOf,
+		"jdArea":              jdArea(tables),
+		"lookup":              tables.lookup,
+		"localeTitle":         localeTitle,
+		"money":               money,
+		"nextIndex":           indices.next,
+		"normalizeCorpSuffix": normalizeCorpSuffix,
+		"stripCorpSuffix":     stripCorpSuffix,
+	}
+
+	if f.FiscalYearStart < 1 || 12 < f.FiscalYearStart {
+		return nil, fmt.Errorf("fiscal year start must be a month from 1 to 12, got %d", f.FiscalYearStart)
+	}
+
+	dates, err := f.dates()
+	if err != nil {
+		return nil, err
+	}
+
+	tmpl, err := template.New("filename").
+		Funcs(sprig.FuncMap()).
+		Funcs(dateFuncs(dates, f.FiscalYearStart)).
+		Funcs(funcs).
+		Parse(f.format())
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse filename format: %w", err)
+	}
+
+	pipelines, err := loadPipelines(f.Pipelines, tmpl, aliases)
+	if err != nil {
+		return nil, err
+	}
+
+	return &filenameTemplate{
+		Template:   tmpl,
+		aliases:    aliases,
+		pipelines:  pipelines,
+		naming:     f.NamingFlags,
+		allowPaths: allowPaths,
+		indices:    indices,
+	}, nil
+}
+
+// parseTemplate parses the format, counting documents in the ledger of the
+// flags for nextIndex.
+func (c *RenameFlags) parseTemplate() (*filenameTemplate, error) {
+	flags := c.TemplateFlags
+	flags.ledger = c.Ledger
+
+	return flags.parse()
+}
+
+// clean maps the values to their canonical values and pipes them through
+// their pipelines, before the format is rendered with them.
+func (t *filenameTemplate) clean(values map[string]string) error {
+	t.aliases.rewrite(values)
+
+	return t.pipelines.apply(values)
+}
+
+// render executes the format, applies the naming flags, and truncates the
+// result to the maximum length. A field missing from values is an error
+// rather than a literal `<no value>` in the name.
+func (t *filenameTemplate) render(values map[string]string) (string, error) {
+	filename, err := t.renderValues(values)
+	if err != nil {
+		return "", err
+	}
+
+	if 0 < t.naming.MaxLength && tooLong(filename, t.naming.MaxLength) {
+		return t.truncate(values, filename)
+	}
+
+	return filename, nil
+}
+
+func (t *filenameTemplate) renderValues(values map[string]string) (string, error) {
+	rendered := &strings.Builder{}
+
+	err := t.Execute(rendered, sanitizeValues(values))
+	if err != nil {
+		return "", fmt.Errorf("failed to execute filename format: %w", err)
+	}
+
+	if strings.Contains(rendered.String(), "<no value>") {
+		missing := []string{}
+		for _, field := range templateFields(t.Template) {
+			if _, ok := values[field]; !ok {
+				missing = append(missing, field)
+			}
+		}
+
+		return "", fmt.Errorf("rendered filename %q is missing fields: %s", rendered.String(), strings.Join(missing, ", "))
+	}
+
+	return t.naming.apply(rendered.String()), nil
+}
+
+// templateFields returns the sorted, unique top-level fields (e.g. `.Title`)
+// referenced anywhere in the template.
+func templateFields(tmpl *template.Template) []string {
+	fields := map[string]struct{}{}
+
+	var walk func(node parse.Node)
+	walk = func(node parse.Node) {
+		switch node := node.(type) {
+		case *parse.ListNode:
+			if node == nil {
+				return
+			}
+			for _, child := range node.Nodes {
+				walk(child)
+			}
+		case *parse.ActionNode:
+			walk(node.Pipe)
+		case *parse.PipeNode:
+			if node == nil {
+				return
+			}
+			for _, cmd := range node.Cmds {
+				walk(cmd)
+			}
+		case *parse.CommandNode:
+			for _, arg := range node.Args {
+				walk(arg)
+			}
+
+			// nextIndex counts documents by the fields it names
+			if identifier, ok := node.Args[0].(*parse.IdentifierNode); ok && identifier.Ident == "nextIndex" {
+				for _, arg := range node.Args[1:] {
+					if field, ok := arg.(*parse.StringNode); ok {
+						fields[field.Text] = struct{}{}
+					}
+				}
+			}
+		case *parse.ChainNode:
+			walk(node.Node)
+		case *parse.FieldNode:
+			fields[node.Ident[0]] = struct{}{}
+		case *parse.IfNode:
+			walk(node.Pipe)
+			walk(node.List)
+			walk(node.ElseList)
+		case *parse.RangeNode:
+			walk(node.Pipe)
+			walk(node.List)
+			walk(node.ElseList)
+		case *parse.WithNode:
+			walk(node.Pipe)
+			walk(node.List)
+			walk(node.ElseList)
+		case *parse.TemplateNode:
+			walk(node.Pipe)
+		}
+	}
+
+	for _, t := range tmpl.Templates() {
+		if t.Tree != nil {
+			walk(t.Tree.Root)
+		}
+	}
+
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	return names
+}
+
+// templateText returns the literal text of the template outside of actions.
+func templateText(tmpl *template.Template) string {
+	text := &strings.Builder{}
+
+	for _, node := range tmpl.Tree.Root.Nodes {
+		if node, ok := node.(*parse.TextNode); ok {
+			text.Write(node.Text)
+		}
+	}
+
+	return text.String()
+}
+
+type TemplateCmd struct {
+	Lint TemplateLintCmd `cmd:"" help:"check a filename format and preview it with sample values"`
+}
+
+type TemplateLintCmd struct {
+	TemplateFlags `embed:""`
+
+	Sample map[string]string `help:"sample values to render the format with (Field=value)"`
+}
+
+func (c *TemplateLintCmd) Run() error {
+	filenameTemplate, err := c.parse()
+	if err != nil {
+		return err
+	}
+
+	tmpl := filenameTemplate.Template
+	fields := templateFields(tmpl)
+	warnings := []string{}
+
+	if len(fields) == 0 {
+		warnings = append(warnings, "format does not reference any extracted fields")
+	}
+
+	text := templateText(tmpl)
+	if strings.ContainsAny(text, `/\`) && !filenameTemplate.allowPaths {
+		warnings = append(warnings, "format contains path separators, which requires --allow-paths")
+	}
+
+	values := map[string]string{}
+	for _, field := range fields {
+		values[field] = "Sample " + field
+		if strings.Contains(field, "Date") || field == "PeriodStart" || field == "PeriodEnd" {
+			values[field] = time.Now().Format("2006-01-02")
+		}
+	}
+
+	for field, value := range c.Sample {
+		values[field] = value
+	}
+
+	err = filenameTemplate.clean(values)
+	if err != nil {
+		return err
+	}
+
+	filename, err := filenameTemplate.render(values)
+	if err != nil {
+		return err
+	}
+
+	if strings.TrimSpace(filename) == "" {
+		warnings = append(warnings, "format renders an empty filename")
+	}
+
+	err = filenameTemplate.validatePath(filename)
+	if err != nil {
+		warnings = append(warnings, err.Error())
+	}
+
+	if !strings.HasSuffix(strings.ToLower(filename), ".pdf") {
+		warnings = append(warnings, "rendered filename does not end in .pdf")
+	}
+
+	fmt.Printf("fields: %s\n", strings.Join(fields, ", "))
+
+	for _, warning := range warnings {
+		fmt.Printf("warning: %s\n", warning)
+	}
+
+	fmt.Printf("rendered: %s\n", filename)
+
+	return nil
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// span times a stage of the pipeline. Spans are logged when they end, and
+// exported with OTLP over HTTP when OTEL_EXPORTER_OTLP_ENDPOINT or
+// OTEL_EXPORTER_OTLP_TRACES_ENDPOINT is set.
+type span struct {
+	traceID  string
+	spanID   string
+	parentID string
+	name     string
+	start    time.Time
+	end      time.Time
+
+	attributes []any
+	err        error
+}
+
+type spanKey struct{}
+
+// startSpan starts a span, as a child of the span in the context if there is
+// one. Attributes are pairs of keys and values, as with slog.
+func startSpan(ctx context.Context, name string, attributes ...any) (context.Context, *span) {
+	s := &span{
+		traceID:    randomID(16),
+		spanID:     randomID(8),
+		name:       name,
+		start:      time.Now(),
+		attributes: attributes,
+	}
+
+	if parent, ok := ctx.Value(spanKey{}).(*span); ok {
+		s.traceID = parent.traceID
+		s.parentID = parent.spanID
+	}
+
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// set adds attributes that are only known once the stage has run.
+func (s *span) set(attributes ...any) {
+	s.attributes = append(s.attributes, attributes...)
+}
+
+// finish ends the span with the result of its stage. The spans of a trace are
+// exported together when its root span ends.
+func (s *span) finish(err error) {
+	s.end = time.Now()
+	s.err = err
+
+	slog.Debug("trace.span", append([]any{"name", s.name, "trace", s.traceID, "duration", s.end.Sub(s.start), "error", err}, s.attributes...)...)
+
+	tracer.add(s)
+}
+
+func randomID(size int) string {
+	id := make([]byte, size)
+	_, _ = rand.Read(id)
+
+	return hex.EncodeToString(id)
+}
+
+// tracer exports finished spans, when an OTLP endpoint is configured.
+var tracer = newOTLPExporter()
+
+type otlpExporter struct {
+	endpoint string
+	headers  map[string]string
+	service  string
+
+	mu     sync.Mutex
+	traces map[string][]*span
+}
+
+func newOTLPExporter() *otlpExporter {
+	exporter := &otlpExporter{
+		endpoint: os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"),
+		headers:  map[string]string{},
+		service:  os.Getenv("OTEL_SERVICE_NAME"),
+		traces:   map[string][]*span{},
+	}
+
+	if exporter.endpoint == "" {
+		if endpoint := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); endpoint != "" {
+			exporter.endpoint = strings.TrimSuffix(endpoint, "/") + "/v1/traces"
+		}
+	}
+
+	if exporter.service == "" {
+		exporter.service = "pdfrenamer"
+	}
+
+	// headers, such as API keys, are formatted as key1=value1,key2=value2
+	for _, header := range strings.Split(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"), ",") {
+		key, value, ok := strings.Cut(header, "=")
+		if ok {
+			exporter.headers[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+
+	return exporter
+}
+
+func (e *otlpExporter) add(s *span) {
+	if e.endpoint == "" {
+		return
+	}
+
+	e.mu.Lock()
+	spans := append(e.traces[s.traceID], s)
+	if s.parentID != "" {
+		e.traces[s.traceID] = spans
+		e.mu.Unlock()
+
+		return
+	}
+	delete(e.traces, s.traceID)
+	e.mu.Unlock()
+
+	err := e.export(spans)
+	if err != nil {
+		slog.Error("trace.export", "trace", s.traceID, "error", err)
+	}
+}
+
+// export sends the spans of a trace in the OTLP JSON encoding.
+func (e *otlpExporter) export(spans []*span) error {
+	encoded := []map[string]any{}
+
+	for _, s := range spans {
+		status := map[string]any{"code": 1}
+		if s.err != nil {
+			status = map[string]any{"code": 2, "message": s.err.Error()}
+		}
+
+		encoded = append(encoded, map[string]any{
+			"traceId":           s.traceID,
+			"spanId":            s.spanID,
+			"parentSpanId":      s.parentID,
+			"name":              s.name,
+			"kind":              1,
+			"startTimeUnixNano": strconv.FormatInt(s.start.UnixNano(), 10),
+			"endTimeUnixNano":   strconv.FormatInt(s.end.UnixNano(), 10),
+			"attributes":        otlpAttributes(s.attributes...),
+			"status":            status,
+		})
+	}
+
+	payload, err := json.Marshal(map[string]any{
+		"resourceSpans": []any{
+			map[string]any{
+				"resource": map[string]any{
+					"attributes": otlpAttributes("service.name", e.service),
+				},
+				"scopeSpans": []any{
+					map[string]any{
+						"scope": map[string]any{"name": "pdfrenamer"},
+						"spans": encoded,
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal spans: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, e.endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed to create export request: %w", err)
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+	for key, value := range e.headers {
+		request.Header.Set(key, value)
+	}
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return fmt.Errorf("failed to export spans: %w", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode/100 != 2 {
+		return fmt.Errorf("failed to export spans: %s", response.Status)
+	}
+
+	return nil
+}
+
+// otlpAttributes encodes pairs of keys and values as OTLP attributes.
+func otlpAttributes(pairs ...any) []map[string]any {
+	attributes := []map[string]any{}
+
+	for i := 0; i+1 < len(pairs); i += 2 {
+		var value map[string]any
+
+		switch v := pairs[i+1].(type) {
+		case int:
+			value = map[string]any{"intValue": strconv.Itoa(v)}
+		case bool:
+			value = map[string]any{"boolValue": v}
+		case float64:
+			value = map[string]any{"doubleValue": v}
+		default:
+			value = map[string]any{"stringValue": fmt.Sprint(v)}
+		}
+
+		attributes = append(attributes, map[string]any{
+			"key":   fmt.Sprint(pairs[i]),
+			"value": value,
+		})
+	}
+
+	return attributes
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// translate asks the text model to translate the extracted values into the
+// language of --translate-fields, leaving the document itself untouched.
+// Documents already in that language are not translated.
+func (c *RenameFlags) translate(ctx context.Context, client *openai.Client, language string, values map[string]string) error {
+	to := c.TranslateFields["to"]
+	if to == "" || strings.EqualFold(to, language) {
+		return nil
+	}
+
+	fields := slices.Collect(maps.Keys(values))
+	if only := c.TranslateFields["fields"]; only != "" {
+		fields = strings.Split(only, ",")
+	}
+
+	source := map[string]string{}
+	for _, field := range fields {
+		field = strings.TrimSpace(field)
+
+		// values that pdfrenamer matches against are kept as extracted
+		if field == "Language" || field == "Addressee" || (field == "Category" && 0 < len(c.Categories)) {
+			continue
+		}
+
+		if value, ok := values[field]; ok && value != "" {
+			source[field] = value
+		}
+	}
+
+	if len(source) == 0 {
+		return nil
+	}
+
+	payload, err := json.Marshal(source)
+	if err != nil {
+		return fmt.Errorf("failed to marshal values to translate: %w", err)
+	}
+
+	response, err := c.complete(
+		ctx,
+		client,
+		"translate",
+		openai.ChatCompletionRequest{
+			Model: c.TextModel,
+			Messages: []openai.ChatCompletionMessage{
+				{
+					Role: "system",
+					Content: fmt.Sprintf(`
+You are provided with a JSON object of values extracted from a document, which will be used in a filename. Translate the values into the language '%s'. Follow these instructions precisely:
+1. Output a valid JSON object with exactly the same keys.
+2. Keep dates, numbers, amounts, codes, and the names of people and companies unchanged.
+3. Translate everything else, such as titles and descriptions, keeping them as short as the original.
+4. Do not include any extraneous explanation, commentary, or additional data outside the JSON object.
+					`, to),
+				},
+				{
+					Role:    "user",
+					Content: string(payload),
+				},
+			},
+			ResponseFormat: &openai.ChatCompletionResponseFormat{
+				Type: openai.ChatCompletionResponseFormatTypeJSONObject,
+			},
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to translate values: %w", err)
+	}
+
+	content := response.Choices[0].Message.Content
+	slog.Info("translated", "to", to, "payload", content)
+
+	var translated map[string]string
+	err = json.Unmarshal([]byte(content), &translated)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal JSON payload: %w", err)
+	}
+
+	// only the values that were asked for are replaced
+	for field := range source {
+		if value, ok := translated[field]; ok && value != "" {
+			values[field] = value
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"maps"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// structuredValue matches values, such as dates, amounts, and account
+// numbers, that are never shortened when truncating a filename.
+var structuredValue = regexp.MustCompile(`^[\d\s\-./:,#]+$`)
+
+// tooLong reports whether any path element of the filename is longer than
+// limit bytes.
+func tooLong(filename string, limit int) bool {
+	for _, element := range strings.Split(filepath.ToSlash(filename), "/") {
+		if limit < len(element) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// truncate shortens the longest free text value a word at a time until the
+// rendered filename fits. If that is not enough, each path element that is
+// still too long is cut at a word boundary, keeping the extension of the
+// name.
+func (t *filenameTemplate) truncate(values map[string]string, filename string) (string, error) {
+	limit := t.naming.MaxLength
+	values = maps.Clone(values)
+
+	for tooLong(filename, limit) {
+		field := longestFreeText(values)
+		if field == "" {
+			break
+		}
+
+		values[field] = dropLastWord(values[field])
+
+		rendered, err := t.renderValues(values)
+		if err != nil {
+			return "", err
+		}
+
+		filename = rendered
+	}
+
+	if !tooLong(filename, limit) {
+		return filename, nil
+	}
+
+	elements := strings.Split(filepath.ToSlash(filename), "/")
+
+	for i, element := range elements {
+		ext := ""
+		if i == len(elements)-1 {
+			ext = filepath.Ext(element)
+		}
+
+		stem := strings.TrimSuffix(element, ext)
+
+		for limit < len(stem)+len(ext) && stem != "" {
+			stem = dropLastWord(stem)
+		}
+
+		elements[i] = stem + ext
+	}
+
+	return filepath.FromSlash(strings.Join(elements, "/")), nil
+}
+
+func longestFreeText(values map[string]string) string {
+	longest := ""
+
+	for field, value := range values {
+		if strings.TrimSpace(value) == "" || structuredValue.MatchString(value) {
+			continue
+		}
+
+		if longest == "" || len(values[longest]) < len(value) {
+			longest = field
+		}
+	}
+
+	return longest
+}
+
+// dropLastWord removes the final word, or the final character of a value
+// that is a single word.
+func dropLastWord(value string) string {
+	value = strings.TrimSpace(value)
+
+	if index := strings.LastIndexAny(value, " _"); 0 < index {
+		return strings.TrimRight(value[:index], " _-,.")
+	}
+
+	_, size := utf8.DecodeLastRuneInString(value)
+
+	return value[:len(value)-size]
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+type UndoCmd struct {
+	RunID   string `help:"ID of the run to undo, from its manifest or the run field of its logs" name:"run" required:""`
+	RunsDir string `help:"directory the manifests of runs are in (defaults to the user config directory)" type:"path"`
+	DryRun  bool   `help:"do not move files back, just print what would be done"`
+}
+
+// Run moves the documents renamed in the run back to their original names,
+// the most recent first. Documents that were moved since, or whose original
+// name is taken again, are left alone.
+func (c *UndoCmd) Run() error {
+	flags := &RenameFlags{RunsDir: c.RunsDir}
+
+	manifest, err := flags.loadRun(c.RunID)
+	if err != nil {
+		return err
+	}
+
+	results := &batch{}
+
+	for _, result := range slices.Backward(manifest.Results) {
+		if result.Filename == "" || result.Error != "" {
+			continue
+		}
+
+		results.add(result.Filename, c.undo(result))
+	}
+
+	results.summarize(os.Stderr)
+
+	return results.err()
+}
+
+func (c *UndoCmd) undo(result runResult) error {
+	if isRemote(result.Source) || isRemote(result.Filename) {
+		return fmt.Errorf("cannot move remote document %q back", result.Filename)
+	}
+
+	_, err := os.Stat(result.Filename)
+	if err != nil {
+		return fmt.Errorf("failed to find renamed document: %w", err)
+	}
+
+	_, err = os.Lstat(result.Source)
+	if err == nil {
+		return fmt.Errorf("failed to move back: %w", &os.PathError{Op: "rename", Path: result.Source, Err: os.ErrExist})
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to move back: %w", err)
+	}
+
+	// staged documents, such as uploads and ZIP entries, have no directory
+	// to go back to
+	_, err = os.Stat(filepath.Dir(result.Source))
+	if err != nil {
+		return fmt.Errorf("failed to move back: %w", err)
+	}
+
+	if c.DryRun {
+		fmt.Printf("%s -> %s\n", result.Filename, result.Source)
+		return nil
+	}
+
+	err = renameFile(result.Filename, result.Source)
+	if err != nil {
+		return fmt.Errorf("failed to move back: %w", err)
+	}
+
+	slog.Info("undo", "filename", result.Filename, "source", result.Source)
+
+	return nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// validateFilename guards against renaming a document to a name produced by
+// a failed extraction, such as `.pdf` or `<no value>.pdf`.
+func validateFilename(tmpl *filenameTemplate, dir, filename string) error {
+	if strings.TrimSpace(filename) == "" {
+		return fmt.Errorf("rendered filename is empty")
+	}
+
+	base := filepath.Base(filename)
+	if strings.TrimSpace(strings.TrimSuffix(base, filepath.Ext(base))) == "" {
+		return fmt.Errorf("rendered filename %q has no name before the extension", filename)
+	}
+
+	err := tmpl.validatePath(filename)
+	if err != nil {
+		return err
+	}
+
+	info, err := os.Stat(filepath.Join(dir, filename))
+	if err == nil && info.IsDir() {
+		return fmt.Errorf("rendered filename %q is an existing directory", filename)
+	}
+
+	// render the template without any values to see if extraction added anything
+	empty := map[string]string{}
+	for _, field := range templateFields(tmpl.Template) {
+		empty[field] = ""
+	}
+
+	skeleton, err := tmpl.render(empty)
+	if err == nil && skeleton == filename {
+		return fmt.Errorf("rendered filename %q does not contain any extracted values", filename)
+	}
+
+	return nil
+}
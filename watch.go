@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+type WatchCmd struct {
+	Inbox        string        `help:"directory to watch for new PDFs" default:"/in" type:"path"`
+	Outbox       string        `help:"directory to file renamed documents into" default:"/out" type:"path"`
+	Error        string        `help:"directory to move documents that fail to be renamed into, along with a .error.json file describing the failure" default:"/err" type:"path"`
+	PollInterval time.Duration `help:"how often to look for new PDFs, for bind mounts and network shares whose changes cannot be watched" default:"30s"`
+	Settle       time.Duration `help:"how long a PDF must go unmodified before it is renamed, so files still being copied are left alone" default:"5s"`
+	PidFile      string        `help:"file to write the process ID to while watching" type:"path"`
+
+	RenameFlags `embed:""`
+	ShardFlags  `embed:""`
+	FilterFlags `embed:""`
+}
+
+// Run renames each PDF that appears in the inbox into the outbox, moving those
+// that fail into the error directory, until it receives SIGINT or SIGTERM. The
+// document being renamed is finished before exiting.
+func (c *WatchCmd) Run() error {
+	for _, dir := range []string{c.Inbox, c.Outbox, c.Error} {
+		err := os.MkdirAll(dir, 0o755)
+		if err != nil {
+			return fmt.Errorf("failed to create directory: %w", err)
+		}
+	}
+
+	if c.PidFile != "" {
+		remove, err := writePidFile(c.PidFile)
+		if err != nil {
+			return err
+		}
+		defer remove()
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// changes are watched where possible, and the inbox is still polled, as
+	// changes made outside of a container to a bind mount are not seen
+	events, closeWatch, err := watchDir(c.Inbox)
+	if err != nil {
+		slog.Warn("watch.poll", "inbox", c.Inbox, "interval", c.PollInterval, "error", err)
+	} else {
+		defer closeWatch()
+	}
+
+	slog.Info("watch.start", "inbox", c.Inbox, "outbox", c.Outbox, "error", c.Error)
+	notifySystemd("READY=1\nSTATUS=watching " + c.Inbox)
+
+	// documents left in the inbox after failing, such as in a dry run, or
+	// after being filtered out, are not looked at again until they change
+	seen := map[string]bool{}
+
+	for {
+		wait := c.PollInterval
+
+		pending, err := c.renameInbox(ctx, seen)
+		if err != nil {
+			slog.Error("watch.scan", "inbox", c.Inbox, "error", err)
+		}
+
+		if pending {
+			wait = min(wait, c.Settle)
+		}
+
+		select {
+		case <-ctx.Done():
+			notifySystemd("STOPPING=1")
+			slog.Info("watch.stop")
+
+			return nil
+		case <-events:
+		case <-time.After(wait):
+		}
+	}
+}
+
+// renameInbox renames the settled PDFs in the inbox, reporting whether any
+// are still being written.
+func (c *WatchCmd) renameInbox(ctx context.Context, seen map[string]bool) (bool, error) {
+	entries, err := os.ReadDir(c.Inbox)
+	if err != nil {
+		return false, fmt.Errorf("failed to list inbox: %w", err)
+	}
+
+	sources := []string{}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.Type().IsRegular() || strings.HasPrefix(name, ".") || !strings.EqualFold(filepath.Ext(name), ".pdf") || !c.Shard.includes(name) {
+			continue
+		}
+
+		sources = append(sources, filepath.Join(c.Inbox, name))
+	}
+
+	c.order(sources)
+
+	pending := false
+
+	for _, source := range sources {
+		if ctx.Err() != nil {
+			return pending, nil
+		}
+
+		info, err := os.Stat(source)
+		if err != nil {
+			continue
+		}
+
+		if time.Since(info.ModTime()) < c.Settle {
+			pending = true
+			continue
+		}
+
+		key := fmt.Sprintf("%s\x00%d\x00%d", source, info.Size(), info.ModTime().UnixNano())
+		if seen[key] {
+			continue
+		}
+
+		seen[key] = true
+
+		reason := c.FilterFlags.skip(source, info)
+		if reason != "" {
+			slog.Info("filter.skip", "name", source, "reason", reason)
+			continue
+		}
+
+		flags := c.RenameFlags
+		flags.dir = c.Outbox
+		flags.QuarantineDir = c.Error
+
+		// a document being renamed is finished even when shutting down
+		filename, err := flags.rename(context.Background(), source)
+		if err != nil {
+			err = errors.Join(err, flags.quarantine(source, c.Outbox, err))
+			slog.Error("watch.failure", "source", source, "kind", failureKind(err), "error", err)
+			run.failed(source, err)
+		} else {
+			slog.Info("watch.rename", "source", source, "filename", filename)
+		}
+
+		if _, err := os.Stat(source); err != nil {
+			delete(seen, key)
+		}
+	}
+
+	return pending, nil
+}
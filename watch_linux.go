@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// watchDir signals when files are written, moved, or created in the
+// directory, with inotify.
+func watchDir(dir string) (<-chan struct{}, func(), error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to watch directory: %w", err)
+	}
+
+	_, err = unix.InotifyAddWatch(fd, dir, unix.IN_CLOSE_WRITE|unix.IN_MOVED_TO|unix.IN_CREATE)
+	if err != nil {
+		_ = unix.Close(fd)
+		return nil, nil, fmt.Errorf("failed to watch directory: %w", err)
+	}
+
+	// a non-blocking descriptor uses the runtime poller, so closing the file
+	// stops the read below
+	file := os.NewFile(uintptr(fd), "inotify")
+	events := make(chan struct{}, 1)
+
+	go func() {
+		buffer := make([]byte, 64*(unix.SizeofInotifyEvent+unix.NAME_MAX+1))
+
+		for {
+			_, err := file.Read(buffer)
+			if err != nil {
+				return
+			}
+
+			select {
+			case events <- struct{}{}:
+			default:
+			}
+		}
+	}()
+
+	return events, func() { _ = file.Close() }, nil
+}
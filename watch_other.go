@@ -0,0 +1,9 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+func watchDir(string) (<-chan struct{}, func(), error) {
+	return nil, nil, errors.New("watching directories is only supported on Linux")
+}
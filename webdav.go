@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// webDAVShare is a minimal WebDAV client, such as for a Nextcloud share at
+// webdavs://cloud.example.com/remote.php/dav/files/USER/.
+type webDAVShare struct {
+	client   *http.Client
+	base     string
+	username string
+	password string
+}
+
+// newWebDAVShare uses the credentials in the URI, or WEBDAV_USERNAME and
+// WEBDAV_PASSWORD, such as a Nextcloud app password.
+func newWebDAVShare(uri *url.URL) *webDAVShare {
+	scheme := "http"
+	if uri.Scheme == "webdavs" {
+		scheme = "https"
+	}
+
+	share := &webDAVShare{
+		client:   &http.Client{Timeout: 5 * time.Minute},
+		base:     scheme + "://" + uri.Host,
+		username: os.Getenv("WEBDAV_USERNAME"),
+		password: os.Getenv("WEBDAV_PASSWORD"),
+	}
+
+	if uri.User != nil {
+		share.username = uri.User.Username()
+		if password, ok := uri.User.Password(); ok {
+			share.password = password
+		}
+	}
+
+	return share
+}
+
+func (s *webDAVShare) url(key string) string {
+	return s.base + (&url.URL{Path: "/" + key}).EscapedPath()
+}
+
+// do sends the request, returning an error for non-2xx responses. The
+// response is returned along with the error, for its status code.
+func (s *webDAVShare) do(ctx context.Context, method, key string, body io.Reader, headers map[string]string) (*http.Response, error) {
+	request, err := http.NewRequestWithContext(ctx, method, s.url(key), body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create WebDAV request: %w", err)
+	}
+
+	if s.username != "" {
+		request.SetBasicAuth(s.username, s.password)
+	}
+
+	for name, value := range headers {
+		request.Header.Set(name, value)
+	}
+
+	response, err := s.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode < 200 || 299 < response.StatusCode {
+		defer response.Body.Close()
+
+		message, _ := io.ReadAll(io.LimitReader(response.Body, 4096))
+
+		return response, fmt.Errorf("%s %s: %s: %s", method, request.URL.Redacted(), response.Status, strings.TrimSpace(string(message)))
+	}
+
+	return response, nil
+}
+
+func (s *webDAVShare) get(ctx context.Context, key string, w io.Writer) error {
+	response, err := s.do(ctx, http.MethodGet, key, nil, nil)
+	if err != nil {
+		return fmt.Errorf("failed to get %s: %w", key, err)
+	}
+	defer response.Body.Close()
+
+	_, err = io.Copy(w, response.Body)
+	if err != nil {
+		return fmt.Errorf("failed to download %s: %w", key, err)
+	}
+
+	return nil
+}
+
+// put uploads the file, refusing to overwrite an existing file.
+func (s *webDAVShare) put(ctx context.Context, key string, r io.Reader) error {
+	err := s.mkcol(ctx, path.Dir(key))
+	if err != nil {
+		return err
+	}
+
+	response, err := s.do(ctx, http.MethodPut, key, r, map[string]string{
+		"Content-Type":  "application/pdf",
+		"If-None-Match": "*",
+	})
+	if err != nil {
+		return fmt.Errorf("failed to put %s: %w", key, err)
+	}
+
+	return response.Body.Close()
+}
+
+func (s *webDAVShare) delete(ctx context.Context, key string) error {
+	response, err := s.do(ctx, http.MethodDelete, key, nil, nil)
+	if err != nil {
+		return fmt.Errorf("failed to delete %s: %w", key, err)
+	}
+
+	return response.Body.Close()
+}
+
+// move renames the file on the server, refusing to overwrite an existing
+// file.
+func (s *webDAVShare) move(ctx context.Context, from, to string) error {
+	err := s.mkcol(ctx, path.Dir(to))
+	if err != nil {
+		return err
+	}
+
+	response, err := s.do(ctx, "MOVE", from, nil, map[string]string{
+		"Destination": s.url(to),
+		"Overwrite":   "F",
+	})
+	if err != nil {
+		return fmt.Errorf("failed to move %s: %w", from, err)
+	}
+
+	return response.Body.Close()
+}
+
+// mkcol creates the collection and any missing parents. A collection that
+// already exists is not an error.
+func (s *webDAVShare) mkcol(ctx context.Context, key string) error {
+	if key == "." || key == "/" || key == "" {
+		return nil
+	}
+
+	status, err := s.mkcolOnce(ctx, key)
+	if status == http.StatusConflict {
+		// the parent is missing
+		err = s.mkcol(ctx, path.Dir(key))
+		if err != nil {
+			return err
+		}
+
+		status, err = s.mkcolOnce(ctx, key)
+	}
+
+	if err == nil || status == http.StatusMethodNotAllowed {
+		return nil
+	}
+
+	return fmt.Errorf("failed to create %s: %w", key, err)
+}
+
+func (s *webDAVShare) mkcolOnce(ctx context.Context, key string) (int, error) {
+	response, err := s.do(ctx, "MKCOL", key+"/", nil, nil)
+	if response == nil {
+		return 0, err
+	}
+	_ = response.Body.Close()
+
+	return response.StatusCode, err
+}
+
+// close does nothing, as requests do not hold a connection.
+func (s *webDAVShare) close() error {
+	return nil
+}
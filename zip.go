@@ -0,0 +1,190 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+type ZipFlags struct {
+	ZipOutput  string `help:"write the renamed documents of a ZIP input to this ZIP file" type:"path"`
+	ZipExtract string `help:"extract the renamed documents of a ZIP input into this directory (defaults to the current directory)" type:"path"`
+}
+
+// renameZip renames every PDF in the archive, either extracting them into a
+// directory or writing them into a new archive, along with the files written
+// next to them. A document that fails does not stop the rest, and is left out
+// of the new archive. Documents are named by the archive and their name in it,
+// such as `scans.zip/scan001.pdf`, rather than by the staging directory.
+func (c *RenameCmd) renameZip(ctx context.Context, filename string) error {
+	archive, err := zip.OpenReader(filename)
+	if err != nil {
+		return fmt.Errorf("failed to open ZIP: %w", err)
+	}
+	defer archive.Close()
+
+	staging, err := os.MkdirTemp("", "pdfrenamer-zip-*")
+	if err != nil {
+		return fmt.Errorf("failed to create staging directory: %w", err)
+	}
+	defer func() { _ = os.RemoveAll(staging) }()
+
+	output := filepath.Join(staging, "renamed")
+	if c.ZipOutput == "" {
+		output = c.ZipExtract
+	}
+
+	flags := c.RenameFlags
+	flags.dir = output
+
+	// the entries of the staged documents
+	entries := map[string]string{}
+
+	flags.locate = func(staged string) string {
+		if entry, ok := entries[staged]; ok {
+			return filepath.Join(filename, filepath.FromSlash(entry))
+		}
+
+		name, err := filepath.Rel(output, staged)
+		if c.ZipOutput == "" || err != nil || !filepath.IsLocal(name) {
+			return staged
+		}
+
+		return filepath.Join(c.ZipOutput, name)
+	}
+
+	renamed := 0
+	results := &batch{}
+
+	for index, entry := range archive.File {
+		if !isZipPDF(entry) {
+			continue
+		}
+
+		source, err := extractZipEntry(entry, staging, index)
+		if err != nil {
+			return err
+		}
+
+		slog.Info("zip.entry", "name", entry.Name)
+
+		entries[source] = entry.Name
+		flags.originalName = path.Base(entry.Name)
+
+		renamedFile, err := flags.rename(ctx, source)
+		if err != nil {
+			results.add(entry.Name, errors.Join(err, flags.quarantine(source, c.ZipExtract, err)))
+			continue
+		}
+
+		results.add(entry.Name, nil)
+
+		if c.DryRun {
+			fmt.Printf("%s -> %s\n", entry.Name, flags.location(renamedFile))
+		}
+
+		renamed++
+	}
+
+	if 0 < len(results.failures) {
+		results.summarize(os.Stderr)
+	}
+
+	if c.ZipOutput != "" && !c.DryRun && 0 < renamed {
+		err = writeZip(c.ZipOutput, output)
+		if err != nil {
+			return err
+		}
+	}
+
+	return results.err()
+}
+
+func isZipPDF(entry *zip.File) bool {
+	name := entry.Name
+
+	return !entry.FileInfo().IsDir() &&
+		!strings.HasPrefix(name, "__MACOSX/") &&
+		!strings.HasPrefix(path.Base(name), ".") &&
+		strings.EqualFold(path.Ext(name), ".pdf")
+}
+
+// extractZipEntry writes an entry into the staging directory, using only its
+// base name so entries cannot escape the directory.
+func extractZipEntry(entry *zip.File, staging string, index int) (string, error) {
+	reader, err := entry.Open()
+	if err != nil {
+		return "", fmt.Errorf("failed to open %q in ZIP: %w", entry.Name, err)
+	}
+	defer reader.Close()
+
+	filename := filepath.Join(staging, fmt.Sprintf("%d-%s", index, path.Base(entry.Name)))
+
+	file, err := os.Create(filename)
+	if err != nil {
+		return "", fmt.Errorf("failed to create %q: %w", filename, err)
+	}
+	defer file.Close()
+
+	_, err = io.Copy(file, reader)
+	if err != nil {
+		return "", fmt.Errorf("failed to extract %q from ZIP: %w", entry.Name, err)
+	}
+
+	return filename, nil
+}
+
+// writeZip archives every file in dir, such as the renamed documents and
+// their tables, named relative to dir.
+func writeZip(filename, dir string) error {
+	return writeFile(filename, 0o644, false, func(file io.Writer) error {
+		archive := zip.NewWriter(file)
+
+		err := filepath.WalkDir(dir, func(renamed string, entry fs.DirEntry, err error) error {
+			if err != nil || entry.IsDir() {
+				return err
+			}
+
+			name, err := filepath.Rel(dir, renamed)
+			if err != nil {
+				return fmt.Errorf("failed to name %q in ZIP: %w", renamed, err)
+			}
+
+			writer, err := archive.Create(filepath.ToSlash(name))
+			if err != nil {
+				return fmt.Errorf("failed to add %q to ZIP: %w", name, err)
+			}
+
+			contents, err := os.Open(renamed)
+			if err != nil {
+				return fmt.Errorf("failed to open %q: %w", renamed, err)
+			}
+			defer contents.Close()
+
+			_, err = io.Copy(writer, contents)
+			if err != nil {
+				return fmt.Errorf("failed to write %q to ZIP: %w", name, err)
+			}
+
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		err = archive.Close()
+		if err != nil {
+			return fmt.Errorf("failed to finish ZIP: %w", err)
+		}
+
+		return nil
+	})
+}